@@ -33,16 +33,36 @@ func main() {
 	}
 	args := args.FromFlags()
 
+	if disabled := args.Safeguards.Disabled(); len(disabled) > 0 {
+		logger.Warningf("Some safeguards are disabled:\n%s", strings.Join(disabled, "\n"))
+	}
+
+	configFile := getConfigFile(args)
+
 	// Initialize
 	//azdClient := azuredevops.MakeClient(args.AZD.URL, args.AZD.Token)
-	k8sClient, err := kubernetes.MakeClient()
+	k8sClient, err := kubernetes.MakeClient(kubernetes.Safeguards{
+		ProtectedNamespaces:      args.Safeguards.ProtectedNamespaces,
+		ProtectedKinds:           args.Safeguards.ProtectedKinds,
+		RequiredDeleteLabel:      args.Safeguards.RequiredDeleteLabel,
+		MaxDeletionsPerExecution: args.Safeguards.MaxDeletionsPerHook,
+		MaxDeletionsPerWindow:    args.Safeguards.MaxDeletionsPerWindow,
+		DeletionWindow:           args.Safeguards.DeletionWindow,
+	}, configFile.ToClusterConfigs(), kubernetes.ClientOptions{
+		DiscoveryCacheTTL: args.Kubernetes.DiscoveryCacheTTL,
+		Concurrency:       args.Kubernetes.Concurrency,
+		QPS:               args.Kubernetes.QPS,
+		Burst:             args.Kubernetes.Burst,
+		Retries:           args.Kubernetes.Retries,
+	})
 	if err != nil {
 		panic(err.Error())
 	}
 
-	configFile := getConfigFile(args)
+	ruleHandler := processors.NewRuleHandler(k8sClient)
+	preflight(args, configFile, ruleHandler)
 
-	serveHTTP(args, configFile, k8sClient)
+	serveHTTP(args, configFile, ruleHandler)
 
 	for {
 		time.Sleep(args.Rate)
@@ -80,14 +100,45 @@ func getConfigFile(args args.Args) config.File {
 	return configFile
 }
 
-func serveHTTP(args args.Args, configFile config.File, k8sClient kubernetes.ClientAsync) {
+// preflight checks that the kinds of every rule exist, and that the rules are allowed the verbs they need
+func preflight(arguments args.Args, configFile config.File, ruleHandler processors.RuleHandler) {
+	if arguments.Preflight == args.PreflightSkip {
+		return
+	}
+
+	var warnings []string
+	var errors []string
+	for pos, serviceHook := range configFile.ServiceHooks {
+		serviceHookWarnings, err := ruleHandler.Impersonating(serviceHook.Impersonate).Preflight(serviceHook.Rules)
+		for _, warning := range serviceHookWarnings {
+			warnings = append(warnings, fmt.Sprintf("Service Hook definition %d: %s", pos, warning))
+		}
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Service Hook definition %d: %s", pos, strings.ReplaceAll(err.Error(), "\n", fmt.Sprintf("\nService Hook definition %d: ", pos))))
+		}
+	}
+
+	if len(warnings) > 0 {
+		logger.Warningf("Warnings from preflight:\n%s", strings.Join(warnings, "\n"))
+	}
+	if len(errors) > 0 {
+		if arguments.Preflight == args.PreflightFail {
+			panicf("Errors from preflight:\n%s", strings.Join(errors, "\n"))
+		}
+		logger.Warningf("Errors from preflight:\n%s", strings.Join(errors, "\n"))
+	} else {
+		logger.Infof("Preflight checked the rules of %d Service Hook definitions", len(configFile.ServiceHooks))
+	}
+}
+
+func serveHTTP(args args.Args, configFile config.File, ruleHandler processors.RuleHandler) {
 	pathPrefix := strings.Trim(args.ServiceHooks.BasePath, "/")
 	if pathPrefix != "" {
 		pathPrefix = "/" + pathPrefix
 	}
 
 	mux := http.NewServeMux()
-	mux.Handle(fmt.Sprintf("%s/serviceHooks", pathPrefix), processors.NewServiceHookHandler(args.ServiceHooks, configFile.ServiceHooks, processors.NewRuleHandler(k8sClient)))
+	mux.Handle(fmt.Sprintf("%s/serviceHooks", pathPrefix), processors.NewServiceHookHandler(args.ServiceHooks, configFile.ServiceHooks, ruleHandler))
 
 	var healthMux *http.ServeMux
 	if args.ServiceHooks.Port != args.Health.Port {
@@ -18,15 +18,42 @@ var (
 	username   = flag.String("username", "", "The username to use for Service Hooks basic authentication.")
 	password   = flag.String("password", "", "The password to use for Service Hooks basic authentication.")
 	healthPort = flag.Int("health-port", 10902, "The port to serve health checks and metrics.")
+	dryRun     = flag.Bool("dry-run", false, "If true, send every Kubernetes change with server-side dry run, so that nothing is persisted.")
+	preflight  = flag.String("preflight", PreflightWarn, "What to do when the startup preflight finds problems with the rules: fail, warn, or skip.")
+
+	protectedNamespaces   = flag.String("protected-namespaces", "kube-system,kube-public,kube-node-lease,default", "A comma-separated list of namespaces whose resources are never changed.")
+	protectedKinds        = flag.String("protected-kinds", "CustomResourceDefinition.apiextensions.k8s.io", "A comma-separated list of kinds that are never changed, as Kind or Kind.group.")
+	requiredDeleteLabel   = flag.String("required-delete-label", "", "The label that every deleted resource must have, as key or key=value.")
+	maxDeletionsPerHook   = flag.Int("max-deletions-per-hook", 100, "The maximum number of resources deleted by a single Service Hook. 0 is unlimited.")
+	maxDeletionsPerWindow = flag.Int("max-deletions-per-window", 500, "The maximum number of resources deleted within the deletion window. 0 is unlimited.")
+	deletionWindow        = flag.Duration("deletion-window", time.Hour, "The duration of the deletion window.")
+
+	discoveryCacheTTL = flag.Duration("discovery-cache-ttl", 10*time.Minute, "How long the API resources discovered from Kubernetes are cached. 0 caches them until a kind isn't found.")
+	concurrency       = flag.Int("kubernetes-concurrency", 10, "The maximum number of changes that bulk operations make to Kubernetes at once.")
+	qps               = flag.Float64("kubernetes-qps", 20, "The maximum number of requests per second to each Kubernetes cluster.")
+	burst             = flag.Int("kubernetes-burst", 40, "The number of requests to each Kubernetes cluster that can exceed the QPS in a burst.")
+	retries           = flag.Int("kubernetes-retries", 3, "The number of times a Kubernetes change that fails with a rate limit, a conflict, or a server error is retried.")
+)
+
+const (
+	// PreflightFail stops azd-kubernetes-manager when the preflight finds problems
+	PreflightFail = "fail"
+	// PreflightWarn logs the problems found by the preflight as warnings
+	PreflightWarn = "warn"
+	// PreflightSkip doesn't run the preflight
+	PreflightSkip = "skip"
 )
 
 // Args holds all of the program arguments
 type Args struct {
 	Rate         time.Duration
 	ConfigFile   string
+	Preflight    string
 	ServiceHooks ServiceHookArgs
 	AZD          AzureDevopsArgs
 	Health       HealthArgs
+	Safeguards   SafeguardArgs
+	Kubernetes   KubernetesArgs
 }
 
 // ScaleDownArgs holds all of the scale-down related args
@@ -41,6 +68,7 @@ type ServiceHookArgs struct {
 	Port     int
 	Username string
 	Password string
+	DryRun   bool
 }
 
 // UseBasicAuthentication returns true if the Username and Password are not empty
@@ -48,6 +76,40 @@ func (a ServiceHookArgs) UseBasicAuthentication() bool {
 	return a.Username != "" && a.Password != ""
 }
 
+// SafeguardArgs holds all of the args of the safeguards that protect resources from being changed by mistake
+type SafeguardArgs struct {
+	ProtectedNamespaces   []string
+	ProtectedKinds        []string
+	RequiredDeleteLabel   string
+	MaxDeletionsPerHook   int
+	MaxDeletionsPerWindow int
+	DeletionWindow        time.Duration
+}
+
+// Disabled returns a description of every safeguard that is disabled
+func (a SafeguardArgs) Disabled() []string {
+	var disabled []string
+	if a.RequiredDeleteLabel == "" {
+		disabled = append(disabled, "--required-delete-label is empty, so resources without a managed-by label can be deleted")
+	}
+	if a.MaxDeletionsPerHook == 0 {
+		disabled = append(disabled, "--max-deletions-per-hook is 0, so a single Service Hook can delete any number of resources")
+	}
+	if a.MaxDeletionsPerWindow == 0 {
+		disabled = append(disabled, "--max-deletions-per-window is 0, so any number of resources can be deleted within the deletion window")
+	}
+	return disabled
+}
+
+// KubernetesArgs holds all of the args of the Kubernetes clients
+type KubernetesArgs struct {
+	DiscoveryCacheTTL time.Duration
+	Concurrency       int
+	QPS               float32
+	Burst             int
+	Retries           int
+}
+
 // HealthArgs holds all of the healthcheck related args
 type HealthArgs struct {
 	Port int
@@ -65,12 +127,14 @@ func FromFlags() Args {
 	return Args{
 		Rate:       *rate,
 		ConfigFile: *configFile,
+		Preflight:  *preflight,
 
 		ServiceHooks: ServiceHookArgs{
 			BasePath: *basePath,
 			Port:     *port,
 			Username: *username,
 			Password: *password,
+			DryRun:   *dryRun,
 		},
 
 		AZD: AzureDevopsArgs{
@@ -81,9 +145,37 @@ func FromFlags() Args {
 		Health: HealthArgs{
 			Port: *healthPort,
 		},
+
+		Safeguards: SafeguardArgs{
+			ProtectedNamespaces:   splitList(*protectedNamespaces),
+			ProtectedKinds:        splitList(*protectedKinds),
+			RequiredDeleteLabel:   *requiredDeleteLabel,
+			MaxDeletionsPerHook:   *maxDeletionsPerHook,
+			MaxDeletionsPerWindow: *maxDeletionsPerWindow,
+			DeletionWindow:        *deletionWindow,
+		},
+
+		Kubernetes: KubernetesArgs{
+			DiscoveryCacheTTL: *discoveryCacheTTL,
+			Concurrency:       *concurrency,
+			QPS:               float32(*qps),
+			Burst:             *burst,
+			Retries:           *retries,
+		},
 	}
 }
 
+// splitList splits a comma-separated list, ignoring empty values
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 // ValidateArgs validates all of the command line arguments
 func ValidateArgs() error {
 	// Validate arguments
@@ -112,6 +204,12 @@ func ValidateArgs() error {
 		validationErrors = append(validationErrors, "The Azure Devops URL is required.")
 	}*/
 
+	switch *preflight {
+	case PreflightFail, PreflightWarn, PreflightSkip:
+	default:
+		validationErrors = append(validationErrors, fmt.Sprintf("Invalid preflight '%s'. Valid values are: %s, %s, %s", *preflight, PreflightFail, PreflightWarn, PreflightSkip))
+	}
+
 	if *port <= 0 {
 		validationErrors = append(validationErrors, "The port must be greater than 0.")
 	}
@@ -123,6 +221,33 @@ func ValidateArgs() error {
 		validationErrors = append(validationErrors, "Either the both or neither of the username and password must be provided.")
 	}
 
+	if *maxDeletionsPerHook < 0 {
+		validationErrors = append(validationErrors, "The maximum deletions per hook must not be negative.")
+	}
+	if *maxDeletionsPerWindow < 0 {
+		validationErrors = append(validationErrors, "The maximum deletions per window must not be negative.")
+	} else if *maxDeletionsPerWindow > 0 && *deletionWindow <= 0 {
+		validationErrors = append(validationErrors, "The deletion window must be greater than 0.")
+	}
+	if *discoveryCacheTTL < 0 {
+		validationErrors = append(validationErrors, "The discovery cache TTL must not be negative.")
+	}
+	if *concurrency <= 0 {
+		validationErrors = append(validationErrors, "The Kubernetes concurrency must be greater than 0.")
+	}
+	if *qps <= 0 {
+		validationErrors = append(validationErrors, "The Kubernetes QPS must be greater than 0.")
+	}
+	if *burst <= 0 {
+		validationErrors = append(validationErrors, "The Kubernetes burst must be greater than 0.")
+	}
+	if *retries < 0 {
+		validationErrors = append(validationErrors, "The Kubernetes retries must not be negative.")
+	}
+	if strings.HasPrefix(*requiredDeleteLabel, "=") {
+		validationErrors = append(validationErrors, "The required delete label must have a key.")
+	}
+
 	if len(validationErrors) > 0 {
 		return fmt.Errorf("Error(s) with arguments:\n%s", strings.Join(validationErrors, "\n"))
 	}
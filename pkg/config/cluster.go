@@ -0,0 +1,113 @@
+package config
+
+import (
+	newerrors "errors"
+	"fmt"
+	"strings"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
+)
+
+// Cluster is a named cluster that rules can target, instead of the cluster that azd-kubernetes-manager runs in
+type Cluster struct {
+	// The name of the cluster, used by the `cluster` field of rules and stages
+	Name string `yaml:"name"`
+
+	// The path of the kubeconfig file. If empty, the default kubeconfig file is used.
+	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+
+	// The kubeconfig context. If empty, the current context of the kubeconfig file is used.
+	Context string `yaml:"context,omitempty"`
+
+	// The URL of the API server. Required with a Secret.
+	Server string `yaml:"server,omitempty"`
+
+	// The Secret with the token and CA of the cluster, in the cluster that azd-kubernetes-manager runs in
+	Secret *ClusterSecret `yaml:"secret"`
+}
+
+// ClusterSecret is a Secret with the credentials of a cluster
+type ClusterSecret struct {
+	// The Secret namespace
+	Namespace string `yaml:"namespace"`
+
+	// The Secret name
+	Name string `yaml:"name"`
+
+	// The key of the bearer token. Defaults to "token".
+	TokenKey string `yaml:"tokenKey,omitempty"`
+
+	// The key of the PEM-encoded CA certificate. Defaults to "ca.crt".
+	CAKey string `yaml:"caKey,omitempty"`
+}
+
+///
+/// Describe()
+///
+
+// Describe returns a user-friendly representation of a Cluster
+func (c Cluster) Describe() string {
+	if c.Secret != nil {
+		return fmt.Sprintf("Name: %s\nServer: %s\nSecret: %s/%s", c.Name, c.Server, c.Secret.Namespace, c.Secret.Name)
+	}
+	return fmt.Sprintf("Name: %s\nKubeconfig: %s\nContext: %s", c.Name, c.Kubeconfig, c.Context)
+}
+
+///
+/// Validate
+///
+
+// Validate a Cluster definition. This function returns a slice of warnings and an error.
+func (c Cluster) Validate() ([]string, error) {
+	var errors []string
+
+	if c.Name == "" {
+		errors = append(errors, "The `Name` must be defined.")
+	}
+
+	if c.Secret != nil {
+		if c.Kubeconfig != "" || c.Context != "" {
+			errors = append(errors, "The `Kubeconfig` and `Context` can't be combined with the `Secret`.")
+		}
+		if c.Server == "" {
+			errors = append(errors, "The `Server` must be defined with the `Secret`.")
+		}
+		if c.Secret.Namespace == "" || c.Secret.Name == "" {
+			errors = append(errors, "The `Secret` namespace and name must be defined.")
+		}
+	} else if c.Kubeconfig == "" && c.Context == "" {
+		errors = append(errors, "Either the `Kubeconfig`, the `Context`, or the `Secret` must be defined.")
+	} else if c.Server != "" {
+		errors = append(errors, "The `Server` can only be defined with the `Secret`.")
+	}
+
+	var err error
+	if len(errors) > 0 {
+		err = newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return nil, err
+}
+
+///
+/// Mappings
+///
+
+// ToClusterConfig maps a Cluster to the config of a Kubernetes cluster
+func (c Cluster) ToClusterConfig() kubernetes.ClusterConfig {
+	clusterConfig := kubernetes.ClusterConfig{
+		Name:       c.Name,
+		Kubeconfig: c.Kubeconfig,
+		Context:    c.Context,
+		Server:     c.Server,
+	}
+	if c.Secret != nil {
+		clusterConfig.Secret = &kubernetes.ClusterSecret{
+			Namespace: c.Secret.Namespace,
+			Name:      c.Secret.Name,
+			TokenKey:  c.Secret.TokenKey,
+			CAKey:     c.Secret.CAKey,
+		}
+	}
+	return clusterConfig
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	newerrors "errors"
+	"fmt"
+	"strings"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/templating"
+)
+
+// CopyResourceRule lists resources to copy to another namespace
+type CopyResourceRule struct {
+	// The Kubernetes API version of the resource(s) to copy
+	APIVersion string `yaml:"apiVersion"`
+
+	// The resource kind
+	Kind string `yaml:"kind"`
+
+	// The resource(s) to copy
+	Source CopyResourceSource `yaml:"source"`
+
+	// Where to copy the resource(s) to
+	Target CopyResourceTarget `yaml:"target"`
+
+	// If true, update existing copies. Otherwise, existing copies are left unchanged.
+	Sync bool `yaml:"sync"`
+
+	// The options shared by every rule
+	RuleOptions `yaml:",inline"`
+}
+
+// CopyResourceSource finds the resources to copy
+type CopyResourceSource struct {
+	// The source namespace
+	Namespace string `yaml:"namespace"`
+
+	// The source name. If defined, the label selector is ignored.
+	Name string `yaml:"name,omitempty"`
+
+	// The label selector
+	Selector LabelSelector `yaml:"selector"`
+}
+
+// CopyResourceTarget defines where resources are copied to
+type CopyResourceTarget struct {
+	// The target namespace
+	Namespace string `yaml:"namespace"`
+
+	// The name of the copy. If empty, the source name is used.
+	Name string `yaml:"name,omitempty"`
+
+	// Labels to add or overwrite on the copy
+	Labels map[string]string `yaml:"labels"`
+}
+
+///
+/// Describe()
+///
+
+// Describe returns a user-friendly representation of a CopyResourceRule
+func (r CopyResourceRule) Describe() string {
+	return fmt.Sprintf(
+		"API Version: %s\nKinds: %s\nSource Namespace: %s\nSource Name: %s\nSource Label Selector:\n  %s\nTarget Namespace: %s\nTarget Name: %s\nTarget Labels: %v\nSync: %t",
+		r.APIVersion, r.Kind, r.Source.Namespace, r.Source.Name, strings.ReplaceAll(r.Source.Selector.Describe(), "\n", "\n  "), r.Target.Namespace, r.Target.Name, r.Target.Labels, r.Sync,
+	) + "\n" + r.RuleOptions.Describe()
+}
+
+///
+/// Validate
+///
+
+// Validate a Copy Kubernetes Resource rule definition. This function returns a slice of warnings and an error.
+func (r CopyResourceRule) Validate() ([]string, error) {
+	warnings, errors := validateResourceTarget("Copy", r.APIVersion, r.Kind, r.Source.Namespace, r.Source.Name, r.Source.Selector)
+
+	optionsWarnings, optionsErr := r.RuleOptions.Validate()
+	warnings = append(warnings, optionsWarnings...)
+	if optionsErr != nil {
+		errors = append(errors, optionsErr.Error())
+	}
+
+	if r.Source.Namespace == "" {
+		errors = append(errors, "The source `Namespace` must be defined.")
+	}
+
+	if r.Target.Namespace == "" {
+		errors = append(errors, "The target `Namespace` must be defined.")
+	} else if err := validateTemplate("Copy rule target namespace", r.Target.Namespace); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if err := validateTemplate("Copy rule target name", r.Target.Name); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	errors = append(errors, validateMetadataChanges("label", r.Target.Labels, nil)...)
+
+	var err error
+	if len(errors) > 0 {
+		err = newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return warnings, err
+}
+
+///
+/// Mappings
+///
+
+// ToTemplatedCopyOptions templates the target, and maps it to the options of a Kubernetes client copy
+func (r CopyResourceRule) ToTemplatedCopyOptions(args templating.Args) (kubernetes.CopyOptions, error) {
+	targetNamespace, err := templating.Execute("CopyResourceRule", r.Target.Namespace, args)
+	if err != nil {
+		return kubernetes.CopyOptions{}, fmt.Errorf("Target namespace templating error: %s", err.Error())
+	}
+
+	targetName, err := templating.Execute("CopyResourceRule", r.Target.Name, args)
+	if err != nil {
+		return kubernetes.CopyOptions{}, fmt.Errorf("Target name templating error: %s", err.Error())
+	}
+
+	labels := make(map[string]string)
+	for label, value := range r.Target.Labels {
+		templatedValue, err := templating.Execute("CopyResourceRule", value, args)
+		if err != nil {
+			return kubernetes.CopyOptions{}, fmt.Errorf("Target label \"%s\" templating error: %s", label, err.Error())
+		}
+		labels[label] = templatedValue
+	}
+
+	return kubernetes.CopyOptions{
+		TargetNamespace: targetNamespace,
+		TargetName:      targetName,
+		Labels:          labels,
+		Sync:            r.Sync,
+	}, nil
+}
+
+// ToPreflightChecks returns the verbs that a CopyResourceRule needs in the source and target namespaces
+func (r CopyResourceRule) ToPreflightChecks() []kubernetes.PreflightCheck {
+	return []kubernetes.PreflightCheck{
+		toPreflightCheck(r.APIVersion, r.Kind, r.Source.Namespace, nil, "list", "get"),
+		toPreflightCheck(r.APIVersion, r.Kind, r.Target.Namespace, nil, "get", "create", "patch"),
+	}
+}
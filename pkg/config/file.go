@@ -1,7 +1,13 @@
 package config
 
 import (
+	newerrors "errors"
+	"fmt"
+	"strings"
+
 	"gopkg.in/yaml.v2"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
 )
 
 // FileSection is an interface for the common methods in all File structs
@@ -12,6 +18,9 @@ type FileSection interface {
 
 // File is the root struct representing the config file
 type File struct {
+	// The named clusters that rules can target
+	Clusters []Cluster `yaml:"clusters"`
+
 	// Service hook rules
 	ServiceHooks []ServiceHook `yaml:"serviceHooks"`
 }
@@ -27,7 +36,16 @@ func NewConfigFile(configFileYaml []byte) (File, error) {
 
 // Describe returns a user-friendly representation of a ConfigFile
 func (c File) Describe() string {
-	description := "==============\nService Hooks:\n=============="
+	description := ""
+	if len(c.Clusters) > 0 {
+		var clusterDescriptions []string
+		for _, cluster := range c.Clusters {
+			clusterDescriptions = append(clusterDescriptions, cluster.Describe())
+		}
+		description += "==============\nClusters:\n==============" + joinYAMLSlice(clusterDescriptions) + "\n"
+	}
+
+	description += "==============\nService Hooks:\n=============="
 
 	var serviceHookDescriptions []string
 	for _, serviceHook := range c.ServiceHooks {
@@ -40,14 +58,62 @@ func (c File) Describe() string {
 
 // Validate a Config File. This function returns a slice of warnings and an error.
 func (c File) Validate() ([]string, error) {
+	var errors []string
+	var warnings []string
+
+	var clusterSections []FileSection
+	for _, value := range c.Clusters {
+		clusterSections = append(clusterSections, value)
+	}
+	clusterWarnings, clusterErr := validate(clusterSections, "Cluster definition")
+	warnings = append(warnings, clusterWarnings...)
+	if clusterErr != nil {
+		errors = append(errors, clusterErr.Error())
+	}
+
+	clusters := make(map[string]bool)
+	for _, cluster := range c.Clusters {
+		if clusters[cluster.Name] {
+			errors = append(errors, fmt.Sprintf("Cluster %s is defined more than once.", cluster.Name))
+		}
+		clusters[cluster.Name] = true
+	}
+
 	if len(c.ServiceHooks) == 0 {
-		return []string{"No rules were defined. azd-kubernetes-manager will just log Service Hook requests."}, nil
+		warnings = append(warnings, "No rules were defined. azd-kubernetes-manager will just log Service Hook requests.")
 	}
 
 	var fileSections []FileSection
 	for _, value := range c.ServiceHooks {
 		fileSections = append(fileSections, value)
 	}
+	serviceHookWarnings, serviceHookErr := validate(fileSections, "Service Hook definition")
+	warnings = append(warnings, serviceHookWarnings...)
+	if serviceHookErr != nil {
+		errors = append(errors, serviceHookErr.Error())
+	}
 
-	return validate(fileSections, "Service Hook definition")
+	for pos, serviceHook := range c.ServiceHooks {
+		for _, cluster := range serviceHook.Rules.GetClusters() {
+			if !clusters[cluster] {
+				errors = append(errors, fmt.Sprintf("Service Hook definition %d targets cluster %s, which is not defined in `clusters`.", pos, cluster))
+			}
+		}
+	}
+
+	var err error
+	if len(errors) > 0 {
+		err = newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return warnings, err
+}
+
+// ToClusterConfigs maps the named clusters to the configs of Kubernetes clusters
+func (c File) ToClusterConfigs() []kubernetes.ClusterConfig {
+	var clusterConfigs []kubernetes.ClusterConfig
+	for _, cluster := range c.Clusters {
+		clusterConfigs = append(clusterConfigs, cluster.ToClusterConfig())
+	}
+	return clusterConfigs
 }
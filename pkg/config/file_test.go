@@ -0,0 +1,144 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/config"
+)
+
+func TestFileValidateClusters(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		error string
+	}{
+		{"kubeconfig_context", `
+clusters:
+- name: dev
+  context: dev
+serviceHooks:
+- event: git.pullrequest.merged
+  rules:
+    delete:
+    - apiVersion: v1
+      kind: ConfigMap
+      name: settings
+      cluster: dev
+`, ""},
+		{"secret", `
+clusters:
+- name: dev
+  server: https://dev.example.com
+  secret:
+    namespace: azd
+    name: dev-cluster
+serviceHooks:
+- event: git.pullrequest.merged
+  rules:
+    stages:
+    - name: preview
+      cluster: dev
+      apply:
+      - |
+        apiVersion: v1
+        kind: Namespace
+        metadata:
+          name: preview
+`, ""},
+		{"undefined", `
+serviceHooks:
+- event: git.pullrequest.merged
+  rules:
+    delete:
+    - apiVersion: v1
+      kind: ConfigMap
+      name: settings
+      cluster: dev
+`, "targets cluster dev, which is not defined"},
+		{"duplicate", `
+clusters:
+- name: dev
+  context: dev
+- name: dev
+  context: dev-2
+`, "Cluster dev is defined more than once"},
+		{"secret_without_server", `
+clusters:
+- name: dev
+  secret:
+    namespace: azd
+    name: dev-cluster
+`, "The `Server` must be defined with the `Secret`"},
+		{"no_credentials", `
+clusters:
+- name: dev
+`, "Either the `Kubeconfig`, the `Context`, or the `Secret` must be defined"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, err := config.NewConfigFile([]byte(test.yaml))
+			if err != nil {
+				t.Fatalf("Expected the config file to parse: %s", err.Error())
+			}
+
+			_, err = file.Validate()
+			if test.error == "" && err != nil {
+				t.Errorf("Expected no error, but received: %s", err.Error())
+			} else if test.error != "" && (err == nil || !strings.Contains(err.Error(), test.error)) {
+				t.Errorf("Expected an error containing '%s', but received: %v", test.error, err)
+			}
+		})
+	}
+}
+
+func TestFileApplyRules(t *testing.T) {
+	file, err := config.NewConfigFile([]byte(`
+serviceHooks:
+- event: git.pullrequest.merged
+  rules:
+    apply:
+    - |
+      apiVersion: v1
+      kind: Namespace
+      metadata:
+        name: preview
+    - resources: |
+        apiVersion: v1
+        kind: ConfigMap
+        metadata:
+          name: settings
+          namespace: preview
+      when: '{{ eq .EventType "git.pullrequest.merged" }}'
+      dryRun: true
+`))
+	if err != nil {
+		t.Fatalf("Expected the config file to parse: %s", err.Error())
+	}
+	if _, err = file.Validate(); err != nil {
+		t.Errorf("Expected no error, but received: %s", err.Error())
+	}
+
+	apply := file.ServiceHooks[0].Rules.Apply
+	if len(apply) != 2 {
+		t.Fatalf("Expected 2 apply rules, but received %d", len(apply))
+	}
+	if !strings.Contains(apply[0].String(), "kind: Namespace") || apply[0].RuleOptions != (config.RuleOptions{}) {
+		t.Errorf("Expected the string form to define only resources, but received %#v", apply[0])
+	}
+	if !strings.Contains(apply[1].String(), "kind: ConfigMap") || apply[1].When == "" || !apply[1].DryRun {
+		t.Errorf("Expected the object form to define resources and options, but received %#v", apply[1])
+	}
+
+	_, err = config.NewConfigFile([]byte(`
+serviceHooks:
+- event: git.pullrequest.merged
+  rules:
+    apply:
+    - [not, a, rule]
+`))
+	if err == nil {
+		t.Errorf("Expected an apply rule that is neither a string nor an object to fail to parse")
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/templating"
 )
 
 func joinYAMLSlice(slice []string) string {
@@ -40,6 +43,111 @@ func validate(slice []FileSection, description string) ([]string, error) {
 	return warnings, err
 }
 
+// validateWhen validates that a when condition executes with the sample templating values and returns a boolean
+func validateWhen(description string, when string) ([]string, error) {
+	if when == "" {
+		return nil, nil
+	}
+
+	templatedWhen, err := templating.Execute("ConfigFileValidation", when, sampleTemplatingArgs)
+	if err != nil {
+		return nil, fmt.Errorf("The %s `When` condition templating error: %s", description, err.Error())
+	} else if templatedWhen == when {
+		return nil, fmt.Errorf("The %s `When` condition does not have any Go templating", description)
+	}
+
+	if logger.LogDebug() {
+		logger.Debugf("Converted %s when condition:\n  %s\nto:\n  %s", description, strings.ReplaceAll(when, "\n", "\n  "), strings.ReplaceAll(templatedWhen, "\n", "\n  "))
+	}
+
+	if _, err := parseBoolean(templatedWhen); err != nil {
+		return []string{fmt.Sprintf("The %s `When` condition did not return a boolean value.", description)}, nil
+	}
+	return nil, nil
+}
+
+// evaluateWhen executes a when condition. An empty condition is true.
+func evaluateWhen(when string, args templating.Args) (bool, error) {
+	if when == "" {
+		return true, nil
+	}
+
+	templatedWhen, err := templating.Execute("When", when, args)
+	if err != nil {
+		return false, fmt.Errorf("When condition templating error: %s", err.Error())
+	}
+
+	return parseBoolean(templatedWhen)
+}
+
+// parseBoolean parses the result of a template that must return true or false
+func parseBoolean(value string) (bool, error) {
+	trimmedValue := strings.TrimSpace(value)
+	if strings.EqualFold(trimmedValue, "true") {
+		return true, nil
+	} else if strings.EqualFold(trimmedValue, "false") {
+		return false, nil
+	}
+	return false, fmt.Errorf("Expected true or false, but received '%s'", trimmedValue)
+}
+
+// validateTemplate validates that a templated field executes with the sample templating values
+func validateTemplate(description string, value string) error {
+	if value == "" {
+		return nil
+	}
+
+	templatedValue, err := templating.Execute("ConfigFileValidation", value, sampleTemplatingArgs)
+	if err != nil {
+		return fmt.Errorf("%s templating error: %s", description, err.Error())
+	} else if logger.LogDebug() && templatedValue != value {
+		logger.Debugf("Converted %s template:\n  %s\nto:\n  %s", description, strings.ReplaceAll(value, "\n", "\n  "), strings.ReplaceAll(templatedValue, "\n", "\n  "))
+	}
+	return nil
+}
+
+// validateResourceTarget validates the fields that rules use to find resources. This function returns a slice of warnings and a slice of errors.
+func validateResourceTarget(ruleType string, apiVersion string, kind string, namespace string, name string, selector LabelSelector) ([]string, []string) {
+	var errors []string
+	var warnings []string
+
+	if apiVersion == "" {
+		errors = append(errors, "The Kubernetes API Version `APIVersion` must be defined. Use \"v1\" for the core API.")
+	} else {
+		split := strings.Split(apiVersion, "/")
+		if len(split) != 1 && len(split) != 2 {
+			errors = append(errors, fmt.Sprintf("Invalid API Version '%s'", apiVersion))
+		}
+	}
+
+	if kind == "" {
+		errors = append(errors, "The Kubernetes resource `Kind` must be defined.")
+	}
+
+	if err := validateTemplate(fmt.Sprintf("%s rule namespace", ruleType), namespace); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if name != "" {
+		if err := validateTemplate(fmt.Sprintf("%s rule name", ruleType), name); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	// A selector is only required without a name, but a selector set alongside a name must still be valid
+	if name == "" || !selector.IsEmpty() {
+		selectorWarnings, err := selector.Validate()
+		if len(selectorWarnings) > 0 {
+			warnings = append(warnings, selectorWarnings...)
+		}
+		if err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	return warnings, errors
+}
+
 func contains(value string, filters []string) bool {
 	if len(filters) == 0 {
 		return true
@@ -79,3 +187,63 @@ func containsPOSIXERE(value string, filters []string) (bool, error) {
 	}
 	return false, nil
 }
+
+// validateNamespaceSelector validates a namespace selector, which can't be combined with a namespace
+func validateNamespaceSelector(ruleType string, namespace string, namespaceSelector *LabelSelector) ([]string, []string) {
+	if namespaceSelector == nil {
+		return nil, nil
+	}
+
+	var errors []string
+
+	if namespace != "" {
+		errors = append(errors, fmt.Sprintf("%s rules cannot define both a `Namespace` and a `NamespaceSelector`.", ruleType))
+	}
+
+	warnings, err := namespaceSelector.Validate()
+	if err != nil {
+		errors = append(errors, fmt.Sprintf("Namespace selector error: %s", err.Error()))
+	}
+
+	return warnings, errors
+}
+
+// toPreflightCheck returns the verbs that a rule needs on a kind. Namespaces with Go templating and namespace selectors are only known when the rule runs.
+func toPreflightCheck(apiVersion string, kind string, namespace string, namespaceSelector *LabelSelector, verbs ...string) kubernetes.PreflightCheck {
+	templated := strings.Contains(namespace, "{{") || namespaceSelector != nil
+	if templated {
+		namespace = ""
+	}
+	return kubernetes.PreflightCheck{APIVersion: apiVersion, Kind: kind, Namespace: namespace, NamespaceTemplated: templated, Verbs: verbs}
+}
+
+// toNamespaceSelectorPreflightChecks returns the verbs that a rule needs to list the namespaces of its namespace selector
+func toNamespaceSelectorPreflightChecks(namespaceSelector *LabelSelector) []kubernetes.PreflightCheck {
+	if namespaceSelector == nil {
+		return nil
+	}
+	return []kubernetes.PreflightCheck{toPreflightCheck("v1", "Namespace", "", nil, "list")}
+}
+
+// parseTemplatedResources templates a YAML stream with the sample templating values and parses it.
+// This function also returns whether the namespace of each resource has Go templating.
+func parseTemplatedResources(value string) ([]KubernetesResource, []bool, error) {
+	templatedValue, err := templating.Execute("ConfigFileValidation", value, sampleTemplatingArgs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resources, err := NewKubernetesResources(templatedValue)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The namespaces are static if they're the same before templating
+	untemplatedResources, untemplatedErr := NewKubernetesResources(value)
+	namespaceTemplated := make([]bool, len(resources))
+	for i, resource := range resources {
+		namespaceTemplated[i] = untemplatedErr != nil || len(untemplatedResources) != len(resources) || untemplatedResources[i].Metadata.Namespace != resource.Metadata.Namespace
+	}
+
+	return resources, namespaceTemplated, nil
+}
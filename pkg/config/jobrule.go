@@ -0,0 +1,198 @@
+package config
+
+import (
+	newerrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/templating"
+)
+
+const (
+	defaultJobTimeout      = 10 * time.Minute
+	defaultJobPollInterval = 5 * time.Second
+	defaultJobLogLines     = int64(20)
+)
+
+// JobRule lists a Job to run and wait for
+type JobRule struct {
+	// The Job to create, as a templated YAML
+	Job Manifest `yaml:"job"`
+
+	// How long to wait for the Job to succeed or fail. Defaults to 10 minutes.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// How often to check the status of the Job. Defaults to 5 seconds.
+	PollInterval time.Duration `yaml:"pollInterval"`
+
+	// The number of lines of pod logs to report when the Job fails. Defaults to 20.
+	LogLines *int64 `yaml:"logLines"`
+
+	// The options shared by every rule
+	RuleOptions `yaml:",inline"`
+}
+
+///
+/// Describe()
+///
+
+// Describe returns a user-friendly representation of a JobRule
+func (r JobRule) Describe() string {
+	return fmt.Sprintf(
+		"Job: %s\nTimeout: %s\nPoll Interval: %s\nLog Lines: %d",
+		r.Job.Describe(), r.GetTimeout(), r.GetPollInterval(), r.GetLogLines(),
+	) + "\n" + r.RuleOptions.Describe()
+}
+
+///
+/// Validate
+///
+
+// Validate a Job rule definition. This function returns a slice of warnings and an error.
+func (r JobRule) Validate() ([]string, error) {
+	var errors []string
+	var warnings []string
+
+	optionsWarnings, optionsErr := r.RuleOptions.Validate()
+	warnings = append(warnings, optionsWarnings...)
+	if optionsErr != nil {
+		errors = append(errors, optionsErr.Error())
+	}
+
+	if r.Job == "" {
+		errors = append(errors, "The `Job` must be defined.")
+	} else {
+		templatedJob, err := templating.Execute("ConfigFileValidation", r.Job.String(), sampleTemplatingArgs)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Job rule error: %s", err.Error()))
+		} else if _, err := parseJob(templatedJob); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	if r.Timeout < 0 {
+		errors = append(errors, "The `Timeout` must not be negative.")
+	}
+
+	if r.PollInterval < 0 {
+		errors = append(errors, "The `PollInterval` must not be negative.")
+	}
+
+	if r.LogLines != nil && *r.LogLines < 0 {
+		errors = append(errors, "The `LogLines` must not be negative.")
+	}
+
+	var err error
+	if len(errors) > 0 {
+		err = newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return warnings, err
+}
+
+///
+/// Mappings
+///
+
+// GetTimeout returns the timeout, defaulting to 10 minutes
+func (r JobRule) GetTimeout() time.Duration {
+	if r.Timeout == 0 {
+		return defaultJobTimeout
+	}
+	return r.Timeout
+}
+
+// GetPollInterval returns the poll interval, defaulting to 5 seconds
+func (r JobRule) GetPollInterval() time.Duration {
+	if r.PollInterval == 0 {
+		return defaultJobPollInterval
+	}
+	return r.PollInterval
+}
+
+// GetLogLines returns the number of log lines, defaulting to 20
+func (r JobRule) GetLogLines() int64 {
+	if r.LogLines == nil {
+		return defaultJobLogLines
+	}
+	return *r.LogLines
+}
+
+// ToJobOptions maps a JobRule to the options of a Kubernetes client job run
+func (r JobRule) ToJobOptions() kubernetes.JobOptions {
+	return kubernetes.JobOptions{
+		Timeout:      r.GetTimeout(),
+		PollInterval: r.GetPollInterval(),
+		LogLines:     r.GetLogLines(),
+	}
+}
+
+// ParseTemplated templates the Job and then parses it
+func (r JobRule) ParseTemplated(args templating.Args) (KubernetesResource, error) {
+	templatedJob, err := templating.Execute("JobRule", r.Job.String(), args)
+	if err != nil {
+		return KubernetesResource{}, err
+	}
+
+	return parseJob(templatedJob)
+}
+
+// parseJob parses and validates a templated Job
+func parseJob(value string) (KubernetesResource, error) {
+	resources, err := NewKubernetesResources(value)
+	if err != nil {
+		return KubernetesResource{}, fmt.Errorf("Error parsing Job rule after templating: %s", err.Error())
+	}
+
+	if err := ValidateKubernetesResources(resources); err != nil {
+		return KubernetesResource{}, err
+	}
+
+	if len(resources) != 1 {
+		return KubernetesResource{}, fmt.Errorf("A Job rule must define exactly 1 resource, but %d were defined", len(resources))
+	}
+
+	if resources[0].Kind != "Job" {
+		return KubernetesResource{}, fmt.Errorf("A Job rule must define a Job, but a %s was defined", resources[0].Kind)
+	}
+
+	// Jobs without a namespace would be created in the default namespace, which is protected by default
+	if resources[0].Metadata.Namespace == "" {
+		return KubernetesResource{}, fmt.Errorf("A Job rule must define the namespace of the Job")
+	}
+
+	// A Job with a fixed name already exists the next time the rule runs, so every run must generate a new name
+	if resources[0].Metadata.Name != "" {
+		return KubernetesResource{}, fmt.Errorf("A Job rule must define a metadata.generateName instead of a metadata.name, since a Job with the name %s can only be created once", resources[0].Metadata.Name)
+	}
+
+	return resources[0], nil
+}
+
+// ToPreflightChecks returns the verbs that a JobRule needs on the Job and its Pods
+func (r JobRule) ToPreflightChecks() ([]kubernetes.PreflightCheck, error) {
+	resources, namespaceTemplated, err := parseTemplatedResources(r.Job.String())
+	if err != nil {
+		return nil, err
+	} else if len(resources) != 1 {
+		return nil, fmt.Errorf("A Job rule must define exactly 1 resource, but %d were defined", len(resources))
+	}
+
+	namespace := resources[0].Metadata.Namespace
+	logs := toPreflightCheck("v1", "Pod", namespace, nil, "get")
+	logs.Subresource = "log"
+
+	checks := []kubernetes.PreflightCheck{
+		toPreflightCheck(resources[0].APIVersion, resources[0].Kind, namespace, nil, "create", "get", "delete"),
+		toPreflightCheck("v1", "Pod", namespace, nil, "list"),
+		logs,
+	}
+	if namespaceTemplated[0] {
+		for i := range checks {
+			checks[i].Namespace, checks[i].NamespaceTemplated = "", true
+		}
+	}
+	return checks, nil
+}
@@ -1,12 +1,39 @@
 package config
 
 import (
+	"bufio"
+	newerrors "errors"
+	"fmt"
+	"io"
 	"strings"
 
+	"gopkg.in/yaml.v2"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sjson "k8s.io/apimachinery/pkg/util/json"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
 )
 
+// clusterScopedKinds are the built-in kinds that aren't namespaced, by API group
+var clusterScopedKinds = map[string][]string{
+	"":                             {"ComponentStatus", "Namespace", "Node", "PersistentVolume"},
+	"admissionregistration.k8s.io": {"MutatingWebhookConfiguration", "ValidatingWebhookConfiguration"},
+	"auditregistration.k8s.io":     {"AuditSink"},
+	"authentication.k8s.io":        {"TokenReview"},
+	"authorization.k8s.io":         {"SelfSubjectAccessReview", "SelfSubjectRulesReview", "SubjectAccessReview"},
+	"certificates.k8s.io":          {"CertificateSigningRequest"},
+	"extensions":                   {"PodSecurityPolicy"},
+	"node.k8s.io":                  {"RuntimeClass"},
+	"policy":                       {"PodSecurityPolicy"},
+	"rbac.authorization.k8s.io":    {"ClusterRole", "ClusterRoleBinding"},
+	"scheduling.k8s.io":            {"PriorityClass"},
+	"storage.k8s.io":               {"CSIDriver", "CSINode", "StorageClass", "VolumeAttachment"},
+}
+
 // KubernetesResource represents a Kubernetes resource, which has both Type and metadata information
 type KubernetesResource struct {
 	//
@@ -15,6 +42,9 @@ type KubernetesResource struct {
 	Kind       string                     `yaml:"kind"`
 	APIVersion string                     `yaml:"apiVersion"`
 	Metadata   KubernetesResourceMetadata `yaml:"metadata"`
+
+	// The entire resource, including the spec, data, status and any other fields
+	Object map[string]interface{} `yaml:"-"`
 }
 
 // KubernetesResourceMetadata represents a Kubernetes resource metadata
@@ -29,6 +59,84 @@ type KubernetesResourceMetadata struct {
 	Annotations  map[string]string `yaml:"annotations"`
 }
 
+// Validate a Kubernetes resource after it has been templated
+func (r KubernetesResource) Validate() error {
+	var errors []string
+
+	if r.APIVersion == "" {
+		errors = append(errors, "The Kubernetes resource `apiVersion` must be defined. Use \"v1\" for the core API.")
+	} else {
+		split := strings.Split(r.APIVersion, "/")
+		if len(split) != 1 && len(split) != 2 {
+			errors = append(errors, fmt.Sprintf("Invalid API Version '%s'", r.APIVersion))
+		}
+	}
+
+	if r.Kind == "" {
+		errors = append(errors, "The Kubernetes resource `kind` must be defined.")
+	}
+
+	if r.Metadata.Name == "" && r.Metadata.GenerateName == "" {
+		errors = append(errors, "Either `metadata.name` or `metadata.generateName` must be defined.")
+	}
+
+	if len(errors) > 0 {
+		return newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return nil
+}
+
+// IsNamespaced returns true if the resource is of a built-in namespaced kind.
+// Kinds that aren't built in, such as custom resources, are only known to be namespaced through API discovery, so false is returned for them.
+func (r KubernetesResource) IsNamespaced() bool {
+	groupVersionKind := schema.FromAPIVersionAndKind(r.APIVersion, r.Kind)
+	if !scheme.Scheme.Recognizes(groupVersionKind) {
+		return false
+	}
+
+	for _, kind := range clusterScopedKinds[groupVersionKind.Group] {
+		if kind == groupVersionKind.Kind {
+			return false
+		}
+	}
+	return true
+}
+
+// DefinedKind returns the kind that a CustomResourceDefinition defines. If the resource isn't a CustomResourceDefinition, false is returned.
+func (r KubernetesResource) DefinedKind() (schema.GroupKind, bool) {
+	if r.Kind != "CustomResourceDefinition" || r.ToGroupVersion().Group != "apiextensions.k8s.io" {
+		return schema.GroupKind{}, false
+	}
+
+	group, _, _ := unstructured.NestedString(r.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(r.Object, "spec", "names", "kind")
+	if group == "" || kind == "" {
+		return schema.GroupKind{}, false
+	}
+	return schema.GroupKind{Group: group, Kind: kind}, true
+}
+
+// ValidateKubernetesResources validates every document of a multi-document YAML stream after it has been templated
+func ValidateKubernetesResources(resources []KubernetesResource) error {
+	if len(resources) == 0 {
+		return newerrors.New("At least one Kubernetes resource must be defined.")
+	}
+
+	var errors []string
+	for pos, resource := range resources {
+		if err := resource.Validate(); err != nil {
+			errors = append(errors, fmt.Sprintf("Document %d:\n  %s", pos, strings.ReplaceAll(err.Error(), "\n", "\n  ")))
+		}
+	}
+
+	if len(errors) > 0 {
+		return newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return nil
+}
+
 // ToTypeMeta maps a KubernetesResource to a meta/v1 Type
 func (r KubernetesResource) ToTypeMeta() metav1.TypeMeta {
 	return metav1.TypeMeta{
@@ -48,6 +156,79 @@ func (r KubernetesResourceMetadata) ToObjectMeta() metav1.ObjectMeta {
 	}
 }
 
+// NewKubernetesResource parses a Kubernetes resource from YAML
+func NewKubernetesResource(value string) (KubernetesResource, error) {
+	resource := KubernetesResource{}
+
+	if err := yaml.Unmarshal([]byte(value), &resource); err != nil {
+		return resource, err
+	}
+
+	jsonValue, err := k8syaml.ToJSON([]byte(value))
+	if err != nil {
+		return resource, err
+	}
+
+	if err := k8sjson.Unmarshal(jsonValue, &resource.Object); err != nil {
+		return resource, err
+	}
+
+	return resource, nil
+}
+
+// NewKubernetesResources parses a stream of Kubernetes resources from a multi-document YAML. Empty documents are skipped.
+func NewKubernetesResources(value string) ([]KubernetesResource, error) {
+	var resources []KubernetesResource
+
+	reader := k8syaml.NewYAMLReader(bufio.NewReader(strings.NewReader(value)))
+	for pos := 0; ; pos++ {
+		document, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return resources, fmt.Errorf("Error reading YAML document %d: %s", pos, err.Error())
+		}
+
+		resource, err := NewKubernetesResource(string(document))
+		if err != nil {
+			return resources, fmt.Errorf("Error parsing YAML document %d: %s", pos, err.Error())
+		}
+
+		if len(resource.Object) > 0 {
+			resources = append(resources, resource)
+		}
+	}
+
+	return resources, nil
+}
+
+// Describe returns a user-friendly representation of a KubernetesResource
+func (r KubernetesResource) Describe() string {
+	name := r.Metadata.Name
+	if name == "" {
+		name = r.Metadata.GenerateName
+	}
+
+	return fmt.Sprintf("%s %s/%s", r.APIVersion, r.Kind, name)
+}
+
+// ToUnstructured maps a KubernetesResource to an unstructured Kubernetes object
+func (r KubernetesResource) ToUnstructured() unstructured.Unstructured {
+	if r.Object != nil {
+		return unstructured.Unstructured{Object: runtime.DeepCopyJSON(r.Object)}
+	}
+
+	resource := unstructured.Unstructured{Object: make(map[string]interface{})}
+	resource.SetAPIVersion(r.APIVersion)
+	resource.SetKind(r.Kind)
+	resource.SetName(r.Metadata.Name)
+	resource.SetGenerateName(r.Metadata.GenerateName)
+	resource.SetNamespace(r.Metadata.Namespace)
+	resource.SetLabels(r.Metadata.Labels)
+	resource.SetAnnotations(r.Metadata.Annotations)
+	return resource
+}
+
 // ToGroupVersion maps a KubernetesResource to a GroupVersion
 func (r KubernetesResource) ToGroupVersion() schema.GroupVersion {
 	split := strings.Split(r.APIVersion, "/")
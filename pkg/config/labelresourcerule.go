@@ -0,0 +1,162 @@
+package config
+
+import (
+	"encoding/json"
+	newerrors "errors"
+	"fmt"
+	"strings"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/templating"
+)
+
+// LabelResourceRule lists resources to add, overwrite or remove labels and annotations on
+type LabelResourceRule struct {
+	// The Kubernetes API version of the resource(s) to label
+	APIVersion string `yaml:"apiVersion"`
+
+	// The resource kind
+	Kind string `yaml:"kind"`
+
+	// The resource namespace
+	Namespace string `yaml:"namespace,omitempty"`
+
+	// The resource name. If defined, the label selector is ignored.
+	Name string `yaml:"name,omitempty"`
+
+	// The label selector
+	Selector LabelSelector `yaml:"selector"`
+
+	// Labels to add or overwrite
+	Labels map[string]string `yaml:"labels"`
+
+	// Annotations to add or overwrite
+	Annotations map[string]string `yaml:"annotations"`
+
+	// Labels to remove
+	RemoveLabels []string `yaml:"removeLabels"`
+
+	// Annotations to remove
+	RemoveAnnotations []string `yaml:"removeAnnotations"`
+
+	// The options shared by every rule
+	RuleOptions `yaml:",inline"`
+}
+
+///
+/// Describe()
+///
+
+// Describe returns a user-friendly representation of a LabelResourceRule
+func (r LabelResourceRule) Describe() string {
+	return fmt.Sprintf(
+		"API Version: %s\nKinds: %s\nNamespace: %s\nName: %s\nLabel Selector:\n  %s\nLabels: %v\nAnnotations: %v\nRemove Labels: %v\nRemove Annotations: %v",
+		r.APIVersion, r.Kind, r.Namespace, r.Name, strings.ReplaceAll(r.Selector.Describe(), "\n", "\n  "), r.Labels, r.Annotations, r.RemoveLabels, r.RemoveAnnotations,
+	) + "\n" + r.RuleOptions.Describe()
+}
+
+///
+/// Validate
+///
+
+// Validate a Label Kubernetes Resource rule definition. This function returns a slice of warnings and an error.
+func (r LabelResourceRule) Validate() ([]string, error) {
+	warnings, errors := validateResourceTarget("Label", r.APIVersion, r.Kind, r.Namespace, r.Name, r.Selector)
+
+	optionsWarnings, optionsErr := r.RuleOptions.Validate()
+	warnings = append(warnings, optionsWarnings...)
+	if optionsErr != nil {
+		errors = append(errors, optionsErr.Error())
+	}
+
+	if len(r.Labels) == 0 && len(r.Annotations) == 0 && len(r.RemoveLabels) == 0 && len(r.RemoveAnnotations) == 0 {
+		errors = append(errors, "At least one of `Labels`, `Annotations`, `RemoveLabels` or `RemoveAnnotations` must be defined.")
+	}
+
+	errors = append(errors, validateMetadataChanges("label", r.Labels, r.RemoveLabels)...)
+	errors = append(errors, validateMetadataChanges("annotation", r.Annotations, r.RemoveAnnotations)...)
+
+	var err error
+	if len(errors) > 0 {
+		err = newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return warnings, err
+}
+
+// validateMetadataChanges validates labels or annotations to set and remove. This function returns a slice of errors.
+func validateMetadataChanges(description string, values map[string]string, removals []string) []string {
+	var errors []string
+
+	for key, value := range values {
+		if key == "" {
+			errors = append(errors, fmt.Sprintf("Empty %s keys are not allowed.", description))
+		}
+		if err := validateTemplate(fmt.Sprintf("Label rule %s \"%s\"", description, key), value); err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	for pos, key := range removals {
+		if key == "" {
+			errors = append(errors, fmt.Sprintf("The %s to remove %d must not be empty.", description, pos))
+		} else if _, exists := values[key]; exists {
+			errors = append(errors, fmt.Sprintf("The %s \"%s\" cannot be both set and removed.", description, key))
+		}
+	}
+
+	return errors
+}
+
+///
+/// Mappings
+///
+
+// ToTemplatedPatch templates the labels and annotations, and creates a JSON merge patch that sets and removes them
+func (r LabelResourceRule) ToTemplatedPatch(args templating.Args) ([]byte, error) {
+	metadata := make(map[string]interface{})
+
+	labels, err := templateMetadataChanges("label", r.Labels, r.RemoveLabels, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(labels) > 0 {
+		metadata["labels"] = labels
+	}
+
+	annotations, err := templateMetadataChanges("annotation", r.Annotations, r.RemoveAnnotations, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(annotations) > 0 {
+		metadata["annotations"] = annotations
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"metadata": metadata,
+	})
+}
+
+// templateMetadataChanges templates labels or annotations to set, and sets the ones to remove to null
+func templateMetadataChanges(description string, values map[string]string, removals []string, args templating.Args) (map[string]interface{}, error) {
+	changes := make(map[string]interface{})
+
+	for key, value := range values {
+		templatedValue, err := templating.Execute("LabelResourceRule", value, args)
+		if err != nil {
+			return nil, fmt.Errorf("The %s \"%s\" templating error: %s", description, key, err.Error())
+		}
+		changes[key] = templatedValue
+	}
+
+	for _, key := range removals {
+		changes[key] = nil
+	}
+
+	return changes, nil
+}
+
+// ToPreflightChecks returns the verbs that a LabelResourceRule needs
+func (r LabelResourceRule) ToPreflightChecks() []kubernetes.PreflightCheck {
+	return []kubernetes.PreflightCheck{toPreflightCheck(r.APIVersion, r.Kind, r.Namespace, nil, "list", "patch")}
+}
@@ -51,6 +51,14 @@ func (ls LabelSelector) Describe() string {
 	return description
 }
 
+// describeNamespaceSelector returns a user-friendly representation of an optional namespace selector
+func describeNamespaceSelector(namespaceSelector *LabelSelector) string {
+	if namespaceSelector == nil {
+		return "None"
+	}
+	return strings.ReplaceAll(namespaceSelector.Describe(), "\n", "\n  ")
+}
+
 // Describe returns a user-friendly representation of a LabelSelectorRequirement
 func (lsr LabelSelectorRequirement) Describe() string {
 	switch lsr.Operator {
@@ -159,6 +167,11 @@ func (lsr LabelSelectorRequirement) Validate() ([]string, error) {
 /// Mappings
 ///
 
+// IsEmpty returns true if the LabelSelector doesn't define any requirements
+func (ls LabelSelector) IsEmpty() bool {
+	return len(ls.MatchLabels) == 0 && len(ls.MatchExpressions) == 0
+}
+
 // ToKubernetesLabelSelector maps a LabelSelector to a k8s.io/apimachinery/pkg/apis/meta/v1.LabelSelector
 func (ls LabelSelector) ToKubernetesLabelSelector() metav1.LabelSelector {
 	var expressions []metav1.LabelSelectorRequirement
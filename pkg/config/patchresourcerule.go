@@ -0,0 +1,187 @@
+package config
+
+import (
+	newerrors "errors"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+	k8sjson "k8s.io/apimachinery/pkg/util/json"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/templating"
+)
+
+// PatchResourceRule lists resources to patch
+type PatchResourceRule struct {
+	// The Kubernetes API version of the resource(s) to patch
+	APIVersion string `yaml:"apiVersion"`
+
+	// The resource kind
+	Kind string `yaml:"kind"`
+
+	// The resource namespace
+	Namespace string `yaml:"namespace,omitempty"`
+
+	// Selects the namespaces of the resources. Can't be combined with the namespace.
+	NamespaceSelector *LabelSelector `yaml:"namespaceSelector"`
+
+	// The resource name. If defined, the label selector is ignored.
+	Name string `yaml:"name,omitempty"`
+
+	// The label selector
+	Selector LabelSelector `yaml:"selector"`
+
+	// The patch type
+	Type PatchType `yaml:"type"`
+
+	// The patch, as YAML or JSON
+	Patch string `yaml:"patch"`
+
+	// The options shared by every rule
+	RuleOptions `yaml:",inline"`
+}
+
+// PatchType represents the type of patch to apply
+type PatchType string
+
+const (
+	// PatchTypeMerge represents a JSON merge patch (RFC 7386)
+	PatchTypeMerge PatchType = "merge"
+	// PatchTypeStrategic represents a Kubernetes strategic merge patch
+	PatchTypeStrategic PatchType = "strategic"
+	// PatchTypeJSON represents a JSON patch (RFC 6902)
+	PatchTypeJSON PatchType = "json"
+)
+
+///
+/// Describe()
+///
+
+// Describe returns a user-friendly representation of a PatchResourceRule
+func (r PatchResourceRule) Describe() string {
+	return fmt.Sprintf(
+		"API Version: %s\nKinds: %s\nNamespace: %s\nNamespace Selector:\n  %s\nName: %s\nLabel Selector:\n  %s\nPatch Type: %s\nPatch:\n  %s",
+		r.APIVersion, r.Kind, r.Namespace, describeNamespaceSelector(r.NamespaceSelector), r.Name, strings.ReplaceAll(r.Selector.Describe(), "\n", "\n  "), r.GetType(), strings.ReplaceAll(r.Patch, "\n", "\n  "),
+	) + "\n" + r.RuleOptions.Describe()
+}
+
+///
+/// Validate
+///
+
+// Validate a Patch Kubernetes Resource rule definition. This function returns a slice of warnings and an error.
+func (r PatchResourceRule) Validate() ([]string, error) {
+	warnings, errors := validateResourceTarget("Patch", r.APIVersion, r.Kind, r.Namespace, r.Name, r.Selector)
+
+	namespaceSelectorWarnings, namespaceSelectorErrors := validateNamespaceSelector("Patch", r.Namespace, r.NamespaceSelector)
+	warnings = append(warnings, namespaceSelectorWarnings...)
+	errors = append(errors, namespaceSelectorErrors...)
+
+	optionsWarnings, optionsErr := r.RuleOptions.Validate()
+	warnings = append(warnings, optionsWarnings...)
+	if optionsErr != nil {
+		errors = append(errors, optionsErr.Error())
+	}
+
+	switch r.GetType() {
+	case PatchTypeMerge, PatchTypeStrategic, PatchTypeJSON:
+	default:
+		errors = append(errors, fmt.Sprintf("Invalid patch `Type` \"%s\". Allowed values are %s, %s and %s.", r.Type, PatchTypeMerge, PatchTypeStrategic, PatchTypeJSON))
+	}
+
+	if r.Patch == "" {
+		errors = append(errors, "The `Patch` must be defined.")
+	} else {
+		templatedPatch, err := templating.Execute("ConfigFileValidation", r.Patch, sampleTemplatingArgs)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Patch rule patch templating error: %s", err.Error()))
+		} else {
+			if logger.LogDebug() && templatedPatch != r.Patch {
+				logger.Debugf("Converted Patch rule patch template:\n  %s\nto:\n  %s", strings.ReplaceAll(r.Patch, "\n", "\n  "), strings.ReplaceAll(templatedPatch, "\n", "\n  "))
+			}
+
+			if _, err := r.parsePatch(templatedPatch); err != nil {
+				errors = append(errors, fmt.Sprintf("Error parsing Patch rule patch after templating: %s", err.Error()))
+			}
+		}
+	}
+
+	var err error
+	if len(errors) > 0 {
+		err = newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return warnings, err
+}
+
+///
+/// Mappings
+///
+
+// GetType returns the patch type, defaulting to a JSON merge patch
+func (r PatchResourceRule) GetType() PatchType {
+	if r.Type == "" {
+		return PatchTypeMerge
+	}
+	return r.Type
+}
+
+// ToKubernetesPatchType maps a PatchResourceRule's patch type to a Kubernetes patch type
+func (r PatchResourceRule) ToKubernetesPatchType() types.PatchType {
+	switch r.GetType() {
+	case PatchTypeStrategic:
+		return types.StrategicMergePatchType
+	case PatchTypeJSON:
+		return types.JSONPatchType
+	default:
+		return types.MergePatchType
+	}
+}
+
+// ToTemplatedPatch templates the patch and converts it to JSON
+func (r PatchResourceRule) ToTemplatedPatch(args templating.Args) ([]byte, error) {
+	templatedPatch, err := templating.Execute("PatchResourceRule", r.Patch, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.parsePatch(templatedPatch)
+}
+
+// parsePatch converts a YAML or JSON patch to JSON, and asserts that it has the correct structure for the patch type
+func (r PatchResourceRule) parsePatch(patch string) ([]byte, error) {
+	jsonPatch, err := k8syaml.ToJSON([]byte(patch))
+	if err != nil {
+		return nil, err
+	}
+
+	if r.GetType() == PatchTypeJSON {
+		var operations []map[string]interface{}
+		if err := k8sjson.Unmarshal(jsonPatch, &operations); err != nil {
+			return nil, fmt.Errorf("A JSON patch must be a list of operations: %s", err.Error())
+		}
+		for pos, operation := range operations {
+			if _, exists := operation["op"]; !exists {
+				return nil, fmt.Errorf("JSON patch operation %d is missing the `op` field", pos)
+			}
+			if _, exists := operation["path"]; !exists {
+				return nil, fmt.Errorf("JSON patch operation %d is missing the `path` field", pos)
+			}
+		}
+	} else {
+		var object map[string]interface{}
+		if err := k8sjson.Unmarshal(jsonPatch, &object); err != nil {
+			return nil, fmt.Errorf("A %s patch must be an object: %s", r.GetType(), err.Error())
+		}
+	}
+
+	return jsonPatch, nil
+}
+
+// ToPreflightChecks returns the verbs that a PatchResourceRule needs
+func (r PatchResourceRule) ToPreflightChecks() []kubernetes.PreflightCheck {
+	checks := toNamespaceSelectorPreflightChecks(r.NamespaceSelector)
+	return append(checks, toPreflightCheck(r.APIVersion, r.Kind, r.Namespace, r.NamespaceSelector, "list", "patch"))
+}
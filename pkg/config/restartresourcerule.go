@@ -0,0 +1,122 @@
+package config
+
+import (
+	"encoding/json"
+	newerrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/templating"
+)
+
+const (
+	// RestartedAtAnnotation is the pod template annotation that kubectl rollout restart sets
+	RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+	// RestartServiceHookIDAnnotation is the pod template annotation that records the Service Hook that triggered a restart
+	RestartServiceHookIDAnnotation = "azd-kubernetes-manager/service-hook-id"
+	// RestartBuildNumberAnnotation is the pod template annotation that records the build number that triggered a restart
+	RestartBuildNumberAnnotation = "azd-kubernetes-manager/build-number"
+)
+
+// RestartResourceRule lists workloads to restart, like kubectl rollout restart
+type RestartResourceRule struct {
+	// The Kubernetes API version of the resource(s) to restart. Defaults to apps/v1.
+	APIVersion string `yaml:"apiVersion"`
+
+	// The resource kind. Must be Deployment, StatefulSet or DaemonSet.
+	Kind string `yaml:"kind"`
+
+	// The resource namespace
+	Namespace string `yaml:"namespace,omitempty"`
+
+	// The resource name. If defined, the label selector is ignored.
+	Name string `yaml:"name,omitempty"`
+
+	// The label selector
+	Selector LabelSelector `yaml:"selector"`
+
+	// The options shared by every rule
+	RuleOptions `yaml:",inline"`
+}
+
+///
+/// Describe()
+///
+
+// Describe returns a user-friendly representation of a RestartResourceRule
+func (r RestartResourceRule) Describe() string {
+	return fmt.Sprintf(
+		"API Version: %s\nKinds: %s\nNamespace: %s\nName: %s\nLabel Selector:\n  %s",
+		r.GetAPIVersion(), r.Kind, r.Namespace, r.Name, strings.ReplaceAll(r.Selector.Describe(), "\n", "\n  "),
+	) + "\n" + r.RuleOptions.Describe()
+}
+
+///
+/// Validate
+///
+
+// Validate a Restart Kubernetes Resource rule definition. This function returns a slice of warnings and an error.
+func (r RestartResourceRule) Validate() ([]string, error) {
+	warnings, errors := validateResourceTarget("Restart", r.GetAPIVersion(), r.Kind, r.Namespace, r.Name, r.Selector)
+
+	optionsWarnings, optionsErr := r.RuleOptions.Validate()
+	warnings = append(warnings, optionsWarnings...)
+	if optionsErr != nil {
+		errors = append(errors, optionsErr.Error())
+	}
+
+	switch r.Kind {
+	case "", "Deployment", "StatefulSet", "DaemonSet":
+	default:
+		errors = append(errors, fmt.Sprintf("Invalid `Kind` \"%s\". Only Deployments, StatefulSets and DaemonSets can be restarted.", r.Kind))
+	}
+
+	var err error
+	if len(errors) > 0 {
+		err = newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return warnings, err
+}
+
+///
+/// Mappings
+///
+
+// GetAPIVersion returns the API version, defaulting to apps/v1
+func (r RestartResourceRule) GetAPIVersion() string {
+	if r.APIVersion == "" {
+		return "apps/v1"
+	}
+	return r.APIVersion
+}
+
+// ToPatch creates the JSON merge patch that restarts the pods, and records the Service Hook that triggered the restart
+func (r RestartResourceRule) ToPatch(args templating.Args, restartedAt time.Time) ([]byte, error) {
+	annotations := map[string]interface{}{
+		RestartedAtAnnotation:          restartedAt.Format(time.RFC3339),
+		RestartServiceHookIDAnnotation: args.ServiceHook.ID,
+		// Removes the build number of a previous restart, so that it isn't mistaken for the build that triggered this one
+		RestartBuildNumberAnnotation: nil,
+	}
+	if args.BuildNumber != nil && *args.BuildNumber != "" {
+		annotations[RestartBuildNumberAnnotation] = *args.BuildNumber
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": annotations,
+				},
+			},
+		},
+	})
+}
+
+// ToPreflightChecks returns the verbs that a RestartResourceRule needs
+func (r RestartResourceRule) ToPreflightChecks() []kubernetes.PreflightCheck {
+	return []kubernetes.PreflightCheck{toPreflightCheck(r.GetAPIVersion(), r.Kind, r.Namespace, nil, "list", "patch")}
+}
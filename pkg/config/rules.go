@@ -3,13 +3,17 @@ package config
 import (
 	newerrors "errors"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
 	"github.com/ogmaresca/azd-kubernetes-manager/pkg/templating"
-	"gopkg.in/yaml.v2"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 // Rules lists all of the rules to perform upon an event
@@ -19,27 +23,132 @@ type Rules struct {
 
 	// The resources to delete
 	Delete []DeleteResourceRule `yaml:"delete"`
+
+	// The resources to patch
+	Patch []PatchResourceRule `yaml:"patch"`
+
+	// The resources to scale
+	Scale []ScaleResourceRule `yaml:"scale"`
+
+	// The workloads to restart
+	Restart []RestartResourceRule `yaml:"restart"`
+
+	// The resources to label and annotate
+	Label []LabelResourceRule `yaml:"label"`
+
+	// The resources to copy to another namespace
+	Copy []CopyResourceRule `yaml:"copy"`
+
+	// The Jobs to run and wait for
+	Job []JobRule `yaml:"job"`
+
+	// The resources to wait for
+	Wait []WaitRule `yaml:"wait"`
+
+	// The stages to run after the rules above, in order
+	Stages []RuleStage `yaml:"stages"`
+}
+
+// ApplyResourceRule lists resources to create. It can also be defined as a plain YAML string, without options.
+type ApplyResourceRule struct {
+	// The resources to create, as a templated multi-document YAML
+	Resources Manifest `yaml:"resources"`
+
+	// The options shared by every rule
+	RuleOptions `yaml:",inline"`
 }
 
-// ApplyResourceRule lists a resource to create
-type ApplyResourceRule string
+// Manifest is a templated multi-document YAML stream of Kubernetes resources
+type Manifest string
 
 // DeleteResourceRule lists a resource to delete
 type DeleteResourceRule struct {
-	// The Kubernetes API version of the resource(s) to delete
+	// The Kubernetes API version of the resource(s) to delete. Must be empty when sweeping.
 	APIVersion string `yaml:"apiVersion"`
 
-	// The resource kind
+	// The resource kind. Must be empty when sweeping.
 	Kind string `yaml:"kind"`
 
+	// If defined, delete the matching resources of every kind that can be listed and deleted, instead of a single kind
+	Sweep *DeleteSweep `yaml:"sweep"`
+
 	// The resource namespace
 	Namespace string `yaml:"namespace,omitempty"`
 
+	// Selects the namespaces of the resources. Can't be combined with the namespace.
+	NamespaceSelector *LabelSelector `yaml:"namespaceSelector"`
+
+	// The resource name. If defined, only the resource with this name is deleted.
+	Name string `yaml:"name,omitempty"`
+
 	// The label selector
 	Selector LabelSelector `yaml:"selector"`
 
-	// The maximum resources to delete. If the number of returned resources is < limit, then fail
+	// The field selector, such as "status.phase=Succeeded"
+	FieldSelector string `yaml:"fieldSelector,omitempty"`
+
+	// The maximum resources to delete. If more resources than the limit would be deleted, then fail without deleting anything
 	Limit *int `yaml:"limit"`
+
+	// The resources to keep instead of deleting
+	Retain *DeleteRetentionPolicy `yaml:"retain"`
+
+	// How dependents are deleted: Foreground, Background, or Orphan. If empty, the default of the resource is used.
+	PropagationPolicy string `yaml:"propagationPolicy,omitempty"`
+
+	// The number of seconds before the resources are deleted. If empty, the default of the resource is used.
+	GracePeriodSeconds *int64 `yaml:"gracePeriodSeconds"`
+
+	// Only delete resources that match these preconditions
+	Preconditions *DeletePreconditions `yaml:"preconditions"`
+
+	// If true, wait until the deleted resources and their finalizers are gone
+	Wait bool `yaml:"wait"`
+
+	// How long to wait for the resources to be gone. Defaults to 5 minutes.
+	WaitTimeout time.Duration `yaml:"waitTimeout"`
+
+	// How often to check if the resources are gone. Defaults to 5 seconds.
+	PollInterval time.Duration `yaml:"pollInterval"`
+
+	// The options shared by every rule
+	RuleOptions `yaml:",inline"`
+}
+
+// DeletePreconditions must be fulfilled before a resource is deleted
+type DeletePreconditions struct {
+	// The UID of the resource
+	UID string `yaml:"uid,omitempty"`
+
+	// The resource version of the resource
+	ResourceVersion string `yaml:"resourceVersion,omitempty"`
+}
+
+// DeleteSweep selects the kinds of resources deleted by a DeleteResourceRule that sweeps every kind
+type DeleteSweep struct {
+	// The API groups to sweep. Use "" for the core API group. If empty, every API group is swept.
+	Groups []string `yaml:"groups"`
+
+	// If defined, only sweep namespaced (true) or cluster-scoped (false) kinds
+	Namespaced *bool `yaml:"namespaced"`
+
+	// The kinds to sweep, as "Kind" or "Kind.group". If empty, every kind is swept.
+	IncludeKinds []string `yaml:"includeKinds"`
+
+	// The kinds to never sweep, as "Kind" or "Kind.group"
+	ExcludeKinds []string `yaml:"excludeKinds"`
+}
+
+// DeleteRetentionPolicy keeps the newest resources matched by a DeleteResourceRule
+type DeleteRetentionPolicy struct {
+	// The number of resources to keep
+	Count int `yaml:"count"`
+
+	// The label to sort resources by. Numeric label values are compared as numbers. If empty, the creation timestamp is used.
+	Label string `yaml:"label"`
+
+	// Labels to group resources by. The count is kept for each group.
+	GroupBy []string `yaml:"groupBy"`
 }
 
 ///
@@ -51,7 +160,7 @@ func (r Rules) Describe() string {
 	description := "Resource apply rules:"
 
 	var applyRuleDescriptions []string
-	for _, applyRule := range r.Delete {
+	for _, applyRule := range r.Apply {
 		applyRuleDescriptions = append(applyRuleDescriptions, applyRule.Describe())
 	}
 	description += joinYAMLSlice(applyRuleDescriptions)
@@ -64,33 +173,147 @@ func (r Rules) Describe() string {
 	}
 	description += joinYAMLSlice(deletionRuleDescriptions)
 
+	description += "\nResource patch rules:"
+
+	var patchRuleDescriptions []string
+	for _, patchRule := range r.Patch {
+		patchRuleDescriptions = append(patchRuleDescriptions, patchRule.Describe())
+	}
+	description += joinYAMLSlice(patchRuleDescriptions)
+
+	description += "\nResource scale rules:"
+
+	var scaleRuleDescriptions []string
+	for _, scaleRule := range r.Scale {
+		scaleRuleDescriptions = append(scaleRuleDescriptions, scaleRule.Describe())
+	}
+	description += joinYAMLSlice(scaleRuleDescriptions)
+
+	description += "\nResource restart rules:"
+
+	var restartRuleDescriptions []string
+	for _, restartRule := range r.Restart {
+		restartRuleDescriptions = append(restartRuleDescriptions, restartRule.Describe())
+	}
+	description += joinYAMLSlice(restartRuleDescriptions)
+
+	description += "\nResource label rules:"
+
+	var labelRuleDescriptions []string
+	for _, labelRule := range r.Label {
+		labelRuleDescriptions = append(labelRuleDescriptions, labelRule.Describe())
+	}
+	description += joinYAMLSlice(labelRuleDescriptions)
+
+	description += "\nResource copy rules:"
+
+	var copyRuleDescriptions []string
+	for _, copyRule := range r.Copy {
+		copyRuleDescriptions = append(copyRuleDescriptions, copyRule.Describe())
+	}
+	description += joinYAMLSlice(copyRuleDescriptions)
+
+	description += "\nJob rules:"
+
+	var jobRuleDescriptions []string
+	for _, jobRule := range r.Job {
+		jobRuleDescriptions = append(jobRuleDescriptions, jobRule.Describe())
+	}
+	description += joinYAMLSlice(jobRuleDescriptions)
+
+	description += "\nWait rules:"
+
+	var waitRuleDescriptions []string
+	for _, waitRule := range r.Wait {
+		waitRuleDescriptions = append(waitRuleDescriptions, waitRule.Describe())
+	}
+	description += joinYAMLSlice(waitRuleDescriptions)
+
+	description += "\nStages:"
+
+	var stageDescriptions []string
+	for _, stage := range r.Stages {
+		stageDescriptions = append(stageDescriptions, stage.Describe())
+	}
+	description += joinYAMLSlice(stageDescriptions)
+
 	return description
 }
 
 // Describe returns a user-friendly representation of a ApplyResourceRule
 func (r ApplyResourceRule) Describe() string {
-	resource, err := r.Parse()
+	return r.Resources.Describe() + "\n" + r.RuleOptions.Describe()
+}
+
+// Describe returns a user-friendly representation of a Manifest
+func (m Manifest) Describe() string {
+	resources, err := m.Parse()
 	if err != nil {
 		return fmt.Sprintf("Error parsing Kubernetes resource: %s", err.Error())
 	}
 
-	name := resource.Metadata.Name
-	if name == "" {
-		name = resource.Metadata.GenerateName
+	if len(resources) == 1 {
+		return resources[0].Describe()
 	}
 
-	return fmt.Sprintf(
-		"%s %s/%s",
-		resource.APIVersion, resource.Kind, name,
-	)
+	var resourceDescriptions []string
+	for _, resource := range resources {
+		resourceDescriptions = append(resourceDescriptions, resource.Describe())
+	}
+	return fmt.Sprintf("Resources:%s", joinYAMLSlice(resourceDescriptions))
 }
 
 // Describe returns a user-friendly representation of a DeleteResourceRule
 func (r DeleteResourceRule) Describe() string {
+	limit := "None"
+	if r.Limit != nil {
+		limit = fmt.Sprintf("%d", *r.Limit)
+	}
+
+	retain := "None"
+	if r.Retain != nil {
+		retain = strings.ReplaceAll(r.Retain.Describe(), "\n", "\n  ")
+	}
+
+	gracePeriodSeconds := "Default"
+	if r.GracePeriodSeconds != nil {
+		gracePeriodSeconds = fmt.Sprintf("%d", *r.GracePeriodSeconds)
+	}
+
+	sweep := "None"
+	if r.Sweep != nil {
+		sweep = strings.ReplaceAll(r.Sweep.Describe(), "\n", "\n  ")
+	}
+
+	preconditions := "None"
+	if r.Preconditions != nil {
+		preconditions = fmt.Sprintf("UID %s, Resource Version %s", r.Preconditions.UID, r.Preconditions.ResourceVersion)
+	}
+
 	return fmt.Sprintf(
-		"API Version: %s\nKinds: %s\nLimit: %d\nLabel Selector:\n  %s",
-		r.APIVersion, r.Kind, r.Limit, strings.ReplaceAll(r.Selector.Describe(), "\n", "\n  "),
-	)
+		"API Version: %s\nKinds: %s\nSweep: %s\nNamespace: %s\nNamespace Selector:\n  %s\nName: %s\nField Selector: %s\nLimit: %s\nRetain: %s\nPropagation Policy: %s\nGrace Period Seconds: %s\nPreconditions: %s\nWait: %t\nWait Timeout: %s\nPoll Interval: %s\nLabel Selector:\n  %s",
+		r.APIVersion, r.Kind, sweep, r.Namespace, describeNamespaceSelector(r.NamespaceSelector), r.Name, r.FieldSelector, limit, retain, r.PropagationPolicy, gracePeriodSeconds, preconditions, r.Wait, r.GetWaitTimeout(), r.GetPollInterval(), strings.ReplaceAll(r.Selector.Describe(), "\n", "\n  "),
+	) + "\n" + r.RuleOptions.Describe()
+}
+
+// Describe returns a user-friendly representation of a DeleteSweep
+func (s DeleteSweep) Describe() string {
+	namespaced := "Any"
+	if s.Namespaced != nil {
+		namespaced = fmt.Sprintf("%t", *s.Namespaced)
+	}
+
+	return fmt.Sprintf("\nGroups: %v\nNamespaced: %s\nInclude Kinds: %v\nExclude Kinds: %v", s.Groups, namespaced, s.IncludeKinds, s.ExcludeKinds)
+}
+
+// Describe returns a user-friendly representation of a DeleteRetentionPolicy
+func (p DeleteRetentionPolicy) Describe() string {
+	sortBy := "creationTimestamp"
+	if p.Label != "" {
+		sortBy = fmt.Sprintf("label %s", p.Label)
+	}
+
+	return fmt.Sprintf("\nCount: %d\nSort By: %s\nGroup By: %v", p.Count, sortBy, p.GroupBy)
 }
 
 ///
@@ -127,6 +350,98 @@ func (r Rules) Validate() ([]string, error) {
 		errors = append(errors, deleteErr.Error())
 	}
 
+	var patchFileSections []FileSection
+	for _, value := range r.Patch {
+		patchFileSections = append(patchFileSections, value)
+	}
+
+	patchWarnings, patchErr := validate(patchFileSections, "Patch Resource rule definition")
+	warnings = append(warnings, patchWarnings...)
+	if patchErr != nil {
+		errors = append(errors, patchErr.Error())
+	}
+
+	var scaleFileSections []FileSection
+	for _, value := range r.Scale {
+		scaleFileSections = append(scaleFileSections, value)
+	}
+
+	scaleWarnings, scaleErr := validate(scaleFileSections, "Scale Resource rule definition")
+	warnings = append(warnings, scaleWarnings...)
+	if scaleErr != nil {
+		errors = append(errors, scaleErr.Error())
+	}
+
+	var restartFileSections []FileSection
+	for _, value := range r.Restart {
+		restartFileSections = append(restartFileSections, value)
+	}
+
+	restartWarnings, restartErr := validate(restartFileSections, "Restart Resource rule definition")
+	warnings = append(warnings, restartWarnings...)
+	if restartErr != nil {
+		errors = append(errors, restartErr.Error())
+	}
+
+	var labelFileSections []FileSection
+	for _, value := range r.Label {
+		labelFileSections = append(labelFileSections, value)
+	}
+
+	labelWarnings, labelErr := validate(labelFileSections, "Label Resource rule definition")
+	warnings = append(warnings, labelWarnings...)
+	if labelErr != nil {
+		errors = append(errors, labelErr.Error())
+	}
+
+	var copyFileSections []FileSection
+	for _, value := range r.Copy {
+		copyFileSections = append(copyFileSections, value)
+	}
+
+	copyWarnings, copyErr := validate(copyFileSections, "Copy Resource rule definition")
+	warnings = append(warnings, copyWarnings...)
+	if copyErr != nil {
+		errors = append(errors, copyErr.Error())
+	}
+
+	var jobFileSections []FileSection
+	for _, value := range r.Job {
+		jobFileSections = append(jobFileSections, value)
+	}
+
+	jobWarnings, jobErr := validate(jobFileSections, "Job rule definition")
+	warnings = append(warnings, jobWarnings...)
+	if jobErr != nil {
+		errors = append(errors, jobErr.Error())
+	}
+
+	var waitFileSections []FileSection
+	for _, value := range r.Wait {
+		waitFileSections = append(waitFileSections, value)
+	}
+
+	waitWarnings, waitErr := validate(waitFileSections, "Wait rule definition")
+	warnings = append(warnings, waitWarnings...)
+	if waitErr != nil {
+		errors = append(errors, waitErr.Error())
+	}
+
+	var stageFileSections []FileSection
+	for _, value := range r.Stages {
+		stageFileSections = append(stageFileSections, value)
+	}
+
+	stageWarnings, stageErr := validate(stageFileSections, "Stage definition")
+	warnings = append(warnings, stageWarnings...)
+	if stageErr != nil {
+		errors = append(errors, stageErr.Error())
+	}
+
+	if _, err := r.GetStageDependencies(); err != nil {
+		errors = append(errors, err.Error())
+	}
+
 	var err error
 	if len(errors) > 0 {
 		err = newerrors.New(strings.Join(errors, "\n"))
@@ -135,28 +450,47 @@ func (r Rules) Validate() ([]string, error) {
 	return warnings, err
 }
 
-// Validate a Delete Kubernetes Resouce rule definition. This function returns a slice of warnings and an error.
+// Validate an Apply Kubernetes Resouce rule definition. This function returns a slice of warnings and an error.
 func (r ApplyResourceRule) Validate() ([]string, error) {
-	if string(r) == "" {
-		return []string{}, newerrors.New("Apply rule must not be empty.")
+	warnings, err := r.RuleOptions.Validate()
+	if err != nil {
+		return warnings, err
 	}
 
-	strVal := r.String()
+	if r.Resources == "" {
+		return warnings, newerrors.New("Apply rule must not be empty.")
+	}
+
+	strVal := r.Resources.String()
 	templatedValue, err := templating.Execute("ConfigFileValidation", strVal, sampleTemplatingArgs)
 	if err != nil {
-		return []string{}, fmt.Errorf("Apply rule error: %s", err.Error())
+		return warnings, fmt.Errorf("Apply rule error: %s", err.Error())
 	} else if logger.LogDebug() && templatedValue != strVal {
 		logger.Debugf("Converted Apply rule template:\n  %s\nto:\n  %s", strings.ReplaceAll(strVal, "\n", "\n  "), strings.ReplaceAll(templatedValue, "\n", "\n  "))
 	}
 
-	templatedRule := ApplyResourceRule(templatedValue)
-
-	_, err = templatedRule.Parse()
+	resources, err := Manifest(templatedValue).Parse()
 	if err != nil {
-		return []string{}, fmt.Errorf("Error parsing Apply rule after templating: %s", err.Error())
+		return warnings, fmt.Errorf("Error parsing Apply rule after templating: %s", err.Error())
+	}
+
+	if err := ValidateKubernetesResources(resources); err != nil {
+		return warnings, err
 	}
 
-	return []string{}, nil
+	// Namespaced resources without a namespace would be created in the default namespace, which is protected by default.
+	// Kinds that aren't built in are only known to be namespaced through discovery, so the preflight checks them.
+	var errors []string
+	for pos, resource := range resources {
+		if resource.Metadata.Namespace == "" && resource.IsNamespaced() {
+			errors = append(errors, fmt.Sprintf("Document %d:\n  %s %s is namespaced, so `metadata.namespace` must be defined.", pos, resource.APIVersion, resource.Kind))
+		}
+	}
+	if len(errors) > 0 {
+		return warnings, newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return warnings, nil
 }
 
 // Validate a Delete Kubernetes Resouce rule definition. This function returns a slice of warnings and an error.
@@ -164,17 +498,37 @@ func (r DeleteResourceRule) Validate() ([]string, error) {
 	var errors []string
 	var warnings []string
 
-	if r.APIVersion == "" {
-		errors = append(errors, "The Kubernetes API Version `APIVersion` must be defined. Use \"v1\" for the core API.")
+	optionsWarnings, optionsErr := r.RuleOptions.Validate()
+	warnings = append(warnings, optionsWarnings...)
+	if optionsErr != nil {
+		errors = append(errors, optionsErr.Error())
+	}
+
+	if r.Sweep != nil {
+		if r.APIVersion != "" || r.Kind != "" {
+			errors = append(errors, "A sweeping delete rule cannot define an `APIVersion` or `Kind`. Use the sweep `IncludeKinds` instead.")
+		}
+		if r.Selector.IsEmpty() {
+			errors = append(errors, "A sweeping delete rule must define a label `Selector`.")
+		}
+		sweepWarnings, err := r.Sweep.Validate()
+		warnings = append(warnings, sweepWarnings...)
+		if err != nil {
+			errors = append(errors, err.Error())
+		}
 	} else {
-		split := strings.Split(r.APIVersion, "/")
-		if len(split) != 1 && len(split) != 2 {
-			errors = append(errors, fmt.Sprintf("Invalid API Version '%s'", r.APIVersion))
+		if r.APIVersion == "" {
+			errors = append(errors, "The Kubernetes API Version `APIVersion` must be defined. Use \"v1\" for the core API.")
+		} else {
+			split := strings.Split(r.APIVersion, "/")
+			if len(split) != 1 && len(split) != 2 {
+				errors = append(errors, fmt.Sprintf("Invalid API Version '%s'", r.APIVersion))
+			}
 		}
-	}
 
-	if r.Kind == "" {
-		errors = append(errors, "The Kubernetes resource `Kind` must be defined.")
+		if r.Kind == "" {
+			errors = append(errors, "The Kubernetes resource `Kind` must be defined.")
+		}
 	}
 
 	if r.Namespace != "" {
@@ -186,18 +540,106 @@ func (r DeleteResourceRule) Validate() ([]string, error) {
 		}
 	}
 
-	selectorWarnings, err := r.Selector.Validate()
-	if len(selectorWarnings) > 0 {
-		warnings = append(warnings, selectorWarnings...)
+	namespaceSelectorWarnings, namespaceSelectorErrors := validateNamespaceSelector("Delete", r.Namespace, r.NamespaceSelector)
+	warnings = append(warnings, namespaceSelectorWarnings...)
+	errors = append(errors, namespaceSelectorErrors...)
+
+	if r.Name != "" {
+		if err := validateTemplate("Delete rule name", r.Name); err != nil {
+			errors = append(errors, err.Error())
+		}
 	}
-	if err != nil {
-		errors = append(errors, err.Error())
+
+	if r.FieldSelector != "" {
+		templatedFieldSelector, err := templating.Execute("ConfigFileValidation", r.FieldSelector, sampleTemplatingArgs)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Delete rule field selector templating error: %s", err.Error()))
+		} else if _, err := fields.ParseSelector(templatedFieldSelector); err != nil {
+			errors = append(errors, fmt.Sprintf("Invalid delete rule `FieldSelector` '%s': %s", r.FieldSelector, err.Error()))
+		}
+	}
+
+	// A label selector is only required if the resources aren't selected by name or field
+	if !r.Selector.IsEmpty() || (r.Name == "" && r.FieldSelector == "") {
+		selectorWarnings, err := r.Selector.Validate()
+		if len(selectorWarnings) > 0 {
+			warnings = append(warnings, selectorWarnings...)
+		}
+		if err != nil {
+			errors = append(errors, err.Error())
+		}
 	}
 
 	if r.Limit != nil && *r.Limit <= 0 {
 		errors = append(errors, "If a `Limit` is defined, it must be greater than 0.")
 	}
 
+	if r.Retain != nil {
+		retainWarnings, err := r.Retain.Validate()
+		if len(retainWarnings) > 0 {
+			warnings = append(warnings, retainWarnings...)
+		}
+		if err != nil {
+			errors = append(errors, err.Error())
+		}
+	}
+
+	switch metav1.DeletionPropagation(r.PropagationPolicy) {
+	case "", metav1.DeletePropagationForeground, metav1.DeletePropagationBackground, metav1.DeletePropagationOrphan:
+	default:
+		errors = append(errors, fmt.Sprintf("Invalid `PropagationPolicy` '%s'. Valid values are: %s, %s, %s", r.PropagationPolicy, metav1.DeletePropagationForeground, metav1.DeletePropagationBackground, metav1.DeletePropagationOrphan))
+	}
+
+	if r.GracePeriodSeconds != nil && *r.GracePeriodSeconds < 0 {
+		errors = append(errors, "If `GracePeriodSeconds` is defined, it must not be negative.")
+	}
+
+	if r.Preconditions != nil && r.Preconditions.UID == "" && r.Preconditions.ResourceVersion == "" {
+		warnings = append(warnings, "The delete `Preconditions` don't define a UID or resource version.")
+	}
+
+	if r.WaitTimeout < 0 {
+		errors = append(errors, "The `WaitTimeout` must not be negative.")
+	}
+
+	if r.PollInterval < 0 {
+		errors = append(errors, "The `PollInterval` must not be negative.")
+	}
+
+	if !r.Wait && (r.WaitTimeout != 0 || r.PollInterval != 0) {
+		warnings = append(warnings, "A `WaitTimeout` or `PollInterval` is defined, but `Wait` is false.")
+	}
+
+	var err error
+	if len(errors) > 0 {
+		err = newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return warnings, err
+}
+
+// Validate a Delete Resource sweep. This function returns a slice of warnings and an error.
+func (s DeleteSweep) Validate() ([]string, error) {
+	var errors []string
+	var warnings []string
+
+	for pos, kind := range s.IncludeKinds {
+		if kind == "" {
+			errors = append(errors, fmt.Sprintf("The sweep `IncludeKinds` kind %d must not be empty.", pos))
+		}
+	}
+
+	for pos, kind := range s.ExcludeKinds {
+		if kind == "" {
+			errors = append(errors, fmt.Sprintf("The sweep `ExcludeKinds` kind %d must not be empty.", pos))
+		}
+	}
+
+	if len(s.Groups) == 0 && len(s.IncludeKinds) == 0 {
+		warnings = append(warnings, "The delete rule sweeps every kind in every API group. Consider restricting it with `Groups` or `IncludeKinds`.")
+	}
+
+	var err error
 	if len(errors) > 0 {
 		err = newerrors.New(strings.Join(errors, "\n"))
 	}
@@ -205,13 +647,125 @@ func (r DeleteResourceRule) Validate() ([]string, error) {
 	return warnings, err
 }
 
+// Validate a Delete Resource retention policy. This function returns a slice of warnings and an error.
+func (p DeleteRetentionPolicy) Validate() ([]string, error) {
+	var errors []string
+
+	if p.Count <= 0 {
+		errors = append(errors, "The retention `Count` must be greater than 0.")
+	}
+
+	for pos, label := range p.GroupBy {
+		if label == "" {
+			errors = append(errors, fmt.Sprintf("The retention `GroupBy` label %d must not be empty.", pos))
+		}
+	}
+
+	var err error
+	if len(errors) > 0 {
+		err = newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return []string{}, err
+}
+
 //
 // Mappings
 //
 
 // IsEmpty returns true if the Rules has doesn't contain any rules
 func (r Rules) IsEmpty() bool {
-	return len(r.Apply) == 0 && len(r.Delete) == 0
+	return len(r.Apply) == 0 && len(r.Delete) == 0 && len(r.Patch) == 0 && len(r.Scale) == 0 && len(r.Restart) == 0 && len(r.Label) == 0 && len(r.Copy) == 0 && len(r.Job) == 0 && len(r.Wait) == 0 && len(r.Stages) == 0
+}
+
+// HasDeleteRules returns true if any delete rules are defined, including in stages
+func (r Rules) HasDeleteRules() bool {
+	if len(r.Delete) > 0 {
+		return true
+	}
+	for _, stage := range r.Stages {
+		if stage.HasDeleteRules() {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDefinedKinds returns the kinds defined by the CustomResourceDefinitions that the apply rules and stages apply.
+// Apply rules whose resources can't be parsed are skipped, since validation reports them.
+func (r Rules) GetDefinedKinds() map[schema.GroupKind]bool {
+	kinds := make(map[schema.GroupKind]bool)
+	for _, rule := range r.Apply {
+		resources, _, err := parseTemplatedResources(rule.String())
+		if err != nil {
+			continue
+		}
+		for _, resource := range resources {
+			if kind, ok := resource.DefinedKind(); ok {
+				kinds[kind] = true
+			}
+		}
+	}
+	for _, stage := range r.Stages {
+		for kind := range stage.Rules.GetDefinedKinds() {
+			kinds[kind] = true
+		}
+	}
+	return kinds
+}
+
+// GetClusters returns the sorted names of the clusters that the rules and stages target. The default cluster isn't included.
+func (r Rules) GetClusters() []string {
+	var options []RuleOptions
+	for _, rule := range r.Apply {
+		options = append(options, rule.RuleOptions)
+	}
+	for _, rule := range r.Delete {
+		options = append(options, rule.RuleOptions)
+	}
+	for _, rule := range r.Patch {
+		options = append(options, rule.RuleOptions)
+	}
+	for _, rule := range r.Scale {
+		options = append(options, rule.RuleOptions)
+	}
+	for _, rule := range r.Restart {
+		options = append(options, rule.RuleOptions)
+	}
+	for _, rule := range r.Label {
+		options = append(options, rule.RuleOptions)
+	}
+	for _, rule := range r.Copy {
+		options = append(options, rule.RuleOptions)
+	}
+	for _, rule := range r.Job {
+		options = append(options, rule.RuleOptions)
+	}
+	for _, rule := range r.Wait {
+		options = append(options, rule.RuleOptions)
+	}
+
+	clusters := make(map[string]bool)
+	for _, option := range options {
+		if option.Cluster != "" {
+			clusters[option.Cluster] = true
+		}
+	}
+	for _, stage := range r.Stages {
+		if stage.Cluster != "" {
+			clusters[stage.Cluster] = true
+		}
+		for _, cluster := range stage.Rules.GetClusters() {
+			clusters[cluster] = true
+		}
+	}
+
+	var names []string
+	for cluster := range clusters {
+		names = append(names, cluster)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // ToTypeMeta maps a DeleteResourceRule to a Kubernetes meta/v1 TypeMeta
@@ -219,6 +773,92 @@ func (r DeleteResourceRule) ToTypeMeta() metav1.TypeMeta {
 	return metav1.TypeMeta{Kind: r.Kind, APIVersion: r.APIVersion}
 }
 
+// ToDeleteOptions maps a DeleteResourceRule to the options of a Kubernetes client delete
+func (r DeleteResourceRule) ToDeleteOptions() kubernetes.DeleteOptions {
+	var retain *kubernetes.RetentionPolicy
+	if r.Retain != nil {
+		retain = &kubernetes.RetentionPolicy{
+			Count:   r.Retain.Count,
+			Label:   r.Retain.Label,
+			GroupBy: r.Retain.GroupBy,
+		}
+	}
+
+	var propagationPolicy *metav1.DeletionPropagation
+	if r.PropagationPolicy != "" {
+		policy := metav1.DeletionPropagation(r.PropagationPolicy)
+		propagationPolicy = &policy
+	}
+
+	var preconditions *metav1.Preconditions
+	if r.Preconditions != nil {
+		preconditions = &metav1.Preconditions{}
+		if r.Preconditions.UID != "" {
+			uid := types.UID(r.Preconditions.UID)
+			preconditions.UID = &uid
+		}
+		if r.Preconditions.ResourceVersion != "" {
+			resourceVersion := r.Preconditions.ResourceVersion
+			preconditions.ResourceVersion = &resourceVersion
+		}
+	}
+
+	return kubernetes.DeleteOptions{
+		Limit:              r.Limit,
+		Retain:             retain,
+		FieldSelector:      r.FieldSelector,
+		PropagationPolicy:  propagationPolicy,
+		GracePeriodSeconds: r.GracePeriodSeconds,
+		Preconditions:      preconditions,
+		Wait:               r.Wait,
+		WaitTimeout:        r.GetWaitTimeout(),
+		PollInterval:       r.GetPollInterval(),
+	}
+}
+
+// ToSweepOptions maps a DeleteResourceRule's sweep to the options of a Kubernetes client sweep
+func (r DeleteResourceRule) ToSweepOptions() kubernetes.SweepOptions {
+	if r.Sweep == nil {
+		return kubernetes.SweepOptions{}
+	}
+
+	return kubernetes.SweepOptions{
+		Groups:       r.Sweep.Groups,
+		Namespaced:   r.Sweep.Namespaced,
+		IncludeKinds: r.Sweep.IncludeKinds,
+		ExcludeKinds: r.Sweep.ExcludeKinds,
+	}
+}
+
+// ToTemplatedDeleteOptions templates the field selector, and then maps a DeleteResourceRule to the options of a Kubernetes client delete
+func (r DeleteResourceRule) ToTemplatedDeleteOptions(args templating.Args) (kubernetes.DeleteOptions, error) {
+	options := r.ToDeleteOptions()
+
+	templatedFieldSelector, err := templating.Execute("FieldSelector", r.FieldSelector, args)
+	if err != nil {
+		return kubernetes.DeleteOptions{}, fmt.Errorf("Field selector templating error: %s", err.Error())
+	}
+	options.FieldSelector = templatedFieldSelector
+
+	return options, nil
+}
+
+// GetWaitTimeout returns how long to wait for the deleted resources to be gone, defaulting to 5 minutes
+func (r DeleteResourceRule) GetWaitTimeout() time.Duration {
+	if r.WaitTimeout == 0 {
+		return defaultWaitTimeout
+	}
+	return r.WaitTimeout
+}
+
+// GetPollInterval returns how often to check if the deleted resources are gone, defaulting to 5 seconds
+func (r DeleteResourceRule) GetPollInterval() time.Duration {
+	if r.PollInterval == 0 {
+		return defaultWaitPollInterval
+	}
+	return r.PollInterval
+}
+
 // ToGroupVersion maps a DeleteResourceRule to a GroupVersion
 func (r DeleteResourceRule) ToGroupVersion() schema.GroupVersion {
 	split := strings.Split(r.APIVersion, "/")
@@ -229,30 +869,83 @@ func (r DeleteResourceRule) ToGroupVersion() schema.GroupVersion {
 	}
 }
 
-// String returns the rule as a string
+// UnmarshalYAML parses an ApplyResourceRule from either a plain YAML string, or an object with resources and rule options
+func (r *ApplyResourceRule) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var resources string
+	if err := unmarshal(&resources); err == nil {
+		*r = ApplyResourceRule{Resources: Manifest(resources)}
+		return nil
+	}
+
+	// The alias type doesn't have this method, so that the object form is unmarshalled field by field
+	type applyResourceRule ApplyResourceRule
+	var rule applyResourceRule
+	if err := unmarshal(&rule); err != nil {
+		return err
+	}
+	*r = ApplyResourceRule(rule)
+	return nil
+}
+
+// String returns the rule's resources as a string
 func (r ApplyResourceRule) String() string {
-	return string(r)
+	return r.Resources.String()
 }
 
-// Parse parses the rule as a YAML object
-func (r ApplyResourceRule) Parse() (KubernetesResource, error) {
-	resource := KubernetesResource{}
+// Parse parses the rule's resources as a multi-document YAML stream
+func (r ApplyResourceRule) Parse() ([]KubernetesResource, error) {
+	return r.Resources.Parse()
+}
 
-	err := yaml.Unmarshal([]byte(r.String()), &resource)
+// ParseTemplated templates the rule's resources and then parses them as a multi-document YAML stream
+func (r ApplyResourceRule) ParseTemplated(args templating.Args) ([]KubernetesResource, error) {
+	templatedRule, err := templating.Execute("ApplyResourceRule", r.String(), args)
+	if err != nil {
+		return []KubernetesResource{}, err
+	}
 
-	return resource, err
+	return NewKubernetesResources(templatedRule)
 }
 
-// ParseTemplated templates the rule and then parses it as a YAML object
-func (r ApplyResourceRule) ParseTemplated(args templating.Args) (KubernetesResource, error) {
-	templatedRule, err := templating.Execute("ApplyResourceRule", r.String(), args)
+// String returns the manifest as a string
+func (m Manifest) String() string {
+	return string(m)
+}
+
+// Parse parses the manifest as a multi-document YAML stream
+func (m Manifest) Parse() ([]KubernetesResource, error) {
+	return NewKubernetesResources(m.String())
+}
+
+// ToPreflightChecks returns the verbs that an ApplyResourceRule needs on the kinds it applies
+func (r ApplyResourceRule) ToPreflightChecks() ([]kubernetes.PreflightCheck, error) {
+	resources, namespaceTemplated, err := parseTemplatedResources(r.String())
 	if err != nil {
-		return KubernetesResource{}, err
+		return nil, err
 	}
 
-	resource := KubernetesResource{}
+	var checks []kubernetes.PreflightCheck
+	for i, resource := range resources {
+		check := toPreflightCheck(resource.APIVersion, resource.Kind, resource.Metadata.Namespace, nil, "get", "create", "patch")
+		if namespaceTemplated[i] {
+			check.Namespace, check.NamespaceTemplated = "", true
+		}
+		check.RequiresNamespace = true
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
 
-	err = yaml.Unmarshal([]byte(templatedRule), &resource)
+// ToPreflightChecks returns the verbs that a DeleteResourceRule needs. The kinds of sweeps are only known when the rule runs.
+func (r DeleteResourceRule) ToPreflightChecks() []kubernetes.PreflightCheck {
+	checks := toNamespaceSelectorPreflightChecks(r.NamespaceSelector)
+	if r.Sweep != nil {
+		return checks
+	}
 
-	return resource, err
+	verbs := []string{"list", "delete"}
+	if r.Wait {
+		verbs = append(verbs, "get")
+	}
+	return append(checks, toPreflightCheck(r.APIVersion, r.Kind, r.Namespace, r.NamespaceSelector, verbs...))
 }
@@ -0,0 +1,457 @@
+package config_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/azuredevops"
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/config"
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/templating"
+)
+
+func TestApplyResourceRuleParse(t *testing.T) {
+	rule := config.ApplyResourceRule{Resources: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: pr-{{ .PullRequestID }}
+  namespace: pr-{{ .PullRequestID }}
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: app
+        image: registry.example.com/app:pr-{{ .PullRequestID }}
+        unknownField: true
+`}
+
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{
+		EventType: "git.pullrequest.created",
+		Resource: azuredevops.ServiceHookResource{
+			ServiceHookResourcePullRequest: azuredevops.ServiceHookResourcePullRequest{
+				PullRequestID: intPtr(12),
+			},
+		},
+	})
+
+	t.Run("test_parse_templated_preserves_body", func(t *testing.T) {
+		resources, err := rule.ParseTemplated(args)
+		if err != nil {
+			t.Fatalf("Expected apply rule to parse: %s", err.Error())
+		}
+		if len(resources) != 1 {
+			t.Fatalf("Expected 1 resource but received %d", len(resources))
+		}
+		resource := resources[0]
+
+		if err := resource.Validate(); err != nil {
+			t.Errorf("Expected apply rule to be valid: %s", err.Error())
+		}
+
+		if resource.Metadata.Name != "pr-12" || resource.Metadata.Namespace != "pr-12" {
+			t.Errorf("Expected typed metadata to be templated, but received %+v", resource.Metadata)
+		}
+
+		object := resource.ToUnstructured()
+
+		replicas, found, err := unstructured.NestedInt64(object.Object, "spec", "replicas")
+		if !found || err != nil || replicas != 2 {
+			t.Errorf("Expected spec.replicas to be 2, but received %d (found: %t, error: %v)", replicas, found, err)
+		}
+
+		containers, found, err := unstructured.NestedSlice(object.Object, "spec", "template", "spec", "containers")
+		if !found || err != nil || len(containers) != 1 {
+			t.Fatalf("Expected 1 container, but received %v (found: %t, error: %v)", containers, found, err)
+		}
+
+		container := containers[0].(map[string]interface{})
+		if container["image"] != "registry.example.com/app:pr-12" {
+			t.Errorf("Expected the container image to be templated, but received %v", container["image"])
+		}
+		if container["unknownField"] != true {
+			t.Errorf("Expected unknown fields to be preserved, but received %v", container)
+		}
+	})
+
+	t.Run("test_parse_invalid_metadata", func(t *testing.T) {
+		resources, err := config.ApplyResourceRule{Resources: "apiVersion: v1\nkind: ConfigMap\ndata:\n  key: value\n"}.Parse()
+		if err != nil {
+			t.Fatalf("Expected apply rule to parse: %s", err.Error())
+		}
+
+		if err := config.ValidateKubernetesResources(resources); err == nil {
+			t.Errorf("Expected apply rule without a name to be invalid")
+		}
+	})
+}
+
+func TestApplyResourceRuleParseMultiDocument(t *testing.T) {
+	rule := config.ApplyResourceRule{Resources: `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: pr-1
+---
+# A comment-only document is skipped
+---
+apiVersion: v1
+kind: ResourceQuota
+metadata:
+  name: quota
+  namespace: pr-1
+spec:
+  hard:
+    pods: "10"
+---
+`}
+
+	resources, err := rule.Parse()
+	if err != nil {
+		t.Fatalf("Expected apply rule to parse: %s", err.Error())
+	}
+
+	if len(resources) != 2 {
+		t.Fatalf("Expected 2 resources but received %d", len(resources))
+	}
+
+	if resources[0].Kind != "Namespace" || resources[1].Kind != "ResourceQuota" {
+		t.Errorf("Expected a Namespace and a ResourceQuota, but received %s and %s", resources[0].Kind, resources[1].Kind)
+	}
+
+	if err := config.ValidateKubernetesResources(resources); err != nil {
+		t.Errorf("Expected apply rule to be valid: %s", err.Error())
+	}
+}
+
+func TestPatchResourceRuleValidate(t *testing.T) {
+	t.Run("test_validate_patch_good", func(t *testing.T) {
+		rule := config.PatchResourceRule{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Namespace:  "build-{{ .BuildID }}",
+			Name:       "app",
+			Type:       config.PatchTypeJSON,
+			Patch:      `[{"op": "replace", "path": "/metadata/annotations/azdBuildNumber", "value": "{{ .BuildNumber }}"}]`,
+		}
+
+		if _, err := rule.Validate(); err != nil {
+			t.Errorf("Expected patch rule to be valid: %s", err.Error())
+		}
+	})
+
+	t.Run("test_validate_patch_bad", func(t *testing.T) {
+		rule := config.PatchResourceRule{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Type:       "invalid",
+			Patch:      "metadata: {}",
+		}
+
+		if _, err := rule.Validate(); err == nil {
+			t.Errorf("Expected patch rule with an invalid type and no selector to be invalid")
+		}
+	})
+
+	t.Run("test_validate_patch_name_and_bad_selector", func(t *testing.T) {
+		rule := config.PatchResourceRule{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Name:       "app",
+			Selector:   config.LabelSelector{MatchLabels: map[string]string{"app": ""}},
+			Type:       config.PatchTypeMerge,
+			Patch:      "metadata: {}",
+		}
+
+		if _, err := rule.Validate(); err == nil || !strings.Contains(err.Error(), "empty values are not allowed") {
+			t.Errorf("Expected patch rule with a name and an invalid selector to be invalid, but received %v", err)
+		}
+	})
+}
+
+func TestDeleteResourceRuleValidate(t *testing.T) {
+	gracePeriodSeconds := int64(0)
+
+	t.Run("test_validate_delete_good", func(t *testing.T) {
+		rule := config.DeleteResourceRule{
+			APIVersion:         "v1",
+			Kind:               "Namespace",
+			Selector:           config.LabelSelector{MatchLabels: map[string]string{"pr": "{{ .PullRequestID }}"}},
+			PropagationPolicy:  "Foreground",
+			GracePeriodSeconds: &gracePeriodSeconds,
+			Preconditions:      &config.DeletePreconditions{UID: "1234"},
+			Wait:               true,
+		}
+
+		if _, err := rule.Validate(); err != nil {
+			t.Errorf("Expected delete rule to be valid: %s", err.Error())
+		}
+
+		options := rule.ToDeleteOptions()
+		if options.PropagationPolicy == nil || *options.PropagationPolicy != "Foreground" {
+			t.Errorf("Expected the Foreground propagation policy, but received %v", options.PropagationPolicy)
+		}
+		if options.Preconditions == nil || options.Preconditions.UID == nil || *options.Preconditions.UID != "1234" || options.Preconditions.ResourceVersion != nil {
+			t.Errorf("Expected a UID precondition only, but received %v", options.Preconditions)
+		}
+		if !options.Wait || options.WaitTimeout == 0 || options.PollInterval == 0 {
+			t.Errorf("Expected to wait with the default timeout and poll interval, but received %v", options)
+		}
+	})
+
+	t.Run("test_validate_delete_name", func(t *testing.T) {
+		rule := config.DeleteResourceRule{
+			APIVersion:    "v1",
+			Kind:          "Namespace",
+			Name:          "pr-{{ .PullRequestID }}",
+			FieldSelector: "status.phase=Active",
+		}
+
+		if _, err := rule.Validate(); err != nil {
+			t.Errorf("Expected delete rule with a name and no label selector to be valid: %s", err.Error())
+		}
+	})
+
+	t.Run("test_validate_delete_no_target", func(t *testing.T) {
+		rule := config.DeleteResourceRule{APIVersion: "v1", Kind: "Namespace"}
+
+		if _, err := rule.Validate(); err == nil {
+			t.Errorf("Expected delete rule without a name, label selector or field selector to be invalid")
+		}
+	})
+
+	t.Run("test_validate_delete_bad_field_selector", func(t *testing.T) {
+		rule := config.DeleteResourceRule{APIVersion: "v1", Kind: "Pod", FieldSelector: "status.phase"}
+
+		if _, err := rule.Validate(); err == nil {
+			t.Errorf("Expected delete rule with an invalid field selector to be invalid")
+		}
+	})
+
+	t.Run("test_validate_delete_namespace_selector", func(t *testing.T) {
+		rule := config.DeleteResourceRule{
+			APIVersion:        "networking.k8s.io/v1beta1",
+			Kind:              "Ingress",
+			Namespace:         "team-a",
+			NamespaceSelector: &config.LabelSelector{MatchLabels: map[string]string{"azdPullRequestId": "{{ .PullRequestID }}"}},
+			Name:              "pr-{{ .PullRequestID }}",
+		}
+
+		if _, err := rule.Validate(); err == nil {
+			t.Errorf("Expected delete rule with both a namespace and a namespace selector to be invalid")
+		}
+
+		rule.Namespace = ""
+		if _, err := rule.Validate(); err != nil {
+			t.Errorf("Expected delete rule with a namespace selector to be valid: %s", err.Error())
+		}
+	})
+
+	t.Run("test_validate_delete_sweep", func(t *testing.T) {
+		rule := config.DeleteResourceRule{
+			Sweep:    &config.DeleteSweep{ExcludeKinds: []string{"Namespace"}},
+			Selector: config.LabelSelector{MatchLabels: map[string]string{"azdPullRequestId": "{{ .PullRequestID }}"}},
+		}
+
+		warnings, err := rule.Validate()
+		if err != nil {
+			t.Errorf("Expected sweeping delete rule to be valid: %s", err.Error())
+		}
+		if len(warnings) == 0 {
+			t.Errorf("Expected a warning for a sweep without groups or included kinds")
+		}
+
+		rule.Kind = "Namespace"
+		rule.Selector = config.LabelSelector{}
+		if _, err := rule.Validate(); err == nil {
+			t.Errorf("Expected sweeping delete rule with a kind and no label selector to be invalid")
+		}
+	})
+
+	t.Run("test_validate_delete_bad", func(t *testing.T) {
+		negative := int64(-1)
+		rule := config.DeleteResourceRule{
+			APIVersion:         "v1",
+			Kind:               "Namespace",
+			PropagationPolicy:  "Cascade",
+			GracePeriodSeconds: &negative,
+		}
+
+		if _, err := rule.Validate(); err == nil {
+			t.Errorf("Expected delete rule with an invalid propagation policy and grace period to be invalid")
+		}
+	})
+}
+
+func TestJobRuleParse(t *testing.T) {
+	configFile, err := config.NewConfigFile([]byte(`
+serviceHooks:
+- event: build.complete
+  rules:
+    job:
+    - timeout: 3m
+      logLines: 50
+      job: |
+        apiVersion: batch/v1
+        kind: Job
+        metadata:
+          generateName: smoke-test-{{ .BuildID }}-
+          namespace: dev
+        spec:
+          template:
+            spec:
+              restartPolicy: Never
+              containers:
+              - name: smoke-test
+                image: registry.example.com/smoke-test:latest
+`))
+	if err != nil {
+		t.Fatalf("Expected config file to parse: %s", err.Error())
+	}
+
+	if _, err := configFile.Validate(); err != nil {
+		t.Errorf("Expected config file to be valid: %s", err.Error())
+	}
+
+	options := configFile.ServiceHooks[0].Rules.Job[0].ToJobOptions()
+	if options.Timeout.Minutes() != 3 || options.LogLines != 50 || options.PollInterval.Seconds() != 5 {
+		t.Errorf("Unexpected job options %+v", options)
+	}
+
+	rule := config.JobRule{Job: "apiVersion: batch/v1\nkind: Job\nmetadata:\n  generateName: smoke-test-\n"}
+	if _, err := rule.Validate(); err == nil || !strings.Contains(err.Error(), "must define the namespace of the Job") {
+		t.Errorf("Expected a Job without a namespace to be invalid, but received %v", err)
+	}
+
+	rule = config.JobRule{Job: "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: smoke-test\n  namespace: dev\n"}
+	if _, err := rule.Validate(); err == nil || !strings.Contains(err.Error(), "instead of a metadata.name") {
+		t.Errorf("Expected a Job with a fixed name to be invalid, but received %v", err)
+	}
+}
+
+func TestGetStageDependencies(t *testing.T) {
+	tests := []struct {
+		name         string
+		stages       []config.RuleStage
+		dependencies string
+		valid        bool
+	}{
+		{"sequential", []config.RuleStage{{Name: "a"}, {Name: "b"}, {Name: "c"}}, "[[] [0] [1]]", true},
+		{"depends_on", []config.RuleStage{{Name: "a"}, {Name: "b", DependsOn: []string{"a"}}, {Name: "c", DependsOn: []string{"a"}}, {Name: "d", DependsOn: []string{"b", "c"}}}, "[[] [0] [0] [1 2]]", true},
+		{"unknown", []config.RuleStage{{Name: "a", DependsOn: []string{"b"}}}, "", false},
+		{"duplicate", []config.RuleStage{{Name: "a"}, {Name: "a"}}, "", false},
+		{"self", []config.RuleStage{{Name: "a", DependsOn: []string{"a"}}}, "", false},
+		{"cycle", []config.RuleStage{{Name: "a", DependsOn: []string{"c"}}, {Name: "b", DependsOn: []string{"a"}}, {Name: "c", DependsOn: []string{"b"}}}, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dependencies, err := config.Rules{Stages: test.stages}.GetStageDependencies()
+			if !test.valid {
+				if err == nil {
+					t.Errorf("Expected an error, but received dependencies %v", dependencies)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Expected no error, but received: %s", err.Error())
+			}
+			if fmt.Sprintf("%v", dependencies) != test.dependencies {
+				t.Errorf("Expected dependencies %s but received %v", test.dependencies, dependencies)
+			}
+		})
+	}
+}
+
+func TestRuleOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		when     string
+		warnings int
+		valid    bool
+	}{
+		{"empty", "", 0, true},
+		{"boolean", `{{ eq .EventType "build.complete" }}`, 0, true},
+		{"not_boolean", "{{ .EventType }}", 1, true},
+		{"no_templating", "true", 0, false},
+		{"invalid_templating", "{{ .EventType ", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warnings, err := config.RuleOptions{When: test.when}.Validate()
+			if test.valid && err != nil {
+				t.Errorf("Expected no error, but received: %s", err.Error())
+			} else if !test.valid && err == nil {
+				t.Error("Expected an error")
+			}
+			if len(warnings) != test.warnings {
+				t.Errorf("Expected %d warnings but received %v", test.warnings, warnings)
+			}
+		})
+	}
+}
+
+func TestImpersonationValidate(t *testing.T) {
+	if _, err := (config.RuleOptions{Impersonate: &config.Impersonation{User: "system:serviceaccount:team-a:deployer"}}).Validate(); err != nil {
+		t.Errorf("Expected no error, but received: %s", err.Error())
+	}
+	if _, err := (config.RuleOptions{Impersonate: &config.Impersonation{Groups: []string{"team-a"}}}).Validate(); err == nil {
+		t.Error("Expected an error when impersonating groups without a user")
+	}
+}
+
+func TestApplyResourceRulePreflightChecks(t *testing.T) {
+	rule := config.ApplyResourceRule{Resources: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: pr-{{ .PullRequestID }}
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: credentials
+`}
+
+	checks, err := rule.ToPreflightChecks()
+	if err != nil {
+		t.Fatalf("Expected preflight checks: %s", err.Error())
+	}
+	if len(checks) != 2 {
+		t.Fatalf("Expected 2 preflight checks, but received %d", len(checks))
+	}
+	if checks[0].Kind != "ConfigMap" || !checks[0].NamespaceTemplated || checks[0].Namespace != "" {
+		t.Errorf("Expected the ConfigMap's namespace to be templated, but received %v", checks[0])
+	}
+	if checks[1].Kind != "Secret" || checks[1].NamespaceTemplated || checks[1].Namespace != "" || !checks[1].RequiresNamespace {
+		t.Errorf("Expected the Secret to be checked for a missing namespace, but received %v", checks[1])
+	}
+}
+
+func TestApplyResourceRuleValidateNamespace(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources string
+		valid     bool
+	}{
+		{"namespaced", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  namespace: pr-{{ .PullRequestID }}\n", true},
+		{"namespaced_without_namespace", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n", false},
+		{"cluster_scoped", "apiVersion: rbac.authorization.k8s.io/v1\nkind: ClusterRole\nmetadata:\n  name: preview\n", true},
+		{"custom_resource", "apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: widget\n", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := config.ApplyResourceRule{Resources: config.Manifest(test.resources)}.Validate()
+			if test.valid && err != nil {
+				t.Errorf("Expected the rule to be valid, but received: %s", err.Error())
+			} else if !test.valid && (err == nil || !strings.Contains(err.Error(), "`metadata.namespace` must be defined")) {
+				t.Errorf("Expected a missing namespace error, but received: %v", err)
+			}
+		})
+	}
+}
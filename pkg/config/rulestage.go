@@ -0,0 +1,301 @@
+package config
+
+import (
+	newerrors "errors"
+	"fmt"
+	"strings"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/templating"
+)
+
+// FailurePolicy defines what happens when a rule fails
+type FailurePolicy string
+
+const (
+	// FailurePolicyContinue reports the error, but still runs the stages that depend on the failed rule's stage
+	FailurePolicyContinue FailurePolicy = "continue"
+	// FailurePolicyAbortStage reports the error and skips the stages that depend on the failed rule's stage
+	FailurePolicyAbortStage FailurePolicy = "abortStage"
+	// FailurePolicyAbortAll reports the error and doesn't start any more stages
+	FailurePolicyAbortAll FailurePolicy = "abortAll"
+)
+
+// RuleOptions lists the options shared by every rule
+type RuleOptions struct {
+	// A Go template that must return true or false. If false, the rule is skipped.
+	When string `yaml:"when,omitempty"`
+
+	// What happens when the rule fails. Defaults to the failure policy of the stage.
+	OnFailure FailurePolicy `yaml:"onFailure,omitempty"`
+
+	// If true, the changes are sent to Kubernetes with server-side dry run, so that nothing is persisted
+	DryRun bool `yaml:"dryRun"`
+
+	// The name of the cluster to target, from the `clusters` of the config file. Defaults to the cluster of the stage.
+	Cluster string `yaml:"cluster,omitempty"`
+
+	// The identity to send requests as. Defaults to the impersonation of the Service Hook.
+	Impersonate *Impersonation `yaml:"impersonate"`
+}
+
+// Impersonation is a Kubernetes user and groups to send requests as, so that their RBAC decides what the rules may do
+type Impersonation struct {
+	// The user to impersonate, such as "system:serviceaccount:team-a:deployer"
+	User string `yaml:"user"`
+
+	// The groups to impersonate
+	Groups []string `yaml:"groups"`
+}
+
+// RuleStage is a named group of rules. The rules in a stage run in parallel.
+type RuleStage struct {
+	// The stage name
+	Name string `yaml:"name"`
+
+	// The stages to wait for. If empty, the stage waits for the previous stage.
+	DependsOn []string `yaml:"dependsOn"`
+
+	// A Go template that must return true or false. If false, the stage is skipped, and the stages that depend on it still run.
+	When string `yaml:"when,omitempty"`
+
+	// What happens when a rule in this stage fails, unless the rule defines its own policy. Defaults to abortStage.
+	OnFailure FailurePolicy `yaml:"onFailure,omitempty"`
+
+	// If true, every rule in the stage is executed in dry run mode
+	DryRun bool `yaml:"dryRun"`
+
+	// The name of the cluster that the rules in the stage target, unless a rule defines its own cluster.
+	// Defaults to the cluster that azd-kubernetes-manager runs in.
+	Cluster string `yaml:"cluster,omitempty"`
+
+	// The rules to run
+	Rules `yaml:",inline"`
+}
+
+///
+/// Describe()
+///
+
+// Describe returns a user-friendly representation of a RuleOptions
+func (o RuleOptions) Describe() string {
+	return fmt.Sprintf("When: %s\nOn Failure: %s\nDry Run: %t\nCluster: %s\nImpersonate: %s", o.When, o.OnFailure, o.DryRun, o.Cluster, o.Impersonate.Describe())
+}
+
+// Describe returns a user-friendly representation of an Impersonation
+func (i *Impersonation) Describe() string {
+	if i == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s %v", i.User, i.Groups)
+}
+
+// Describe returns a user-friendly representation of a RuleStage
+func (s RuleStage) Describe() string {
+	return fmt.Sprintf(
+		"Name: %s\nDepends On: %v\nWhen: %s\nOn Failure: %s\nDry Run: %t\nCluster: %s\nRules:\n  %s",
+		s.Name, s.DependsOn, s.When, s.GetOnFailure(), s.DryRun, s.Cluster, strings.ReplaceAll(s.Rules.Describe(), "\n", "\n  "),
+	)
+}
+
+///
+/// Validate
+///
+
+// Validate a FailurePolicy. An empty policy is valid.
+func (p FailurePolicy) Validate() error {
+	switch p {
+	case "", FailurePolicyContinue, FailurePolicyAbortStage, FailurePolicyAbortAll:
+		return nil
+	default:
+		return fmt.Errorf("Invalid failure policy '%s'. Valid values are: %s, %s, %s", p, FailurePolicyContinue, FailurePolicyAbortStage, FailurePolicyAbortAll)
+	}
+}
+
+// Validate a RuleOptions. This function returns a slice of warnings and an error.
+func (o RuleOptions) Validate() ([]string, error) {
+	var errors []string
+	var warnings []string
+
+	whenWarnings, whenErr := validateWhen("rule", o.When)
+	warnings = append(warnings, whenWarnings...)
+	if whenErr != nil {
+		errors = append(errors, whenErr.Error())
+	}
+
+	if err := o.OnFailure.Validate(); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if err := o.Impersonate.Validate(); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	var err error
+	if len(errors) > 0 {
+		err = newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return warnings, err
+}
+
+// Validate an Impersonation. An undefined impersonation is valid.
+func (i *Impersonation) Validate() error {
+	if i != nil && i.User == "" {
+		return newerrors.New("The `Impersonate` user must be defined.")
+	}
+	return nil
+}
+
+// Validate a Rule Stage definition. This function returns a slice of warnings and an error.
+func (s RuleStage) Validate() ([]string, error) {
+	var errors []string
+	var warnings []string
+
+	whenWarnings, whenErr := validateWhen(fmt.Sprintf("stage '%s'", s.Name), s.When)
+	warnings = append(warnings, whenWarnings...)
+	if whenErr != nil {
+		errors = append(errors, whenErr.Error())
+	}
+
+	if err := s.OnFailure.Validate(); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if len(s.Stages) > 0 {
+		errors = append(errors, "Stages cannot be nested.")
+	}
+
+	if s.Rules.IsEmpty() {
+		warnings = append(warnings, fmt.Sprintf("Stage '%s' has no rules.", s.Name))
+	} else {
+		rulesWarnings, rulesErr := s.Rules.Validate()
+		warnings = append(warnings, rulesWarnings...)
+		if rulesErr != nil {
+			errors = append(errors, rulesErr.Error())
+		}
+	}
+
+	var err error
+	if len(errors) > 0 {
+		err = newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return warnings, err
+}
+
+///
+/// Mappings
+///
+
+// Matches returns true if the rule should run
+func (o RuleOptions) Matches(args templating.Args) (bool, error) {
+	return evaluateWhen(o.When, args)
+}
+
+// Matches returns true if the stage should run
+func (s RuleStage) Matches(args templating.Args) (bool, error) {
+	return evaluateWhen(s.When, args)
+}
+
+// GetOnFailure returns the failure policy, defaulting to the given policy
+func (o RuleOptions) GetOnFailure(defaultPolicy FailurePolicy) FailurePolicy {
+	if o.OnFailure == "" {
+		return defaultPolicy
+	}
+	return o.OnFailure
+}
+
+// GetOnFailure returns the failure policy of the stage, defaulting to abortStage
+func (s RuleStage) GetOnFailure() FailurePolicy {
+	if s.OnFailure == "" {
+		return FailurePolicyAbortStage
+	}
+	return s.OnFailure
+}
+
+// Max returns the most severe of two failure policies
+func (p FailurePolicy) Max(other FailurePolicy) FailurePolicy {
+	if p.severity() >= other.severity() {
+		return p
+	}
+	return other
+}
+
+// severity orders the failure policies from least to most severe
+func (p FailurePolicy) severity() int {
+	switch p {
+	case FailurePolicyContinue:
+		return 1
+	case FailurePolicyAbortStage:
+		return 2
+	case FailurePolicyAbortAll:
+		return 3
+	default:
+		return 0
+	}
+}
+
+// GetStageDependencies returns the indexes of the stages that each stage waits for. Stages without dependsOn wait for the previous stage.
+func (r Rules) GetStageDependencies() ([][]int, error) {
+	indexes := make(map[string]int)
+	for i, stage := range r.Stages {
+		if stage.Name == "" {
+			continue
+		}
+		if _, exists := indexes[stage.Name]; exists {
+			return nil, fmt.Errorf("Stage name '%s' is defined more than once", stage.Name)
+		}
+		indexes[stage.Name] = i
+	}
+
+	dependencies := make([][]int, len(r.Stages))
+	for i, stage := range r.Stages {
+		if len(stage.DependsOn) == 0 {
+			if i > 0 {
+				dependencies[i] = []int{i - 1}
+			}
+			continue
+		}
+
+		for _, name := range stage.DependsOn {
+			index, exists := indexes[name]
+			if !exists {
+				return nil, fmt.Errorf("Stage '%s' depends on stage '%s', which doesn't exist", stage.Name, name)
+			} else if index == i {
+				return nil, fmt.Errorf("Stage '%s' depends on itself", stage.Name)
+			}
+			dependencies[i] = append(dependencies[i], index)
+		}
+	}
+
+	// Detect cycles by repeatedly removing the stages whose dependencies have all been removed
+	done := make([]bool, len(r.Stages))
+	for remaining := len(r.Stages); remaining > 0; {
+		progress := false
+		for i := range r.Stages {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for _, dependency := range dependencies[i] {
+				ready = ready && done[dependency]
+			}
+			if ready {
+				done[i] = true
+				remaining--
+				progress = true
+			}
+		}
+		if !progress {
+			var names []string
+			for i, stage := range r.Stages {
+				if !done[i] {
+					names = append(names, stage.Name)
+				}
+			}
+			return nil, fmt.Errorf("Stages %v have circular dependencies", names)
+		}
+	}
+
+	return dependencies, nil
+}
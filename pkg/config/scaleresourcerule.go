@@ -0,0 +1,119 @@
+package config
+
+import (
+	newerrors "errors"
+	"fmt"
+	"strings"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
+)
+
+// ScaleResourceRule lists resources to scale with the scale subresource
+type ScaleResourceRule struct {
+	// The Kubernetes API version of the resource(s) to scale
+	APIVersion string `yaml:"apiVersion"`
+
+	// The resource kind
+	Kind string `yaml:"kind"`
+
+	// The resource namespace
+	Namespace string `yaml:"namespace,omitempty"`
+
+	// The resource name. If defined, the label selector is ignored.
+	Name string `yaml:"name,omitempty"`
+
+	// The label selector
+	Selector LabelSelector `yaml:"selector"`
+
+	// The number of replicas to scale to. If Restore is true, this is used when no previous replica count was recorded.
+	Replicas *int32 `yaml:"replicas"`
+
+	// If defined, the replica count before scaling is recorded in this annotation
+	PreviousReplicasAnnotation string `yaml:"previousReplicasAnnotation"`
+
+	// If true, scale to the replica count recorded in PreviousReplicasAnnotation
+	Restore bool `yaml:"restore"`
+
+	// The options shared by every rule
+	RuleOptions `yaml:",inline"`
+}
+
+///
+/// Describe()
+///
+
+// Describe returns a user-friendly representation of a ScaleResourceRule
+func (r ScaleResourceRule) Describe() string {
+	replicas := "None"
+	if r.Replicas != nil {
+		replicas = fmt.Sprintf("%d", *r.Replicas)
+	}
+
+	return fmt.Sprintf(
+		"API Version: %s\nKinds: %s\nNamespace: %s\nName: %s\nLabel Selector:\n  %s\nReplicas: %s\nPrevious Replicas Annotation: %s\nRestore: %t",
+		r.APIVersion, r.Kind, r.Namespace, r.Name, strings.ReplaceAll(r.Selector.Describe(), "\n", "\n  "), replicas, r.PreviousReplicasAnnotation, r.Restore,
+	) + "\n" + r.RuleOptions.Describe()
+}
+
+///
+/// Validate
+///
+
+// Validate a Scale Kubernetes Resource rule definition. This function returns a slice of warnings and an error.
+func (r ScaleResourceRule) Validate() ([]string, error) {
+	warnings, errors := validateResourceTarget("Scale", r.APIVersion, r.Kind, r.Namespace, r.Name, r.Selector)
+
+	optionsWarnings, optionsErr := r.RuleOptions.Validate()
+	warnings = append(warnings, optionsWarnings...)
+	if optionsErr != nil {
+		errors = append(errors, optionsErr.Error())
+	}
+
+	if r.Replicas != nil && *r.Replicas < 0 {
+		errors = append(errors, "The `Replicas` must not be negative.")
+	}
+
+	if r.Restore {
+		if r.PreviousReplicasAnnotation == "" {
+			errors = append(errors, "The `PreviousReplicasAnnotation` must be defined to restore the previous replica count.")
+		}
+		if r.Replicas == nil {
+			warnings = append(warnings, "No `Replicas` were defined, so resources without a previous replica count recorded will fail to scale.")
+		}
+	} else if r.Replicas == nil {
+		errors = append(errors, "The `Replicas` must be defined.")
+	}
+
+	var err error
+	if len(errors) > 0 {
+		err = newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return warnings, err
+}
+
+///
+/// Mappings
+///
+
+// ToScaleOptions maps a ScaleResourceRule to the options of a Kubernetes client scale
+func (r ScaleResourceRule) ToScaleOptions() kubernetes.ScaleOptions {
+	return kubernetes.ScaleOptions{
+		Replicas:                   r.Replicas,
+		PreviousReplicasAnnotation: r.PreviousReplicasAnnotation,
+		Restore:                    r.Restore,
+	}
+}
+
+// ToPreflightChecks returns the verbs that a ScaleResourceRule needs on the resources and their scale subresource
+func (r ScaleResourceRule) ToPreflightChecks() []kubernetes.PreflightCheck {
+	verbs := []string{"list", "get"}
+	if r.PreviousReplicasAnnotation != "" {
+		verbs = append(verbs, "patch")
+	}
+
+	scale := toPreflightCheck(r.APIVersion, r.Kind, r.Namespace, nil, "get", "update")
+	scale.Subresource = "scale"
+
+	return []kubernetes.PreflightCheck{toPreflightCheck(r.APIVersion, r.Kind, r.Namespace, nil, verbs...), scale}
+}
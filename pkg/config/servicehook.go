@@ -30,6 +30,12 @@ type ServiceHook struct {
 	// If Continue is true, process any other service hooks that match the Service Hook
 	Continue bool `yaml:"continue"`
 
+	// If Transactional is true and any rule fails, the resources created by the rules are deleted and the resources changed by the rules are restored
+	Transactional bool `yaml:"transactional"`
+
+	// The identity that the rules send requests as, unless a rule defines its own. If undefined, the rules use the identity of azd-kubernetes-manager.
+	Impersonate *Impersonation `yaml:"impersonate"`
+
 	// The rules to perform on the Service Hook
 	Rules Rules `yaml:"rules"`
 }
@@ -74,8 +80,8 @@ type ServiceHookResourceFilters struct {
 // Describe returns a user-friendly representation of a ServiceHook
 func (sh ServiceHook) Describe() string {
 	return fmt.Sprintf(
-		"Event Type: %s\nResource Filters:\n  %s\nContinue: %t\nRules:\n  %s",
-		sh.Event, strings.ReplaceAll(sh.ResourceFilters.Describe(), "\n", "\n  "), sh.Continue, strings.ReplaceAll(sh.Rules.Describe(), "\n", "\n  "),
+		"Event Type: %s\nResource Filters:\n  %s\nContinue: %t\nTransactional: %t\nImpersonate: %s\nRules:\n  %s",
+		sh.Event, strings.ReplaceAll(sh.ResourceFilters.Describe(), "\n", "\n  "), sh.Continue, sh.Transactional, sh.Impersonate.Describe(), strings.ReplaceAll(sh.Rules.Describe(), "\n", "\n  "),
 	)
 }
 
@@ -128,6 +134,10 @@ func (sh ServiceHook) Validate() ([]string, error) {
 		errors = append(errors, err.Error())
 	}
 
+	if err := sh.Impersonate.Validate(); err != nil {
+		errors = append(errors, err.Error())
+	}
+
 	rulesWarnings, err := sh.Rules.Validate()
 	if len(rulesWarnings) > 0 {
 		warnings = append(warnings, rulesWarnings...)
@@ -136,11 +146,15 @@ func (sh ServiceHook) Validate() ([]string, error) {
 		errors = append(errors, err.Error())
 	}
 
+	if sh.Transactional && sh.Rules.HasDeleteRules() {
+		warnings = append(warnings, "Delete rules cannot be rolled back, so resources deleted before a rule fails will not be restored.")
+	}
+
 	if len(errors) > 0 {
 		err = newerrors.New(joinYAMLSlice(errors))
 	}
 
-	return rulesWarnings, err
+	return warnings, err
 }
 
 // Validate a Service Hook filters definition. This function returns a slice of warnings and an error.
@@ -0,0 +1,176 @@
+package config
+
+import (
+	newerrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/templating"
+)
+
+const (
+	defaultWaitTimeout      = 5 * time.Minute
+	defaultWaitPollInterval = 5 * time.Second
+)
+
+// WaitRule lists resources to wait for until they meet a condition
+type WaitRule struct {
+	// The Kubernetes API version of the resource(s) to wait for
+	APIVersion string `yaml:"apiVersion"`
+
+	// The resource kind
+	Kind string `yaml:"kind"`
+
+	// The resource namespace
+	Namespace string `yaml:"namespace,omitempty"`
+
+	// The resource name. If defined, the label selector is ignored.
+	Name string `yaml:"name,omitempty"`
+
+	// The label selector
+	Selector LabelSelector `yaml:"selector"`
+
+	// Wait until the resources have a status condition of this type, such as Available or Ready
+	Condition string `yaml:"condition,omitempty"`
+
+	// The status of the condition. Defaults to True.
+	Status string `yaml:"status,omitempty"`
+
+	// Wait until the resources no longer exist
+	Deleted bool `yaml:"deleted"`
+
+	// Wait until this JSONPath expression returns Value on every resource
+	JSONPath string `yaml:"jsonPath,omitempty"`
+
+	// The value that the JSONPath expression must return
+	Value string `yaml:"value,omitempty"`
+
+	// How long to wait. Defaults to 5 minutes.
+	Timeout time.Duration `yaml:"timeout"`
+
+	// How often to check the resources. Defaults to 5 seconds.
+	PollInterval time.Duration `yaml:"pollInterval"`
+
+	// The options shared by every rule
+	RuleOptions `yaml:",inline"`
+}
+
+///
+/// Describe()
+///
+
+// Describe returns a user-friendly representation of a WaitRule
+func (r WaitRule) Describe() string {
+	return fmt.Sprintf(
+		"API Version: %s\nKinds: %s\nNamespace: %s\nName: %s\nLabel Selector:\n  %s\nCondition: %s\nStatus: %s\nDeleted: %t\nJSONPath: %s\nValue: %s\nTimeout: %s\nPoll Interval: %s",
+		r.APIVersion, r.Kind, r.Namespace, r.Name, strings.ReplaceAll(r.Selector.Describe(), "\n", "\n  "), r.Condition, r.Status, r.Deleted, r.JSONPath, r.Value, r.GetTimeout(), r.GetPollInterval(),
+	) + "\n" + r.RuleOptions.Describe()
+}
+
+///
+/// Validate
+///
+
+// Validate a Wait rule definition. This function returns a slice of warnings and an error.
+func (r WaitRule) Validate() ([]string, error) {
+	warnings, errors := validateResourceTarget("Wait", r.APIVersion, r.Kind, r.Namespace, r.Name, r.Selector)
+
+	optionsWarnings, optionsErr := r.RuleOptions.Validate()
+	warnings = append(warnings, optionsWarnings...)
+	if optionsErr != nil {
+		errors = append(errors, optionsErr.Error())
+	}
+
+	conditions := 0
+	if r.Condition != "" {
+		conditions++
+	}
+	if r.Deleted {
+		conditions++
+	}
+	if r.JSONPath != "" {
+		conditions++
+	}
+
+	if conditions == 0 {
+		errors = append(errors, "One of `Condition`, `Deleted` or `JSONPath` must be defined.")
+	} else if r.Deleted && conditions > 1 {
+		errors = append(errors, "`Deleted` cannot be combined with `Condition` or `JSONPath`.")
+	}
+
+	if r.Status != "" && r.Condition == "" {
+		warnings = append(warnings, "The `Status` is ignored because no `Condition` was defined.")
+	}
+
+	if r.JSONPath != "" {
+		if _, err := kubernetes.ParseJSONPath(r.JSONPath); err != nil {
+			errors = append(errors, fmt.Sprintf("The `JSONPath` is invalid: %s", err.Error()))
+		}
+	} else if r.Value != "" {
+		warnings = append(warnings, "The `Value` is ignored because no `JSONPath` was defined.")
+	}
+
+	if err := validateTemplate("Wait rule value", r.Value); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	if r.Timeout < 0 {
+		errors = append(errors, "The `Timeout` must not be negative.")
+	}
+
+	if r.PollInterval < 0 {
+		errors = append(errors, "The `PollInterval` must not be negative.")
+	}
+
+	var err error
+	if len(errors) > 0 {
+		err = newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return warnings, err
+}
+
+///
+/// Mappings
+///
+
+// GetTimeout returns the timeout, defaulting to 5 minutes
+func (r WaitRule) GetTimeout() time.Duration {
+	if r.Timeout == 0 {
+		return defaultWaitTimeout
+	}
+	return r.Timeout
+}
+
+// GetPollInterval returns the poll interval, defaulting to 5 seconds
+func (r WaitRule) GetPollInterval() time.Duration {
+	if r.PollInterval == 0 {
+		return defaultWaitPollInterval
+	}
+	return r.PollInterval
+}
+
+// ToTemplatedWaitOptions templates the JSONPath value and maps a WaitRule to the options of a Kubernetes client wait
+func (r WaitRule) ToTemplatedWaitOptions(args templating.Args) (kubernetes.WaitOptions, error) {
+	templatedValue, err := templating.Execute("Value", r.Value, args)
+	if err != nil {
+		return kubernetes.WaitOptions{}, fmt.Errorf("Value templating error: %s", err.Error())
+	}
+
+	return kubernetes.WaitOptions{
+		Condition:    r.Condition,
+		Status:       r.Status,
+		Deleted:      r.Deleted,
+		JSONPath:     r.JSONPath,
+		Value:        templatedValue,
+		Timeout:      r.GetTimeout(),
+		PollInterval: r.GetPollInterval(),
+	}, nil
+}
+
+// ToPreflightChecks returns the verbs that a WaitRule needs
+func (r WaitRule) ToPreflightChecks() []kubernetes.PreflightCheck {
+	return []kubernetes.PreflightCheck{toPreflightCheck(r.APIVersion, r.Kind, r.Namespace, nil, "get", "list")}
+}
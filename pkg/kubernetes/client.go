@@ -1,13 +1,20 @@
 package kubernetes
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
 	k8s "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
@@ -21,18 +28,62 @@ var logger = stdlog.GetFromFlags()
 // Client is a wrapper around the client-go package for Kubernetes
 type Client interface {
 	List(apiVersion string, kind string, namespace string, labelSelector metav1.LabelSelector) ([]Resource, error)
-	Delete(apiVersion string, kind string, namespace string, labelSelector metav1.LabelSelector) error
+	Delete(apiVersion string, kind string, namespace string, name string, labelSelector metav1.LabelSelector, options DeleteOptions) error
+	Sweep(namespace string, name string, labelSelector metav1.LabelSelector, sweepOptions SweepOptions, options DeleteOptions) ([]SweepResult, error)
+	Apply(resource unstructured.Unstructured) error
+	Patch(apiVersion string, kind string, namespace string, name string, labelSelector metav1.LabelSelector, patchType types.PatchType, patch []byte) error
+	Scale(apiVersion string, kind string, namespace string, name string, labelSelector metav1.LabelSelector, options ScaleOptions) error
+	Copy(apiVersion string, kind string, sourceNamespace string, sourceName string, labelSelector metav1.LabelSelector, options CopyOptions) error
+	RunJob(resource unstructured.Unstructured, options JobOptions) error
+	Wait(apiVersion string, kind string, namespace string, name string, labelSelector metav1.LabelSelector, options WaitOptions) error
+	ForEachNamespace(namespaces []string, action func(namespace string) error) []error
+	Begin() Transaction
+	DryRun() DryRunClient
+	NewExecution() Execution
+	Cluster(name string) (Client, error)
+	Impersonate(user string, groups []string) (Client, error)
+	Preflight(check PreflightCheck) ([]string, error)
+	GetAPIResource(apiVersion string, kind string) (*metav1.APIResource, error)
 }
 
 // ClientImpl is the interface implementation of Client
 type ClientImpl struct {
-	config       *rest.Config
-	client       *k8s.Clientset
-	apiResources map[string]metav1.APIResourceList
+	config         *rest.Config
+	client         *k8s.Clientset
+	apiResources   *discoveryCache
+	impersonations *impersonationCache
+	journal        *journal
+	dryRun         *changeLog
+	safeguards     *safeguards
+	execution      *execution
+	clusters       *clusterRegistry
+	executor       *executor
+
+	// The name of the cluster that the client sends requests to. The default cluster is "".
+	cluster string
+
+	// The user and groups that the client sends requests as. If empty, the client uses its own identity.
+	impersonate rest.ImpersonationConfig
 }
 
-// makeClient returns a Client
-func makeClient() (Client, error) {
+// ClientOptions configures the clients of every cluster
+type ClientOptions struct {
+	// How long the API resources of each API Version are cached. If 0, they never expire.
+	DiscoveryCacheTTL time.Duration
+
+	// The maximum number of changes that bulk operations make at once, across every cluster
+	Concurrency int
+
+	// The maximum number of requests per second to each cluster, and the number of requests that can exceed it in a burst
+	QPS   float32
+	Burst int
+
+	// The number of times a change that fails with a rate limit, a conflict, or a server error is retried
+	Retries int
+}
+
+// makeClient returns a Client for the default cluster, which can hand out clients for the given named clusters
+func makeClient(safeguards Safeguards, clusters []ClusterConfig, options ClientOptions) (Client, error) {
 	k8sConfig, err := rest.InClusterConfig()
 	if err != nil {
 		kubeconfigEnv := os.Getenv("KUBECONFIG")
@@ -49,50 +100,55 @@ func makeClient() (Client, error) {
 		}
 	}
 
-	clientset, err := k8s.NewForConfig(k8sConfig)
+	client, err := newClient("", k8sConfig, options)
 	if err != nil {
 		return nil, err
 	}
-	return ClientImpl{
-		config:       k8sConfig,
-		client:       clientset,
-		apiResources: make(map[string]metav1.APIResourceList),
-	}, nil
+	client.clusters = newClusterRegistry(client, clusters, options)
+	client.safeguards = newSafeguards(safeguards)
+	client.executor = newExecutor(options.Concurrency, options.Retries)
+	return client, nil
 }
 
 // GetAPIResources retrieves and caches API resources for the given API Version
 func (c ClientImpl) GetAPIResources(apiVersion string) (*metav1.APIResourceList, error) {
-	resources, exists := c.apiResources[apiVersion]
-	if !exists {
-		resourcesPtr, err := c.client.Discovery().ServerResourcesForGroupVersion(apiVersion)
-		if err != nil {
-			return resourcesPtr, err
-		}
-		c.apiResources[apiVersion] = *resourcesPtr
-		return resourcesPtr, nil
-	}
-
-	return &resources, nil
+	return c.apiResources.resources(apiVersion, c.fetchAPIResources)
 }
 
-// GetAPIResource returns a specific API resource
+// GetAPIResource maps a kind to its API resource with the RESTMapper. If the kind isn't cached, its API Version is discovered again.
 func (c ClientImpl) GetAPIResource(apiVersion string, kind string) (*metav1.APIResource, error) {
-	apiResources, err := c.GetAPIResources(apiVersion)
+	groupVersion := c.GetGroupVersion(apiVersion)
+	mapping, err := c.RESTMapper().RESTMapping(groupVersion.WithKind(kind).GroupKind(), groupVersion.Version)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, apiResource := range apiResources.APIResources {
-		if strings.EqualFold(apiResource.Kind, kind) {
-			return &apiResource, nil
-		}
-	}
+	return &metav1.APIResource{
+		Name:       mapping.Resource.Resource,
+		Group:      mapping.Resource.Group,
+		Version:    mapping.Resource.Version,
+		Kind:       mapping.GroupVersionKind.Kind,
+		Namespaced: mapping.Scope.Name() == meta.RESTScopeNameNamespace,
+	}, nil
+}
 
-	return nil, fmt.Errorf("Kind '%s' was not found in API Version '%s'", kind, apiVersion)
+// fetchAPIResources discovers the API resources of an API Version
+func (c ClientImpl) fetchAPIResources(apiVersion string) (*metav1.APIResourceList, error) {
+	return c.client.Discovery().ServerResourcesForGroupVersion(apiVersion)
 }
 
 // List a Kubernetes resource
 func (c ClientImpl) List(apiVersion string, kind string, namespace string, labelSelector metav1.LabelSelector) ([]Resource, error) {
+	return c.list(apiVersion, kind, namespace, labelSelector, fields.Everything())
+}
+
+// list returns the Kubernetes resources matching both the label selector and the field selector
+func (c ClientImpl) list(apiVersion string, kind string, namespace string, labelSelector metav1.LabelSelector, fieldSelector fields.Selector) ([]Resource, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&labelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid label selector: %s", err.Error())
+	}
+
 	apiResource, err := c.GetAPIResource(apiVersion, kind)
 	if err != nil {
 		return nil, fmt.Errorf("Error getting API Resource %s for API %s: %s", kind, apiVersion, err.Error())
@@ -105,7 +161,8 @@ func (c ClientImpl) List(apiVersion string, kind string, namespace string, label
 
 	options := metav1.ListOptions{
 		TypeMeta:      metav1.TypeMeta{APIVersion: apiVersion, Kind: kind},
-		LabelSelector: metav1.FormatLabelSelector(&labelSelector),
+		LabelSelector: selector.String(),
+		FieldSelector: fieldSelector.String(),
 	}
 
 	result := &ResourceList{}
@@ -124,57 +181,299 @@ func (c ClientImpl) List(apiVersion string, kind string, namespace string, label
 	return result.Items, nil
 }
 
-// Delete Kubernetes resource(s)
-func (c ClientImpl) Delete(apiVersion string, kind string, namespace string, labelSelector metav1.LabelSelector) error {
+// Delete Kubernetes resource(s). Only the resources matching the name, the label selector and the field selector are deleted.
+func (c ClientImpl) Delete(apiVersion string, kind string, namespace string, name string, labelSelector metav1.LabelSelector, options DeleteOptions) error {
 	apiResource, err := c.GetAPIResource(apiVersion, kind)
 	if err != nil {
 		return fmt.Errorf("Error getting API Resource %s for API %s: %s", kind, apiVersion, err.Error())
 	}
 
+	if SelectsEverything(name, options.FieldSelector, labelSelector) {
+		return fmt.Errorf("Error deleting %s %s: the name, the field selector and the label selector are all empty, which would delete every resource", apiVersion, kind)
+	}
+
+	fieldSelector, err := options.fieldSelector(name)
+	if err != nil {
+		return fmt.Errorf("Error deleting %s %s: %s", apiVersion, kind, err.Error())
+	}
+
+	resources, err := c.listForDelete(apiVersion, kind, namespace, labelSelector, fieldSelector, options)
+	if err != nil {
+		return err
+	}
+
+	resources, err = options.Filter(resources)
+	if err != nil {
+		return fmt.Errorf("Error deleting %s %s: %s", apiVersion, kind, err.Error())
+	}
+
+	return c.deleteResources(apiVersion, apiResource, resources, options)
+}
+
+// listForDelete lists the resources matching both selectors in the namespace, or in every namespace of the delete options,
+// so that the limit and the retention policy see all of them at once
+func (c ClientImpl) listForDelete(apiVersion string, kind string, namespace string, labelSelector metav1.LabelSelector, fieldSelector fields.Selector, options DeleteOptions) ([]Resource, error) {
+	if len(options.Namespaces) == 0 {
+		return c.list(apiVersion, kind, namespace, labelSelector, fieldSelector)
+	}
+
+	var resources []Resource
+	for _, namespace := range options.Namespaces {
+		namespaceResources, err := c.list(apiVersion, kind, namespace, labelSelector, fieldSelector)
+		if err != nil {
+			return nil, fmt.Errorf("Error listing %s %s in namespace %s: %s", apiVersion, kind, namespace, err.Error())
+		}
+		resources = append(resources, namespaceResources...)
+	}
+	return resources, nil
+}
+
+// deleteResources deletes the given resources in parallel, and waits for them to be gone if the options require it.
+// Resources that were already deleted aren't considered an error.
+func (c ClientImpl) deleteResources(apiVersion string, apiResource *metav1.APIResource, resources []Resource, options DeleteOptions) error {
 	client, err := c.RESTClient(apiVersion)
 	if err != nil {
 		return fmt.Errorf("Error getting REST client for API %s: %s", apiVersion, err.Error())
 	}
 
-	resources, err := c.List(apiVersion, kind, namespace, labelSelector)
+	body, err := options.body()
 	if err != nil {
+		return fmt.Errorf("Error serializing the delete options: %s", err.Error())
+	}
+
+	if err := c.checkDeletions(apiVersion, apiResource, resources); err != nil {
 		return err
 	}
 
-	var channels []chan error
-	for _, resource := range resources {
-		channel := make(chan error)
-		go func() {
-			err := client.Delete().
-				NamespaceIfScoped(resource.Namespace, resource.Namespace != "").
-				Resource(apiResource.Name).
-				Name(resource.Name).
-				Do().
-				Error()
+	kind := apiResource.Kind
+	results := c.executor.runEach(resources, func(resource Resource) error {
+		err := c.withDryRun(client.Delete()).
+			NamespaceIfScoped(resource.Namespace, resource.Namespace != "").
+			Resource(apiResource.Name).
+			Name(resource.Name).
+			Body(body).
+			Do().
+			Error()
 
-			if err != nil {
-				channel <- fmt.Errorf("Error deleting %s %s %s: %s", apiVersion, kind, resource.Name, err.Error())
-			} else {
-				logger.Infof("Deleted %s %s %s", apiVersion, kind, resource.Name)
-				channel <- nil
-			}
-		}()
-		channels = append(channels, channel)
+		if apierrors.IsNotFound(err) {
+			logger.Infof("%s %s %s was already deleted", apiVersion, kind, resource.describeName())
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Error deleting %s %s %s: %w", apiVersion, kind, resource.describeName(), err)
+		}
+
+		if !c.recordDryRun(Change{ChangeActionDelete, apiVersion, kind, resource.Namespace, resource.Name, c.cluster}) {
+			logger.Infof("Deleted %s %s %s", apiVersion, kind, resource.describeName())
+		}
+		return nil
+	})
+	// The resources of a namespace selector are deleted together, but each namespace is reported separately
+	if err := aggregateNamespaceErrors("Errors deleting resources", options.Namespaces, resources, results); err != nil || !options.Wait {
+		return err
 	}
 
-	var errors []string
-	for _, channel := range channels {
-		err := <-channel
+	// All waits share one deadline, so the rule never blocks longer than the wait timeout
+	// however many resources were deleted
+	deadline := time.Now().Add(options.WaitTimeout)
+	results = c.executor.pollEach(resources, func(resource Resource) error {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			// A zero timeout would make the poll wait forever, so check the resource once instead
+			remaining = time.Nanosecond
+		}
+		waitOptions := WaitOptions{Deleted: true, Timeout: remaining, PollInterval: options.PollInterval}
+		return c.Wait(apiVersion, kind, resource.Namespace, resource.Name, metav1.LabelSelector{}, waitOptions)
+	})
+	return aggregateNamespaceErrors("Errors waiting for resources to be deleted", options.Namespaces, resources, results)
+}
+
+// Apply creates a Kubernetes resource, or merges it into the existing resource if it already exists
+func (c ClientImpl) Apply(resource unstructured.Unstructured) error {
+	apiVersion := resource.GetAPIVersion()
+	kind := resource.GetKind()
+
+	apiResource, err := c.GetAPIResource(apiVersion, kind)
+	if err != nil {
+		return fmt.Errorf("Error getting API Resource %s for API %s: %s", kind, apiVersion, err.Error())
+	}
+
+	client, err := c.RESTClient(apiVersion)
+	if err != nil {
+		return fmt.Errorf("Error getting REST client for API %s: %s", apiVersion, err.Error())
+	}
+
+	namespace := resource.GetNamespace()
+	if apiResource.Namespaced && namespace == "" {
+		// Kubernetes would create the resource in the default namespace, which is rarely intended
+		return fmt.Errorf("Error applying %s %s %s: the kind is namespaced, but no namespace is defined", apiVersion, kind, resource.GetName())
+	} else if !apiResource.Namespaced && namespace != "" {
+		resource.SetNamespace("")
+		namespace = ""
+	}
+
+	name := resource.GetName()
+	if name == "" {
+		if resource.GetGenerateName() == "" {
+			return fmt.Errorf("Error applying %s %s: a name or generateName must be defined", apiVersion, kind)
+		}
+		_, err := c.create(client, apiResource, resource)
+		return err
+	}
+
+	existingBody, err := client.Get().
+		NamespaceIfScoped(namespace, apiResource.Namespaced).
+		Resource(apiResource.Name).
+		Name(name).
+		Do().
+		Raw()
+
+	if apierrors.IsNotFound(err) {
+		_, err := c.create(client, apiResource, resource)
+		return err
+	} else if err != nil {
+		return fmt.Errorf("Error getting %s %s %s: %w", apiVersion, kind, name, err)
+	}
+
+	existing := unstructured.Unstructured{}
+	if err := json.Unmarshal(existingBody, &existing.Object); err != nil {
+		return fmt.Errorf("Error parsing existing %s %s %s: %s", apiVersion, kind, name, err.Error())
+	}
+	if err := c.checkProtected(apiVersion, kind, namespace, name); err != nil {
+		return fmt.Errorf("Error updating %s %s %s: %s", apiVersion, kind, name, err.Error())
+	}
+
+	c.recordUpdate(apiResource, existing)
+
+	// The resource is sent as a merge patch, so that the fields it doesn't set, such as those set by controllers or other tools, are kept.
+	// The patch isn't tied to the resource version of the existing resource, so concurrent changes don't conflict with it.
+	body, err := resource.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("Error serializing %s %s %s: %s", apiVersion, kind, name, err.Error())
+	}
+
+	err = c.withDryRun(client.Patch(types.MergePatchType)).
+		NamespaceIfScoped(namespace, apiResource.Namespaced).
+		Resource(apiResource.Name).
+		Name(name).
+		Body(body).
+		Do().
+		Error()
+
+	if err != nil {
+		return fmt.Errorf("Error updating %s %s %s: %w", apiVersion, kind, name, err)
+	}
+
+	if !c.recordDryRun(Change{ChangeActionUpdate, apiVersion, kind, namespace, name, c.cluster}) {
+		logger.Infof("Updated %s %s %s", apiVersion, kind, name)
+	}
+	return nil
+}
+
+// create creates a Kubernetes resource, and returns the created resource
+func (c ClientImpl) create(client rest.Interface, apiResource *metav1.APIResource, resource unstructured.Unstructured) (unstructured.Unstructured, error) {
+	apiVersion := resource.GetAPIVersion()
+	kind := resource.GetKind()
+
+	if err := c.checkProtected(apiVersion, kind, resource.GetNamespace(), resource.GetName()); err != nil {
+		return resource, fmt.Errorf("Error creating %s %s %s: %s", apiVersion, kind, resource.GetName(), err.Error())
+	}
+
+	body, err := resource.MarshalJSON()
+	if err != nil {
+		return resource, fmt.Errorf("Error serializing %s %s %s: %s", apiVersion, kind, resource.GetName(), err.Error())
+	}
+
+	createdBody, err := c.withDryRun(client.Post()).
+		NamespaceIfScoped(resource.GetNamespace(), apiResource.Namespaced).
+		Resource(apiResource.Name).
+		Body(body).
+		Do().
+		Raw()
+
+	if err != nil {
+		return resource, fmt.Errorf("Error creating %s %s %s: %w", apiVersion, kind, resource.GetName(), err)
+	}
+
+	// Use the created resource, since the server may have generated the name
+	created := unstructured.Unstructured{}
+	if err := json.Unmarshal(createdBody, &created.Object); err != nil {
+		return resource, fmt.Errorf("Error parsing created %s %s %s: %s", apiVersion, kind, resource.GetName(), err.Error())
+	}
+
+	if !c.recordDryRun(Change{ChangeActionCreate, apiVersion, kind, created.GetNamespace(), created.GetName(), c.cluster}) {
+		logger.Infof("Created %s %s %s", apiVersion, kind, created.GetName())
+	}
+	c.recordCreate(apiResource, created)
+	return created, nil
+}
+
+// Patch Kubernetes resource(s). If a name is given, then only that resource is patched. Otherwise, every resource matching the label selector is patched.
+func (c ClientImpl) Patch(apiVersion string, kind string, namespace string, name string, labelSelector metav1.LabelSelector, patchType types.PatchType, patch []byte) error {
+	apiResource, err := c.GetAPIResource(apiVersion, kind)
+	if err != nil {
+		return fmt.Errorf("Error getting API Resource %s for API %s: %s", kind, apiVersion, err.Error())
+	}
+
+	client, err := c.RESTClient(apiVersion)
+	if err != nil {
+		return fmt.Errorf("Error getting REST client for API %s: %s", apiVersion, err.Error())
+	}
+
+	resources, err := c.find(apiVersion, kind, namespace, name, labelSelector)
+	if err != nil {
+		return err
+	}
+
+	return c.executor.run(resources, "Errors patching resources", func(resource Resource) error {
+		if err := c.checkProtected(apiVersion, kind, resource.Namespace, resource.Name); err != nil {
+			return fmt.Errorf("Error patching %s %s %s: %s", apiVersion, kind, resource.Name, err.Error())
+		}
+
+		if err := c.snapshot(client, apiResource, resource); err != nil {
+			return err
+		}
+
+		err := c.withDryRun(client.Patch(patchType)).
+			NamespaceIfScoped(resource.Namespace, resource.Namespace != "").
+			Resource(apiResource.Name).
+			Name(resource.Name).
+			Body(patch).
+			Do().
+			Error()
+
 		if err != nil {
-			errors = append(errors, fmt.Sprintf("- %s", strings.ReplaceAll(err.Error(), "\n", "\n  ")))
+			return fmt.Errorf("Error patching %s %s %s: %w", apiVersion, kind, resource.Name, err)
+		}
+
+		if !c.recordDryRun(Change{ChangeActionPatch, apiVersion, kind, resource.Namespace, resource.Name, c.cluster}) {
+			logger.Infof("Patched %s %s %s", apiVersion, kind, resource.Name)
 		}
+		return nil
+	})
+}
+
+// find returns the named resource, or every resource matching the label selector if the name is empty
+func (c ClientImpl) find(apiVersion string, kind string, namespace string, name string, labelSelector metav1.LabelSelector) ([]Resource, error) {
+	if name == "" {
+		if len(labelSelector.MatchLabels) == 0 && len(labelSelector.MatchExpressions) == 0 {
+			return nil, fmt.Errorf("A name or a label selector is required to find %s %s", apiVersion, kind)
+		}
+		return c.List(apiVersion, kind, namespace, labelSelector)
+	}
+
+	apiResource, err := c.GetAPIResource(apiVersion, kind)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting API Resource %s for API %s: %s", kind, apiVersion, err.Error())
 	}
 
-	if len(errors) > 0 {
-		err = fmt.Errorf("Errors deleting resources:\n%s", strings.Join(errors, "\n"))
+	if apiResource.Namespaced && namespace == "" {
+		return nil, fmt.Errorf("A namespace is required to find %s %s %s", apiVersion, kind, name)
 	}
 
-	return err
+	return []Resource{Resource{
+		TypeMeta:   metav1.TypeMeta{APIVersion: apiVersion, Kind: kind},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+	}}, nil
 }
 
 // RESTClient creates a kubernetes client for the given API version
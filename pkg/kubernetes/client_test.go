@@ -0,0 +1,86 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/rest"
+)
+
+func TestApplyMergesExistingResource(t *testing.T) {
+	var mutex sync.Mutex
+	var methods []string
+	var contentType string
+	var patch map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		methods = append(methods, request.Method)
+		writer.Header().Set("Content-Type", "application/json")
+		switch request.Method {
+		case http.MethodGet:
+			writer.Write([]byte(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings","namespace":"preview","resourceVersion":"7"},` +
+				`"data":{"mode":"old","owner":"another-tool"}}`))
+		case http.MethodPatch:
+			contentType = request.Header.Get("Content-Type")
+			body, _ := ioutil.ReadAll(request.Body)
+			if err := json.Unmarshal(body, &patch); err != nil {
+				t.Errorf("Expected a JSON patch: %s", err.Error())
+			}
+			writer.Write([]byte(`{}`))
+		default:
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	apiResource := metav1.APIResource{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}
+	client := ClientImpl{config: &rest.Config{Host: server.URL}, apiResources: newDiscoveryCache("", 0)}
+	client.apiResources.groupVersions["v1"] = discoveryEntry{
+		resources: metav1.APIResourceList{GroupVersion: "v1", APIResources: []metav1.APIResource{apiResource}},
+		fetched:   time.Now(),
+	}
+	transaction := client.Begin().(TransactionImpl)
+
+	resource := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "settings", "namespace": "preview"},
+		"data":       map[string]interface{}{"mode": "new"},
+	}}
+	if err := transaction.Apply(resource); err != nil {
+		t.Fatalf("Expected the apply to succeed: %s", err.Error())
+	}
+
+	if len(methods) != 2 || methods[0] != http.MethodGet || methods[1] != http.MethodPatch {
+		t.Fatalf("Expected the existing ConfigMap to be patched, but received the requests %v", methods)
+	}
+	if contentType != "application/merge-patch+json" {
+		t.Errorf("Expected a merge patch, but received the content type %s", contentType)
+	}
+
+	patched := unstructured.Unstructured{Object: patch}
+	if mode, _, _ := unstructured.NestedString(patch, "data", "mode"); mode != "new" {
+		t.Errorf("Expected the patch to set the fields of the resource, but received %v", patch)
+	}
+	if _, exists, _ := unstructured.NestedString(patch, "data", "owner"); exists {
+		t.Errorf("Expected the patch to leave the fields that the resource doesn't set, but received %v", patch)
+	}
+	if patched.GetResourceVersion() != "" {
+		t.Errorf("Expected the patch not to depend on the resource version, but received %s", patched.GetResourceVersion())
+	}
+
+	// The snapshot of the existing resource is still kept for the rollback
+	if len(transaction.journal.entries) != 1 || transaction.journal.entries[0].resource.GetResourceVersion() != "7" {
+		t.Errorf("Expected the existing ConfigMap to be recorded in the journal, but received %v", transaction.journal.entries)
+	}
+}
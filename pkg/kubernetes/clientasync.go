@@ -1,8 +1,10 @@
 package kubernetes
 
-// ClientAsync is a wrapper around the client-go package for Kubernetes
+// ClientAsync is a wrapper around the client-go package for Kubernetes.
+// It is a registry of the clients of the default cluster and of the named clusters, which are built the first time they are used.
 type ClientAsync interface {
 	Sync() Client
+	Cluster(name string) (Client, error)
 }
 
 // ClientAsyncImpl is the interface implementation of ClientAsync
@@ -10,9 +12,9 @@ type ClientAsyncImpl struct {
 	syncClient Client
 }
 
-// MakeClient returns a ClientAsync
-func MakeClient() (ClientAsync, error) {
-	syncClient, err := makeClient()
+// MakeClient returns a ClientAsync for the default cluster and the given named clusters, that enforces the given safeguards and uses the given options
+func MakeClient(safeguards Safeguards, clusters []ClusterConfig, options ClientOptions) (ClientAsync, error) {
+	syncClient, err := makeClient(safeguards, clusters, options)
 	if err == nil {
 		return ClientAsyncImpl{syncClient}, nil
 	}
@@ -24,7 +26,12 @@ func MakeFromClient(syncClient Client) ClientAsync {
 	return ClientAsyncImpl{syncClient}
 }
 
-// Sync returns the synchronous client
+// Sync returns the synchronous client of the default cluster
 func (c ClientAsyncImpl) Sync() Client {
 	return c.syncClient
 }
+
+// Cluster returns the synchronous client of the named cluster. An empty name is the default cluster.
+func (c ClientAsyncImpl) Cluster(name string) (Client, error) {
+	return c.syncClient.Cluster(name)
+}
@@ -0,0 +1,212 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// ClusterConfig is how to connect to a named cluster, either with a kubeconfig context or with a token and CA stored in a Secret
+type ClusterConfig struct {
+	// The name that rules use to target the cluster
+	Name string
+
+	// The path of the kubeconfig file. If empty, the default kubeconfig file is used.
+	Kubeconfig string
+
+	// The kubeconfig context. If empty, the current context of the kubeconfig file is used.
+	Context string
+
+	// The URL of the API server, when the credentials are stored in a Secret
+	Server string
+
+	// The Secret in the default cluster with the token and CA of the cluster. If empty, the kubeconfig is used.
+	Secret *ClusterSecret
+}
+
+// ClusterSecret is a Secret with the credentials of a cluster
+type ClusterSecret struct {
+	Namespace string
+	Name      string
+
+	// The key of the bearer token. Defaults to "token".
+	TokenKey string
+
+	// The key of the PEM-encoded CA certificate. Defaults to "ca.crt". If the key doesn't exist, the system roots are used.
+	CAKey string
+}
+
+// clusterRegistry lazily builds a client for each named cluster. It is shared by every copy of the default client.
+type clusterRegistry struct {
+	mutex   sync.Mutex
+	configs map[string]ClusterConfig
+	options ClientOptions
+
+	// The clients of the clusters that were built, by name. The default cluster is "".
+	clients map[string]ClientImpl
+}
+
+// newClusterRegistry returns a registry of the given clusters
+func newClusterRegistry(defaultClient ClientImpl, clusters []ClusterConfig, options ClientOptions) *clusterRegistry {
+	configs := make(map[string]ClusterConfig)
+	for _, cluster := range clusters {
+		configs[cluster.Name] = cluster
+	}
+	return &clusterRegistry{configs: configs, options: options, clients: map[string]ClientImpl{"": defaultClient}}
+}
+
+// Cluster returns a copy of the client that sends requests to the named cluster.
+// The copy keeps the impersonation, transaction, dry run mode and execution of the client. An empty name is the default cluster.
+func (c ClientImpl) Cluster(name string) (Client, error) {
+	return c.forCluster(name)
+}
+
+// forCluster returns a copy of the client that sends requests to the named cluster
+func (c ClientImpl) forCluster(name string) (ClientImpl, error) {
+	if name == c.cluster {
+		return c, nil
+	} else if c.clusters == nil {
+		return c, fmt.Errorf("Cluster %s is not defined", name)
+	}
+
+	clusterClient, err := c.clusters.get(name)
+	if err != nil {
+		return c, err
+	}
+
+	c.config, c.client, c.apiResources, c.impersonations, c.cluster = clusterClient.config, clusterClient.client, clusterClient.apiResources, clusterClient.impersonations, name
+	return c.impersonated()
+}
+
+// get returns the client of a cluster, building it the first time
+func (r *clusterRegistry) get(name string) (ClientImpl, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if client, exists := r.clients[name]; exists {
+		return client, nil
+	}
+
+	clusterConfig, exists := r.configs[name]
+	if !exists {
+		return ClientImpl{}, fmt.Errorf("Cluster %s is not defined", name)
+	}
+
+	// The credentials stored in Secrets are read from the default cluster
+	k8sConfig, err := r.clients[""].restConfigFor(clusterConfig)
+	if err != nil {
+		return ClientImpl{}, fmt.Errorf("Error initializing the Kubernetes config of cluster %s: %s", name, err.Error())
+	}
+
+	client, err := newClient(name, k8sConfig, r.options)
+	if err != nil {
+		return ClientImpl{}, fmt.Errorf("Error initializing the Kubernetes client of cluster %s: %s", name, err.Error())
+	}
+
+	logger.Infof("Connected to cluster %s at %s", name, k8sConfig.Host)
+	r.clients[name] = client
+	return client, nil
+}
+
+// restConfigFor returns the config to connect to a cluster
+func (c ClientImpl) restConfigFor(clusterConfig ClusterConfig) (*rest.Config, error) {
+	if clusterConfig.Secret == nil {
+		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+		if clusterConfig.Kubeconfig != "" {
+			loadingRules.ExplicitPath = clusterConfig.Kubeconfig
+		}
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: clusterConfig.Context}
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	}
+
+	tokenKey := clusterConfig.Secret.TokenKey
+	if tokenKey == "" {
+		tokenKey = "token"
+	}
+	caKey := clusterConfig.Secret.CAKey
+	if caKey == "" {
+		caKey = "ca.crt"
+	}
+
+	tokenOf := func(secret corev1.Secret) (string, error) {
+		token, exists := secret.Data[tokenKey]
+		if !exists {
+			return "", fmt.Errorf("Secret %s/%s doesn't have the key %s", clusterConfig.Secret.Namespace, clusterConfig.Secret.Name, tokenKey)
+		}
+		return string(token), nil
+	}
+
+	secret, err := c.getClusterSecret(clusterConfig.Secret)
+	if err != nil {
+		return nil, err
+	}
+	initialToken, err := tokenOf(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	// The token is read from the Secret again when the cluster rejects it, so that it can be rotated
+	token := newSecretToken(initialToken, func() (string, error) {
+		secret, err := c.getClusterSecret(clusterConfig.Secret)
+		if err != nil {
+			return "", err
+		}
+		return tokenOf(secret)
+	})
+
+	return &rest.Config{
+		Host:            clusterConfig.Server,
+		WrapTransport:   token.wrapTransport,
+		TLSClientConfig: rest.TLSClientConfig{CAData: secret.Data[caKey]},
+	}, nil
+}
+
+// getClusterSecret reads the Secret with the credentials of a cluster
+func (c ClientImpl) getClusterSecret(clusterSecret *ClusterSecret) (corev1.Secret, error) {
+	client, err := c.RESTClient("v1")
+	if err != nil {
+		return corev1.Secret{}, err
+	}
+
+	body, err := client.Get().
+		Namespace(clusterSecret.Namespace).
+		Resource("secrets").
+		Name(clusterSecret.Name).
+		Do().
+		Raw()
+	if err != nil {
+		return corev1.Secret{}, fmt.Errorf("Error getting Secret %s/%s: %s", clusterSecret.Namespace, clusterSecret.Name, err.Error())
+	}
+
+	secret := corev1.Secret{}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return corev1.Secret{}, fmt.Errorf("Error parsing Secret %s/%s: %s", clusterSecret.Namespace, clusterSecret.Name, err.Error())
+	}
+	return secret, nil
+}
+
+// newClient returns a client for the given config of the named cluster
+func newClient(cluster string, k8sConfig *rest.Config, options ClientOptions) (ClientImpl, error) {
+	if options.QPS > 0 {
+		// Every REST client of the cluster shares the rate limiter, since a REST client is created for each operation
+		k8sConfig.QPS, k8sConfig.Burst = options.QPS, options.Burst
+		k8sConfig.RateLimiter = flowcontrol.NewTokenBucketRateLimiter(options.QPS, options.Burst)
+	}
+
+	clientset, err := k8s.NewForConfig(k8sConfig)
+	if err != nil {
+		return ClientImpl{}, err
+	}
+	return ClientImpl{
+		config:         k8sConfig,
+		client:         clientset,
+		apiResources:   newDiscoveryCache(cluster, options.DiscoveryCacheTTL),
+		impersonations: newImpersonationCache(),
+	}, nil
+}
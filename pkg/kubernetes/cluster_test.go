@@ -0,0 +1,87 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestClusterFromSecret(t *testing.T) {
+	var mutex sync.Mutex
+	secretRequests := 0
+	var authorizations []string
+
+	defaultServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if request.URL.Path != "/api/v1/namespaces/azd/secrets/dev-cluster" {
+			t.Errorf("Expected only the Secret to be requested from the default cluster, but received %s", request.URL.Path)
+		}
+		secretRequests++
+		writer.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(writer).Encode(map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata":   map[string]interface{}{"name": "dev-cluster", "namespace": "azd"},
+			// "c2VjcmV0" is "secret"
+			"data": map[string]interface{}{"token": "c2VjcmV0"},
+		})
+	}))
+	defer defaultServer.Close()
+
+	devServer := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		authorizations = append(authorizations, request.Header.Get("Authorization"))
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write([]byte(`{"apiVersion":"v1","kind":"ConfigMapList","items":[{"metadata":{"name":"settings","namespace":"preview"}}]}`))
+	}))
+	defer devServer.Close()
+
+	client := ClientImpl{config: &rest.Config{Host: defaultServer.URL}, apiResources: newDiscoveryCache("", 0)}
+	client.clusters = newClusterRegistry(client, []ClusterConfig{
+		ClusterConfig{Name: "dev", Server: devServer.URL, Secret: &ClusterSecret{Namespace: "azd", Name: "dev-cluster"}},
+	}, ClientOptions{})
+	dryRun := client.DryRun().(DryRunClientImpl)
+
+	for i := 0; i < 2; i++ {
+		devClient, err := dryRun.forCluster("dev")
+		if err != nil {
+			t.Fatalf("Expected cluster dev to be built: %s", err.Error())
+		}
+		if devClient.cluster != "dev" || devClient.dryRun != dryRun.dryRun {
+			t.Errorf("Expected the client of cluster dev to keep the dry run mode")
+		}
+		restClient, err := devClient.RESTClient("v1")
+		if err != nil {
+			t.Fatalf("Expected a REST client for cluster dev: %s", err.Error())
+		}
+		if err := restClient.Get().Namespace("preview").Resource("configmaps").Do().Error(); err != nil {
+			t.Fatalf("Expected to list ConfigMaps in cluster dev: %s", err.Error())
+		}
+	}
+
+	if secretRequests != 1 {
+		t.Errorf("Expected the Secret to be read once, but it was read %d times", secretRequests)
+	}
+	for _, authorization := range authorizations {
+		if authorization != "Bearer secret" {
+			t.Errorf("Expected the token from the Secret to be used, but received %s", authorization)
+		}
+	}
+
+	defaultClient, err := dryRun.forCluster("")
+	if err != nil || defaultClient.config.Host != defaultServer.URL {
+		t.Errorf("Expected the default cluster to be returned for an empty name")
+	}
+
+	if _, err := dryRun.forCluster("prod"); err == nil {
+		t.Errorf("Expected an error for an undefined cluster")
+	}
+}
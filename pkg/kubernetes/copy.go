@@ -0,0 +1,184 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+// CopyOptions holds the options to copy resources
+type CopyOptions struct {
+	// The namespace to copy the resources to
+	TargetNamespace string
+
+	// The name of the copy. If empty, the source name is used.
+	TargetName string
+
+	// Labels to add or overwrite on the copy
+	Labels map[string]string
+
+	// If true, update the copy if it already exists. Otherwise, existing copies are left unchanged.
+	Sync bool
+}
+
+// serverManagedMetadata lists the metadata fields that are set by the Kubernetes API server
+var serverManagedMetadata = []string{
+	"uid",
+	"resourceVersion",
+	"generation",
+	"creationTimestamp",
+	"deletionTimestamp",
+	"deletionGracePeriodSeconds",
+	"selfLink",
+	"managedFields",
+	"ownerReferences",
+	"finalizers",
+}
+
+// allocatedFields lists the fields that the Kubernetes API server allocates for each kind.
+// A copy can't reuse them, and most of them can't be changed once allocated, so they are left for the target to allocate.
+var allocatedFields = map[schema.GroupKind][][]string{
+	{Group: "", Kind: "Service"}: {
+		{"spec", "clusterIP"},
+		{"spec", "clusterIPs"},
+		{"spec", "healthCheckNodePort"},
+	},
+	{Group: "", Kind: "PersistentVolumeClaim"}: {
+		{"spec", "volumeName"},
+	},
+}
+
+// Copy Kubernetes resource(s) to another namespace. If a source name is given, then only that resource is copied. Otherwise, every resource matching the label selector is copied.
+func (c ClientImpl) Copy(apiVersion string, kind string, sourceNamespace string, sourceName string, labelSelector metav1.LabelSelector, options CopyOptions) error {
+	apiResource, err := c.GetAPIResource(apiVersion, kind)
+	if err != nil {
+		return fmt.Errorf("Error getting API Resource %s for API %s: %s", kind, apiVersion, err.Error())
+	}
+
+	if !apiResource.Namespaced {
+		return fmt.Errorf("%s %s is not namespaced, so it cannot be copied to another namespace", apiVersion, kind)
+	}
+
+	client, err := c.RESTClient(apiVersion)
+	if err != nil {
+		return fmt.Errorf("Error getting REST client for API %s: %s", apiVersion, err.Error())
+	}
+
+	resources, err := c.find(apiVersion, kind, sourceNamespace, sourceName, labelSelector)
+	if err != nil {
+		return err
+	}
+
+	if options.TargetName != "" && len(resources) > 1 {
+		return fmt.Errorf("A target name was defined, but %d %s %s resources matched", len(resources), apiVersion, kind)
+	}
+
+	return c.executor.run(resources, "Errors copying resources", func(resource Resource) error {
+		err := c.copyResource(client, apiResource, resource, options)
+		if err != nil {
+			return fmt.Errorf("Error copying %s %s %s/%s to namespace %s: %w", apiVersion, kind, resource.Namespace, resource.Name, options.TargetNamespace, err)
+		}
+		return nil
+	})
+}
+
+// copyResource copies a single resource
+func (c ClientImpl) copyResource(client rest.Interface, apiResource *metav1.APIResource, resource Resource, options CopyOptions) error {
+	body, err := client.Get().
+		Namespace(resource.Namespace).
+		Resource(apiResource.Name).
+		Name(resource.Name).
+		Do().
+		Raw()
+	if err != nil {
+		return fmt.Errorf("Error getting the source: %w", err)
+	}
+
+	source := unstructured.Unstructured{}
+	if err := json.Unmarshal(body, &source.Object); err != nil {
+		return fmt.Errorf("Error parsing the source: %s", err.Error())
+	}
+
+	target := newCopy(source, options)
+
+	if options.Sync {
+		return c.Apply(target)
+	}
+
+	err = client.Get().
+		Namespace(target.GetNamespace()).
+		Resource(apiResource.Name).
+		Name(target.GetName()).
+		Do().
+		Error()
+	if err == nil {
+		logger.Infof("%s %s/%s already exists", target.GetKind(), target.GetNamespace(), target.GetName())
+		return nil
+	} else if !apierrors.IsNotFound(err) {
+		return fmt.Errorf("Error getting the target: %w", err)
+	}
+
+	_, err = c.create(client, apiResource, target)
+	return err
+}
+
+// newCopy strips the server-managed fields from a resource, and applies the copy options
+func newCopy(source unstructured.Unstructured, options CopyOptions) unstructured.Unstructured {
+	target := unstructured.Unstructured{Object: source.DeepCopy().Object}
+
+	for _, field := range serverManagedMetadata {
+		unstructured.RemoveNestedField(target.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(target.Object, "status")
+	removeAllocatedFields(target)
+
+	annotations := target.GetAnnotations()
+	delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	target.SetAnnotations(annotations)
+
+	target.SetNamespace(options.TargetNamespace)
+	if options.TargetName != "" {
+		target.SetName(options.TargetName)
+	}
+
+	if len(options.Labels) > 0 {
+		labels := target.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		for label, value := range options.Labels {
+			labels[label] = value
+		}
+		target.SetLabels(labels)
+	}
+
+	return target
+}
+
+// removeAllocatedFields removes the fields that the Kubernetes API server allocated for the kind of a resource
+func removeAllocatedFields(resource unstructured.Unstructured) {
+	groupKind := resource.GroupVersionKind().GroupKind()
+	for _, field := range allocatedFields[groupKind] {
+		unstructured.RemoveNestedField(resource.Object, field...)
+	}
+
+	// Node ports are allocated for the whole cluster, so a copy of a NodePort or LoadBalancer Service can't use the same ports
+	if groupKind == (schema.GroupKind{Group: "", Kind: "Service"}) {
+		if ports, found, err := unstructured.NestedSlice(resource.Object, "spec", "ports"); found && err == nil {
+			for _, port := range ports {
+				if port, ok := port.(map[string]interface{}); ok {
+					delete(port, "nodePort")
+				}
+			}
+			unstructured.SetNestedSlice(resource.Object, ports, "spec", "ports")
+		}
+	}
+}
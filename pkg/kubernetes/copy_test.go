@@ -0,0 +1,99 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNewCopy(t *testing.T) {
+	source := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"name":              "registry",
+			"namespace":         "shared",
+			"uid":               "c0ffee",
+			"resourceVersion":   "123",
+			"creationTimestamp": "2019-10-12T00:00:00Z",
+			"labels": map[string]interface{}{
+				"app": "registry",
+			},
+			"annotations": map[string]interface{}{
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+			},
+		},
+		"type": "kubernetes.io/dockerconfigjson",
+		"data": map[string]interface{}{
+			".dockerconfigjson": "e30=",
+		},
+	}}
+
+	target := newCopy(source, CopyOptions{
+		TargetNamespace: "pr-7",
+		TargetName:      "registry-copy",
+		Labels:          map[string]string{"azdPullRequestId": "7"},
+	})
+
+	if target.GetNamespace() != "pr-7" || target.GetName() != "registry-copy" {
+		t.Errorf("Expected pr-7/registry-copy but received %s/%s", target.GetNamespace(), target.GetName())
+	}
+	if target.GetUID() != "" || target.GetResourceVersion() != "" {
+		t.Errorf("Expected server-managed metadata to be removed, but received %v", target.Object["metadata"])
+	}
+	if _, exists := target.Object["metadata"].(map[string]interface{})["creationTimestamp"]; exists {
+		t.Errorf("Expected the creation timestamp to be removed")
+	}
+	if target.GetAnnotations() != nil {
+		t.Errorf("Expected the last applied configuration annotation to be removed, but received %v", target.GetAnnotations())
+	}
+	if labels := target.GetLabels(); labels["app"] != "registry" || labels["azdPullRequestId"] != "7" {
+		t.Errorf("Expected labels to be merged, but received %v", labels)
+	}
+	if target.Object["type"] != "kubernetes.io/dockerconfigjson" || target.Object["data"] == nil {
+		t.Errorf("Expected the resource body to be copied, but received %v", target.Object)
+	}
+	if source.GetNamespace() != "shared" || source.GetUID() != "c0ffee" {
+		t.Errorf("Expected the source to be unchanged")
+	}
+}
+
+func TestNewCopyRemovesAllocatedFields(t *testing.T) {
+	source := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Service",
+		"metadata": map[string]interface{}{
+			"name":      "web",
+			"namespace": "shared",
+		},
+		"spec": map[string]interface{}{
+			"type":                  "LoadBalancer",
+			"clusterIP":             "10.0.0.12",
+			"clusterIPs":            []interface{}{"10.0.0.12"},
+			"healthCheckNodePort":   int64(31000),
+			"externalTrafficPolicy": "Local",
+			"ports": []interface{}{
+				map[string]interface{}{"port": int64(80), "targetPort": int64(8080), "nodePort": int64(30080)},
+			},
+		},
+	}}
+
+	target := newCopy(source, CopyOptions{TargetNamespace: "pr-7"})
+
+	spec := target.Object["spec"].(map[string]interface{})
+	for _, field := range []string{"clusterIP", "clusterIPs", "healthCheckNodePort"} {
+		if _, exists := spec[field]; exists {
+			t.Errorf("Expected spec.%s to be removed, but received %v", field, spec[field])
+		}
+	}
+	port := spec["ports"].([]interface{})[0].(map[string]interface{})
+	if _, exists := port["nodePort"]; exists || port["port"] != int64(80) {
+		t.Errorf("Expected only the node port to be removed from the port, but received %v", port)
+	}
+	if spec["type"] != "LoadBalancer" || spec["externalTrafficPolicy"] != "Local" {
+		t.Errorf("Expected the rest of the spec to be copied, but received %v", spec)
+	}
+	if sourceSpec := source.Object["spec"].(map[string]interface{}); sourceSpec["clusterIP"] != "10.0.0.12" || sourceSpec["ports"].([]interface{})[0].(map[string]interface{})["nodePort"] != int64(30080) {
+		t.Errorf("Expected the source to be unchanged")
+	}
+}
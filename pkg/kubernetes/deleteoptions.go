@@ -0,0 +1,163 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// DeleteOptions holds the options to select which resources are deleted, and how they are deleted
+type DeleteOptions struct {
+	// The maximum resources to delete. If more resources would be deleted, then nothing is deleted and an error is returned.
+	Limit *int
+
+	// Resources to keep instead of deleting
+	Retain *RetentionPolicy
+
+	// The field selector, such as "status.phase=Succeeded". If empty, resources aren't filtered by their fields.
+	FieldSelector string
+
+	// The namespaces to delete resources from, instead of a single namespace. The limit and the retention policy apply to the resources of all of them together.
+	Namespaces []string
+
+	// How dependents are deleted. If nil, the default of the resource is used.
+	PropagationPolicy *metav1.DeletionPropagation
+
+	// The number of seconds before the resources are deleted. If nil, the default of the resource is used.
+	GracePeriodSeconds *int64
+
+	// Only delete resources that match these preconditions
+	Preconditions *metav1.Preconditions
+
+	// If true, wait until the deleted resources and their finalizers are gone
+	Wait bool
+
+	// How long to wait for the resources to be gone
+	WaitTimeout time.Duration
+
+	// How often to check if the resources are gone
+	PollInterval time.Duration
+}
+
+// RetentionPolicy keeps the newest resources
+type RetentionPolicy struct {
+	// The number of resources to keep in each group
+	Count int
+
+	// The label to order resources by. If empty, resources are ordered by their creation timestamp.
+	Label string
+
+	// Labels to group resources by. The retention count is applied to each group separately.
+	GroupBy []string
+}
+
+// Filter returns the resources that should be deleted
+func (o DeleteOptions) Filter(resources []Resource) ([]Resource, error) {
+	if o.Retain != nil {
+		resources = o.Retain.Filter(resources)
+	}
+
+	if o.Limit != nil && len(resources) > *o.Limit {
+		return nil, fmt.Errorf("%d resources matched, which is more than the limit of %d", len(resources), *o.Limit)
+	}
+
+	return resources, nil
+}
+
+// Filter removes the resources that should be retained
+func (p RetentionPolicy) Filter(resources []Resource) []Resource {
+	var groupKeys []string
+	groups := make(map[string][]Resource)
+	for _, resource := range resources {
+		if _, exists := resource.Labels[p.Label]; p.Label != "" && !exists {
+			// It isn't known how new a resource without the label is, so it is kept
+			continue
+		}
+
+		var groupValues []string
+		for _, label := range p.GroupBy {
+			groupValues = append(groupValues, resource.Labels[label])
+		}
+		groupKey := strings.Join(groupValues, "\n")
+		if _, exists := groups[groupKey]; !exists {
+			groupKeys = append(groupKeys, groupKey)
+		}
+		groups[groupKey] = append(groups[groupKey], resource)
+	}
+
+	var filtered []Resource
+	for _, groupKey := range groupKeys {
+		group := groups[groupKey]
+		// Sort from newest to oldest
+		sort.SliceStable(group, func(i, j int) bool {
+			return p.newer(group[i], group[j])
+		})
+		if len(group) > p.Count {
+			filtered = append(filtered, group[p.Count:]...)
+		}
+	}
+
+	return filtered
+}
+
+// newer returns true if a is newer than b. Label values that are numbers, such as build IDs, are compared numerically and are newer than other values,
+// which are compared as strings. Resources with the same label value are compared by their creation timestamp.
+func (p RetentionPolicy) newer(a Resource, b Resource) bool {
+	if p.Label != "" {
+		aValue, bValue := a.Labels[p.Label], b.Labels[p.Label]
+		aInt, aErr := strconv.ParseInt(aValue, 10, 64)
+		bInt, bErr := strconv.ParseInt(bValue, 10, 64)
+
+		if aErr == nil && bErr == nil {
+			if aInt != bInt {
+				return aInt > bInt
+			}
+		} else if (aErr == nil) != (bErr == nil) {
+			return aErr == nil
+		} else if aValue != bValue {
+			return aValue > bValue
+		}
+	}
+
+	return b.CreationTimestamp.Before(&a.CreationTimestamp)
+}
+
+// SelectsEverything returns true if the name, the field selector and the label selector are all empty, such as when their templates render to empty values.
+// Deleting with them would delete every resource of a kind.
+func SelectsEverything(name string, fieldSelector string, labelSelector metav1.LabelSelector) bool {
+	return name == "" && strings.TrimSpace(fieldSelector) == "" && len(labelSelector.MatchLabels) == 0 && len(labelSelector.MatchExpressions) == 0
+}
+
+// body returns the serialized Kubernetes delete options. The options are serialized directly, since they are not registered for every API group.
+func (o DeleteOptions) body() ([]byte, error) {
+	return json.Marshal(metav1.DeleteOptions{
+		TypeMeta:           metav1.TypeMeta{APIVersion: "v1", Kind: "DeleteOptions"},
+		PropagationPolicy:  o.PropagationPolicy,
+		GracePeriodSeconds: o.GracePeriodSeconds,
+		Preconditions:      o.Preconditions,
+	})
+}
+
+// fieldSelector parses the field selector, and combines it with the resource name if one is given
+func (o DeleteOptions) fieldSelector(name string) (fields.Selector, error) {
+	selector, err := fields.ParseSelector(o.FieldSelector)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid field selector '%s': %s", o.FieldSelector, err.Error())
+	}
+
+	if name != "" {
+		nameSelector := fields.OneTermEqualSelector("metadata.name", name)
+		if selector.Empty() {
+			return nameSelector, nil
+		}
+		selector = fields.AndSelectors(nameSelector, selector)
+	}
+
+	return selector, nil
+}
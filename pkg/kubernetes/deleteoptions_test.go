@@ -0,0 +1,132 @@
+package kubernetes_test
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
+)
+
+func newResource(name string, created time.Time, labels map[string]string) kubernetes.Resource {
+	return kubernetes.Resource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(created),
+			Labels:            labels,
+		},
+	}
+}
+
+func names(resources []kubernetes.Resource) map[string]bool {
+	result := make(map[string]bool)
+	for _, resource := range resources {
+		result[resource.Name] = true
+	}
+	return result
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	now := time.Now()
+
+	resources := []kubernetes.Resource{
+		newResource("master-1", now.Add(-5*time.Hour), map[string]string{"branch": "master", "buildId": "9"}),
+		newResource("master-2", now.Add(-4*time.Hour), map[string]string{"branch": "master", "buildId": "10"}),
+		newResource("master-3", now.Add(-3*time.Hour), map[string]string{"branch": "master", "buildId": "11"}),
+		newResource("feature-1", now.Add(-2*time.Hour), map[string]string{"branch": "feature", "buildId": "12"}),
+		newResource("master-4", now.Add(-1*time.Hour), map[string]string{"branch": "master", "buildId": "8"}),
+	}
+
+	t.Run("retention_test_creationtimestamp", func(t *testing.T) {
+		deleted := names(kubernetes.RetentionPolicy{Count: 3}.Filter(resources))
+		if len(deleted) != 2 || !deleted["master-1"] || !deleted["master-2"] {
+			t.Errorf("Expected master-1 and master-2 to be deleted, but received %v", deleted)
+		}
+	})
+
+	t.Run("retention_test_groupby", func(t *testing.T) {
+		deleted := names(kubernetes.RetentionPolicy{Count: 2, GroupBy: []string{"branch"}}.Filter(resources))
+		if len(deleted) != 2 || !deleted["master-1"] || !deleted["master-2"] {
+			t.Errorf("Expected master-1 and master-2 to be deleted, but received %v", deleted)
+		}
+	})
+
+	t.Run("retention_test_numeric_label", func(t *testing.T) {
+		deleted := names(kubernetes.RetentionPolicy{Count: 2, Label: "buildId", GroupBy: []string{"branch"}}.Filter(resources))
+		if len(deleted) != 2 || !deleted["master-1"] || !deleted["master-4"] {
+			t.Errorf("Expected master-1 and master-4 to be deleted, but received %v", deleted)
+		}
+	})
+
+	t.Run("retention_test_missing_label", func(t *testing.T) {
+		unlabeled := append([]kubernetes.Resource{newResource("manual", now.Add(-6*time.Hour), map[string]string{"branch": "master"})}, resources...)
+		deleted := names(kubernetes.RetentionPolicy{Count: 2, Label: "buildId", GroupBy: []string{"branch"}}.Filter(unlabeled))
+		if len(deleted) != 2 || !deleted["master-1"] || !deleted["master-4"] {
+			t.Errorf("Expected the resource without the label to be kept, but received %v", deleted)
+		}
+	})
+
+	t.Run("retention_test_mixed_label", func(t *testing.T) {
+		// Numbers are newer than other values, and equal values are ordered by creation timestamp
+		mixed := []kubernetes.Resource{
+			newResource("latest", now.Add(-4*time.Hour), map[string]string{"version": "latest"}),
+			newResource("build-9", now.Add(-3*time.Hour), map[string]string{"version": "9"}),
+			newResource("build-10", now.Add(-2*time.Hour), map[string]string{"version": "10"}),
+			newResource("build-10-rerun", now.Add(-1*time.Hour), map[string]string{"version": "10"}),
+			newResource("canary", now, map[string]string{"version": "canary"}),
+		}
+		deleted := names(kubernetes.RetentionPolicy{Count: 2, Label: "version"}.Filter(mixed))
+		if len(deleted) != 3 || !deleted["build-9"] || !deleted["latest"] || !deleted["canary"] {
+			t.Errorf("Expected build-9, latest and canary to be deleted, but received %v", deleted)
+		}
+
+		deleted = names(kubernetes.RetentionPolicy{Count: 1, Label: "version"}.Filter(mixed))
+		if len(deleted) != 4 || deleted["build-10-rerun"] {
+			t.Errorf("Expected every resource except build-10-rerun to be deleted, but received %v", deleted)
+		}
+	})
+}
+
+func TestDeleteOptionsLimit(t *testing.T) {
+	now := time.Now()
+	limit := 1
+
+	resources := []kubernetes.Resource{
+		newResource("a", now, nil),
+		newResource("b", now, nil),
+	}
+
+	if _, err := (kubernetes.DeleteOptions{Limit: &limit}).Filter(resources); err == nil {
+		t.Errorf("Expected an error when more resources than the limit match")
+	}
+
+	filtered, err := kubernetes.DeleteOptions{Limit: &limit, Retain: &kubernetes.RetentionPolicy{Count: 1}}.Filter(resources)
+	if err != nil || len(filtered) != 1 {
+		t.Errorf("Expected 1 resource to be deleted after retention, but received %v (error: %v)", filtered, err)
+	}
+}
+
+func TestSelectsEverything(t *testing.T) {
+	tests := []struct {
+		name          string
+		resourceName  string
+		fieldSelector string
+		labelSelector metav1.LabelSelector
+		expected      bool
+	}{
+		{"empty", "", "", metav1.LabelSelector{}, true},
+		{"blank_field_selector", "", " ", metav1.LabelSelector{}, true},
+		{"name", "settings", "", metav1.LabelSelector{}, false},
+		{"field_selector", "", "status.phase=Succeeded", metav1.LabelSelector{}, false},
+		{"label_selector", "", "", metav1.LabelSelector{MatchLabels: map[string]string{"azdPullRequestId": ""}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := kubernetes.SelectsEverything(test.resourceName, test.fieldSelector, test.labelSelector); actual != test.expected {
+				t.Errorf("Expected %t but received %t", test.expected, actual)
+			}
+		})
+	}
+}
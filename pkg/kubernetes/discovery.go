@@ -0,0 +1,230 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// minDiscoveryRefreshInterval is how long an API Version is trusted after it was fetched, before a kind that wasn't found in it fetches it again
+	minDiscoveryRefreshInterval = 10 * time.Second
+)
+
+var (
+	discoveryCacheCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "azd_kubernetes_manager_discovery_cache_count",
+		Help: "The total number of API resource lookups, by whether the API Version was in the discovery cache",
+	}, []string{"cluster", "result"})
+
+	discoveryRefreshCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "azd_kubernetes_manager_discovery_refresh_count",
+		Help: "The total number of API Versions fetched from discovery, by why they were fetched",
+	}, []string{"cluster", "reason", "result"})
+)
+
+// discoveryCache caches the API resources of each API Version of a cluster, and maps kinds to their API resources.
+// It is shared by every copy of the cluster's client. API Versions are fetched again when they expire, and when a kind isn't found in them,
+// so that CustomResourceDefinitions installed after startup are discovered.
+// API Versions are fetched without holding the mutex, and concurrent lookups of an API Version share a single fetch.
+type discoveryCache struct {
+	mutex sync.Mutex
+
+	// The name of the cluster, for metrics. The default cluster is "".
+	cluster string
+
+	// How long API Versions are cached. If 0, they never expire.
+	ttl time.Duration
+
+	groupVersions map[string]discoveryEntry
+
+	// The API groups, for the RESTMapper, and when they were fetched
+	groups        *metav1.APIGroupList
+	groupsFetched time.Time
+
+	// The API Versions being fetched
+	fetches map[string]*discoveryFetch
+
+	// Returns the current time. Overridden by tests.
+	now func() time.Time
+}
+
+// discoveryEntry is a cached API Version
+type discoveryEntry struct {
+	resources metav1.APIResourceList
+	fetched   time.Time
+}
+
+// discoveryFetch is a fetch of an API Version that is in progress. Its result is set before done is closed.
+type discoveryFetch struct {
+	done      chan struct{}
+	resources *metav1.APIResourceList
+	err       error
+}
+
+// discoveryFetcher fetches the API resources of an API Version
+type discoveryFetcher func(apiVersion string) (*metav1.APIResourceList, error)
+
+// newDiscoveryCache returns an empty cache for the named cluster
+func newDiscoveryCache(cluster string, ttl time.Duration) *discoveryCache {
+	return &discoveryCache{
+		cluster:       cluster,
+		ttl:           ttl,
+		groupVersions: make(map[string]discoveryEntry),
+		fetches:       make(map[string]*discoveryFetch),
+		now:           time.Now,
+	}
+}
+
+// store caches the API resources of an API Version
+func (d *discoveryCache) store(resources metav1.APIResourceList) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.groupVersions[resources.GroupVersion] = discoveryEntry{resources, d.now()}
+}
+
+// entry returns a cached API Version
+func (d *discoveryCache) entry(apiVersion string) (discoveryEntry, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	entry, exists := d.groupVersions[apiVersion]
+	return entry, exists
+}
+
+// resources returns the API resources of an API Version, fetching them if they aren't cached or have expired
+func (d *discoveryCache) resources(apiVersion string, fetch discoveryFetcher) (*metav1.APIResourceList, error) {
+	entry, exists := d.entry(apiVersion)
+	if !exists {
+		discoveryCacheCounter.WithLabelValues(d.cluster, "miss").Inc()
+		return d.refresh(apiVersion, "missing", entry.fetched, fetch)
+	} else if d.ttl > 0 && d.now().Sub(entry.fetched) >= d.ttl {
+		discoveryCacheCounter.WithLabelValues(d.cluster, "miss").Inc()
+		return d.refresh(apiVersion, "expired", entry.fetched, fetch)
+	}
+
+	discoveryCacheCounter.WithLabelValues(d.cluster, "hit").Inc()
+	return &entry.resources, nil
+}
+
+// resource returns the API resource of a kind. If the kind isn't found, the API Version is fetched again, unless it was just fetched.
+func (d *discoveryCache) resource(apiVersion string, kind string, fetch discoveryFetcher) (*metav1.APIResource, error) {
+	resources, err := d.resources(apiVersion, fetch)
+	if err != nil {
+		return nil, err
+	}
+	if apiResource := findAPIResource(resources, kind); apiResource != nil {
+		return apiResource, nil
+	}
+
+	// Another lookup might have fetched the API Version since
+	if entry, exists := d.entry(apiVersion); !exists || d.now().Sub(entry.fetched) >= minDiscoveryRefreshInterval {
+		if resources, err = d.refresh(apiVersion, "kind_not_found", entry.fetched, fetch); err != nil {
+			return nil, err
+		}
+	} else {
+		resources = &entry.resources
+	}
+
+	if apiResource := findAPIResource(resources, kind); apiResource != nil {
+		return apiResource, nil
+	}
+	return nil, fmt.Errorf("Kind '%s' was not found in API Version '%s'", kind, apiVersion)
+}
+
+// refresh fetches an API Version and caches it. The fetched time is when the API Version that the caller found was fetched, or zero if it wasn't cached.
+// If the API Version was fetched again since, it is returned without fetching it, and if it is being fetched, the result of that fetch is returned.
+func (d *discoveryCache) refresh(apiVersion string, reason string, fetched time.Time, fetch discoveryFetcher) (*metav1.APIResourceList, error) {
+	d.mutex.Lock()
+	if entry, exists := d.groupVersions[apiVersion]; exists && !entry.fetched.Equal(fetched) {
+		d.mutex.Unlock()
+		return &entry.resources, nil
+	}
+	call, inFlight := d.fetches[apiVersion]
+	if !inFlight {
+		call = &discoveryFetch{done: make(chan struct{})}
+		d.fetches[apiVersion] = call
+	}
+	d.mutex.Unlock()
+
+	if inFlight {
+		<-call.done
+		return call.resources, call.err
+	}
+
+	call.resources, call.err = d.fetch(apiVersion, reason, fetch)
+	close(call.done)
+	return call.resources, call.err
+}
+
+// fetch fetches an API Version without holding the mutex, and then caches it. If the fetch fails, an API Version that is still cached is returned as is.
+func (d *discoveryCache) fetch(apiVersion string, reason string, fetch discoveryFetcher) (*metav1.APIResourceList, error) {
+	resources, err := fetch(apiVersion)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.fetches, apiVersion)
+
+	if err != nil {
+		discoveryRefreshCounter.WithLabelValues(d.cluster, reason, "error").Inc()
+
+		entry, exists := d.groupVersions[apiVersion]
+		if apierrors.IsNotFound(err) || !exists {
+			// The API Version was removed, such as by deleting its CustomResourceDefinitions
+			delete(d.groupVersions, apiVersion)
+			return nil, err
+		}
+
+		logger.Warningf("Error discovering the API resources of %s, so the cached API resources are used: %s", apiVersion, err.Error())
+		return &entry.resources, nil
+	}
+
+	discoveryRefreshCounter.WithLabelValues(d.cluster, reason, "success").Inc()
+	d.groupVersions[apiVersion] = discoveryEntry{*resources, d.now()}
+	return resources, nil
+}
+
+// findAPIResource returns the API resource of a kind in an API resource list, or nil
+func findAPIResource(resources *metav1.APIResourceList, kind string) *metav1.APIResource {
+	for i := range resources.APIResources {
+		if strings.EqualFold(resources.APIResources[i].Kind, kind) {
+			apiResource := resources.APIResources[i]
+			return &apiResource
+		}
+	}
+	return nil
+}
+
+// apiGroups returns the API groups, fetching them if they aren't cached or have expired.
+// If refresh is true, such as when a group or resource wasn't found in them, they are fetched again unless they were just fetched.
+// If the fetch fails, the cached API groups are still used.
+func (d *discoveryCache) apiGroups(refresh bool, fetch apiGroupsFetcher) (*metav1.APIGroupList, error) {
+	d.mutex.Lock()
+	groups, fetched := d.groups, d.groupsFetched
+	d.mutex.Unlock()
+
+	now := d.now()
+	if groups != nil && (d.ttl <= 0 || now.Sub(fetched) < d.ttl) && (!refresh || now.Sub(fetched) < minDiscoveryRefreshInterval) {
+		return groups, nil
+	}
+
+	// The API groups are fetched without holding the mutex. Concurrent fetches are rare, and any of their results can be kept.
+	fetchedGroups, err := fetch()
+	if err != nil {
+		if groups == nil {
+			return nil, err
+		}
+		logger.Warningf("Error discovering the API groups, so the cached API groups are used: %s", err.Error())
+		return groups, nil
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.groups, d.groupsFetched = fetchedGroups, d.now()
+	return fetchedGroups, nil
+}
@@ -0,0 +1,238 @@
+package kubernetes
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+// fakeDiscovery serves API resource lists, and counts how often each API Version is fetched
+type fakeDiscovery struct {
+	mutex   sync.Mutex
+	lists   map[string]metav1.APIResourceList
+	err     error
+	fetches map[string]int
+}
+
+func (f *fakeDiscovery) fetch(apiVersion string) (*metav1.APIResourceList, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.fetches[apiVersion]++
+	if f.err != nil {
+		return nil, f.err
+	}
+	list, exists := f.lists[apiVersion]
+	if !exists {
+		return nil, apierrors.NewNotFound(schema.GroupResource{}, apiVersion)
+	}
+	return &list, nil
+}
+
+func (f *fakeDiscovery) setKinds(apiVersion string, kinds ...string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	list := metav1.APIResourceList{GroupVersion: apiVersion}
+	for _, kind := range kinds {
+		list.APIResources = append(list.APIResources, metav1.APIResource{Kind: kind, Namespaced: true})
+	}
+	f.lists[apiVersion] = list
+}
+
+func TestDiscoveryCache(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	discovery := &fakeDiscovery{lists: make(map[string]metav1.APIResourceList), fetches: make(map[string]int)}
+	discovery.setKinds("example.com/v1", "Widget")
+
+	cache := newDiscoveryCache("discovery-test", time.Minute)
+	cache.now = func() time.Time { return now }
+
+	lookup := func(apiVersion string, kind string) error {
+		_, err := cache.resource(apiVersion, kind, discovery.fetch)
+		return err
+	}
+
+	// The API Version is fetched once, then cached
+	for i := 0; i < 3; i++ {
+		if err := lookup("example.com/v1", "Widget"); err != nil {
+			t.Fatalf("Expected Widget to be found: %s", err.Error())
+		}
+	}
+	if discovery.fetches["example.com/v1"] != 1 {
+		t.Errorf("Expected example.com/v1 to be fetched once, but it was fetched %d times", discovery.fetches["example.com/v1"])
+	}
+	if hits := testutil.ToFloat64(discoveryCacheCounter.WithLabelValues("discovery-test", "hit")); hits != 2 {
+		t.Errorf("Expected 2 cache hits, but received %v", hits)
+	}
+
+	// A kind installed after the API Version was cached is found by fetching the API Version again
+	discovery.setKinds("example.com/v1", "Widget", "Gadget")
+	if err := lookup("example.com/v1", "Gadget"); err == nil {
+		t.Errorf("Expected Gadget not to be fetched again right after example.com/v1 was fetched")
+	}
+	now = now.Add(minDiscoveryRefreshInterval)
+	if err := lookup("example.com/v1", "Gadget"); err != nil {
+		t.Errorf("Expected Gadget to be found after a refresh: %s", err.Error())
+	}
+	if refreshes := testutil.ToFloat64(discoveryRefreshCounter.WithLabelValues("discovery-test", "kind_not_found", "success")); refreshes != 1 {
+		t.Errorf("Expected 1 refresh for a kind that wasn't found, but received %v", refreshes)
+	}
+
+	// An expired API Version is fetched again, and is still used if the fetch fails
+	now = now.Add(time.Minute)
+	discovery.err = errors.New("the server is currently unable to handle the request")
+	if err := lookup("example.com/v1", "Widget"); err != nil {
+		t.Errorf("Expected the cached Widget to be used when discovery fails: %s", err.Error())
+	}
+	if refreshes := testutil.ToFloat64(discoveryRefreshCounter.WithLabelValues("discovery-test", "expired", "error")); refreshes != 1 {
+		t.Errorf("Expected 1 failed refresh of an expired API Version, but received %v", refreshes)
+	}
+
+	// An API Version that was removed is no longer cached
+	discovery.err = nil
+	delete(discovery.lists, "example.com/v1")
+	if err := lookup("example.com/v1", "Widget"); !apierrors.IsNotFound(err) {
+		t.Errorf("Expected a not found error for the removed API Version, but received %v", err)
+	}
+	if _, exists := cache.groupVersions["example.com/v1"]; exists {
+		t.Errorf("Expected the removed API Version not to be cached")
+	}
+}
+
+func TestDiscoveryCacheConcurrency(t *testing.T) {
+	discovery := &fakeDiscovery{lists: make(map[string]metav1.APIResourceList), fetches: make(map[string]int)}
+	discovery.setKinds("v1", "ConfigMap", "Secret")
+	discovery.setKinds("apps/v1", "Deployment")
+
+	cache := newDiscoveryCache("", 0)
+
+	var wait sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			apiVersion, kind := "v1", "ConfigMap"
+			if i%2 == 0 {
+				apiVersion, kind = "apps/v1", "Deployment"
+			}
+			if _, err := cache.resource(apiVersion, kind, discovery.fetch); err != nil {
+				t.Errorf("Expected %s %s to be found: %s", apiVersion, kind, err.Error())
+			}
+		}(i)
+	}
+	wait.Wait()
+
+	if discovery.fetches["v1"] != 1 || discovery.fetches["apps/v1"] != 1 {
+		t.Errorf("Expected each API Version to be fetched once, but received %v", discovery.fetches)
+	}
+}
+
+func TestDiscoveryCacheSlowFetch(t *testing.T) {
+	discovery := &fakeDiscovery{lists: make(map[string]metav1.APIResourceList), fetches: make(map[string]int)}
+	discovery.setKinds("v1", "ConfigMap")
+	discovery.setKinds("example.com/v1", "Widget")
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fetch := func(apiVersion string) (*metav1.APIResourceList, error) {
+		if apiVersion == "example.com/v1" {
+			close(started)
+			<-release
+		}
+		return discovery.fetch(apiVersion)
+	}
+
+	cache := newDiscoveryCache("", 0)
+
+	var wait sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			if _, err := cache.resource("example.com/v1", "Widget", fetch); err != nil {
+				t.Errorf("Expected Widget to be found: %s", err.Error())
+			}
+		}()
+	}
+
+	// Other API Versions are looked up while example.com/v1 is being fetched
+	<-started
+	if _, err := cache.resource("v1", "ConfigMap", fetch); err != nil {
+		t.Errorf("Expected ConfigMap to be found: %s", err.Error())
+	}
+
+	close(release)
+	wait.Wait()
+
+	if discovery.fetches["example.com/v1"] != 1 {
+		t.Errorf("Expected the concurrent lookups to share a single fetch, but example.com/v1 was fetched %d times", discovery.fetches["example.com/v1"])
+	}
+}
+
+func TestSweepDiscoveryCache(t *testing.T) {
+	var mutex sync.Mutex
+	requests := make(map[string]int)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		requests[request.Method+" "+request.URL.Path]++
+		writer.Header().Set("Content-Type", "application/json")
+		switch request.URL.Path {
+		case "/api":
+			writer.Write([]byte(`{"kind":"APIVersions","versions":["v1"]}`))
+		case "/apis":
+			writer.Write([]byte(`{"kind":"APIGroupList","apiVersion":"v1","groups":[{"name":"metrics.example.com",` +
+				`"versions":[{"groupVersion":"metrics.example.com/v1beta1","version":"v1beta1"}],` +
+				`"preferredVersion":{"groupVersion":"metrics.example.com/v1beta1","version":"v1beta1"}}]}`))
+		case "/api/v1":
+			writer.Write([]byte(`{"kind":"APIResourceList","groupVersion":"v1","resources":[` +
+				`{"name":"configmaps","kind":"ConfigMap","namespaced":true,"verbs":["get","list","delete"]},` +
+				`{"name":"pods/log","kind":"Pod","namespaced":true,"verbs":["get"]}]}`))
+		case "/apis/metrics.example.com/v1beta1":
+			// An unavailable aggregated API
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			writer.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","code":503}`))
+		case "/api/v1/namespaces/preview/configmaps":
+			writer.Write([]byte(`{"apiVersion":"v1","kind":"ConfigMapList","items":[{"metadata":{"name":"settings","namespace":"preview"}}]}`))
+		default:
+			writer.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := newClient("sweep-test", &rest.Config{Host: server.URL}, ClientOptions{DiscoveryCacheTTL: time.Hour})
+	if err != nil {
+		t.Fatalf("Expected a client: %s", err.Error())
+	}
+
+	selector := metav1.LabelSelector{MatchLabels: map[string]string{"azdPullRequestId": "12"}}
+	for i := 0; i < 2; i++ {
+		results, err := client.Sweep("preview", "", selector, SweepOptions{}, DeleteOptions{})
+		if err != nil {
+			t.Fatalf("Expected the sweep to succeed without the unavailable API group: %s", err.Error())
+		}
+		if len(results) != 1 || results[0].Kind != "ConfigMap" || results[0].Deleted != 1 {
+			t.Errorf("Expected 1 ConfigMap to be deleted, but received %v", results)
+		}
+	}
+
+	// The API resources come from the discovery cache, while the API groups are listed for every sweep
+	if requests["GET /api/v1"] != 1 || requests["GET /apis"] != 2 {
+		t.Errorf("Expected the API resources to be cached, but received the requests %v", requests)
+	}
+	if misses := testutil.ToFloat64(discoveryCacheCounter.WithLabelValues("sweep-test", "miss")); misses != 3 {
+		t.Errorf("Expected a discovery cache miss for v1, and for each sweep of the unavailable API group, but received %f", misses)
+	}
+}
@@ -0,0 +1,103 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/client-go/rest"
+)
+
+// ChangeAction is the type of change made to a resource
+type ChangeAction string
+
+const (
+	// ChangeActionCreate is a resource that is created
+	ChangeActionCreate ChangeAction = "create"
+	// ChangeActionUpdate is an existing resource that the applied resource is merged into with a patch
+	ChangeActionUpdate ChangeAction = "update"
+	// ChangeActionPatch is a resource that is patched
+	ChangeActionPatch ChangeAction = "patch"
+	// ChangeActionScale is a resource whose scale subresource is updated
+	ChangeActionScale ChangeAction = "scale"
+	// ChangeActionDelete is a resource that is deleted
+	ChangeActionDelete ChangeAction = "delete"
+)
+
+// Change is a change that would have been made to a resource in dry run mode
+type Change struct {
+	Action     ChangeAction
+	APIVersion string
+	Kind       string
+	Namespace  string
+	Name       string
+
+	// The named cluster of the resource. The default cluster is "".
+	Cluster string
+}
+
+// DryRunClient is a Client that sends every change with server-side dry run, so that nothing is persisted
+type DryRunClient interface {
+	Client
+
+	// Changes returns the changes that would have been made
+	Changes() []Change
+}
+
+// DryRunClientImpl is the interface implementation of DryRunClient
+type DryRunClientImpl struct {
+	ClientImpl
+}
+
+// changeLog records the changes made in dry run mode
+type changeLog struct {
+	mutex   sync.Mutex
+	changes []Change
+}
+
+// Describe returns a user-friendly representation of a Change
+func (c Change) Describe() string {
+	description := fmt.Sprintf("%s %s %s %s/%s", c.Action, c.APIVersion, c.Kind, c.Namespace, c.Name)
+	if c.Namespace == "" {
+		description = fmt.Sprintf("%s %s %s %s", c.Action, c.APIVersion, c.Kind, c.Name)
+	}
+	if c.Cluster != "" {
+		description = fmt.Sprintf("%s on cluster %s", description, c.Cluster)
+	}
+	return description
+}
+
+// DryRun returns a copy of the client in dry run mode
+func (c ClientImpl) DryRun() DryRunClient {
+	c.dryRun = &changeLog{}
+	return DryRunClientImpl{c}
+}
+
+// Changes returns the changes that would have been made
+func (c DryRunClientImpl) Changes() []Change {
+	c.dryRun.mutex.Lock()
+	defer c.dryRun.mutex.Unlock()
+
+	return append([]Change{}, c.dryRun.changes...)
+}
+
+// withDryRun adds the dryRun parameter to a request that changes a resource, if the client is in dry run mode
+func (c ClientImpl) withDryRun(request *rest.Request) *rest.Request {
+	if c.dryRun == nil {
+		return request
+	}
+	return request.Param("dryRun", "All")
+}
+
+// recordDryRun records and logs a change if the client is in dry run mode. This function returns false outside of dry run mode.
+func (c ClientImpl) recordDryRun(change Change) bool {
+	if c.dryRun == nil {
+		return false
+	}
+
+	c.dryRun.mutex.Lock()
+	defer c.dryRun.mutex.Unlock()
+
+	logger.Infof("Dry run: would %s", change.Describe())
+	c.dryRun.changes = append(c.dryRun.changes, change)
+	return true
+}
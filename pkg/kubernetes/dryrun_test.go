@@ -0,0 +1,58 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+)
+
+func TestDryRun(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		requests = append(requests, fmt.Sprintf("%s %s?%s", request.Method, request.URL.Path, request.URL.RawQuery))
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	client := ClientImpl{config: &rest.Config{Host: server.URL}, apiResources: newDiscoveryCache("", 0)}
+	client.apiResources.store(metav1.APIResourceList{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}},
+	})
+	dryRunClient := client.DryRun()
+
+	if err := dryRunClient.Patch("v1", "ConfigMap", "preview", "settings", metav1.LabelSelector{}, types.MergePatchType, []byte("{}")); err != nil {
+		t.Fatalf("Expected the patch to succeed: %s", err.Error())
+	}
+
+	if strings.Join(requests, "\n") != "PATCH /api/v1/namespaces/preview/configmaps/settings?dryRun=All" {
+		t.Errorf("Expected a server-side dry run patch, but received:\n%s", strings.Join(requests, "\n"))
+	}
+
+	changes := dryRunClient.Changes()
+	if len(changes) != 1 || changes[0].Describe() != "patch v1 ConfigMap preview/settings" {
+		t.Errorf("Expected the patch to be recorded, but received %v", changes)
+	}
+
+	// The original client is not in dry run mode
+	requests = nil
+	if err := client.Patch("v1", "ConfigMap", "preview", "settings", metav1.LabelSelector{}, types.MergePatchType, []byte("{}")); err != nil {
+		t.Fatalf("Expected the patch to succeed: %s", err.Error())
+	}
+	if strings.Join(requests, "\n") != "PATCH /api/v1/namespaces/preview/configmaps/settings?" {
+		t.Errorf("Expected a patch without dry run, but received:\n%s", strings.Join(requests, "\n"))
+	}
+}
@@ -0,0 +1,257 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	retryCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "azd_kubernetes_manager_request_retry_count",
+		Help: "The total number of Kubernetes changes retried after a transient error, by the HTTP status code of the error",
+	}, []string{"code"})
+)
+
+// executor runs the changes of bulk operations on a bounded number of workers, and retries the changes that fail with a transient error.
+// It is shared by the clients of every cluster, so that concurrent Service Hooks can't make more changes at once than the bound.
+// A nil executor runs every change at once, without retries.
+type executor struct {
+	// Holds a token for each change that is running
+	slots chan struct{}
+
+	// The number of times a change is retried
+	retries int
+
+	// The delay before the first retry, which doubles with each retry
+	backoff time.Duration
+
+	// The maximum delay between retries
+	maxBackoff time.Duration
+}
+
+// newExecutor returns an executor that runs at most the given number of changes at once
+func newExecutor(concurrency int, retries int) *executor {
+	return &executor{
+		slots:      make(chan struct{}, concurrency),
+		retries:    retries,
+		backoff:    500 * time.Millisecond,
+		maxBackoff: 30 * time.Second,
+	}
+}
+
+// run executes a change on every resource, and aggregates the errors in the order of the resources.
+// Changes must not start other bulk operations, since they would wait for the workers of the change.
+func (e *executor) run(resources []Resource, description string, change func(Resource) error) error {
+	return aggregateErrors(description, e.runEach(resources, change))
+}
+
+// runEach executes a change on every resource like run, and returns the error of each resource
+func (e *executor) runEach(resources []Resource, change func(Resource) error) []error {
+	if e == nil {
+		return forEachResource(resources, change)
+	}
+
+	return e.forEach(resources, func(resource Resource) error {
+		return e.retry(func() error {
+			// The slot is released while waiting to retry, so that the backoff doesn't hold up other changes
+			e.slots <- struct{}{}
+			defer func() { <-e.slots }()
+			return change(resource)
+		})
+	})
+}
+
+// poll executes a read-only action, such as waiting for a resource to be deleted, on every resource.
+// At most as many resources are polled at once as there are slots, but the slots aren't taken, so that long waits don't hold up changes.
+func (e *executor) poll(resources []Resource, description string, action func(Resource) error) error {
+	return aggregateErrors(description, e.pollEach(resources, action))
+}
+
+// pollEach executes a read-only action on every resource like poll, and returns the error of each resource
+func (e *executor) pollEach(resources []Resource, action func(Resource) error) []error {
+	if e == nil {
+		return forEachResource(resources, action)
+	}
+
+	return e.forEach(resources, action)
+}
+
+// forEach executes an action on every resource with at most as many workers as there are slots, and returns the error of each resource
+func (e *executor) forEach(resources []Resource, action func(Resource) error) []error {
+	return e.forEachIndex(len(resources), func(i int) error {
+		return action(resources[i])
+	})
+}
+
+// forEachIndex executes an action for every index up to the count with at most as many workers as there are slots, and returns the error of each index
+func (e *executor) forEachIndex(count int, action func(int) error) []error {
+	workers := cap(e.slots)
+	if workers > count {
+		workers = count
+	}
+
+	indexes := make(chan int, count)
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+	close(indexes)
+
+	results := make([]error, count)
+	var wait sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for i := range indexes {
+				results[i] = action(i)
+			}
+		}()
+	}
+	wait.Wait()
+
+	return results
+}
+
+// ForEachNamespace executes an action in every namespace, such as the namespaces of a namespace selector, and returns the error of each namespace in the order of the namespaces.
+// At most as many namespaces are handled at once as there are workers for bulk changes, but the workers aren't taken, so that the action can make bulk changes.
+func (c ClientImpl) ForEachNamespace(namespaces []string, action func(namespace string) error) []error {
+	namespaceAction := func(i int) error {
+		return action(namespaces[i])
+	}
+	if c.executor == nil {
+		return forEachIndex(len(namespaces), namespaceAction)
+	}
+	return c.executor.forEachIndex(len(namespaces), namespaceAction)
+}
+
+// retry executes a change, and executes it again with exponential backoff while it fails with a transient error
+func (e *executor) retry(change func() error) error {
+	delay := e.backoff
+	for attempt := 0; ; attempt++ {
+		err := change()
+		if err == nil || attempt >= e.retries {
+			return err
+		}
+
+		code, retryAfter, retryable := transientError(err)
+		if !retryable {
+			return err
+		}
+
+		wait := delay
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if wait > e.maxBackoff {
+			wait = e.maxBackoff
+		}
+
+		retryCounter.WithLabelValues(strconv.Itoa(int(code))).Inc()
+		logger.Warningf("Retrying in %s after a transient error: %s", wait.String(), err.Error())
+		time.Sleep(wait)
+
+		delay *= 2
+	}
+}
+
+// transientError returns whether an error is a Kubernetes API error that can be retried: a rate limit, a conflict, or a server error.
+// This function also returns the HTTP status code and the delay suggested by the server.
+func transientError(err error) (int32, time.Duration, bool) {
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		return 0, 0, false
+	}
+
+	var retryAfter time.Duration
+	if seconds, suggested := apierrors.SuggestsClientDelay(status.(error)); suggested {
+		retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	// AlreadyExists is also a 409, but trying to create the resource again can't succeed
+	code := status.Status().Code
+	retryable := code == 429 || code >= 500 || status.Status().Reason == metav1.StatusReasonConflict
+	return code, retryAfter, retryable
+}
+
+// forEachResource executes an action on every resource in parallel, and returns the error of each resource
+func forEachResource(resources []Resource, action func(Resource) error) []error {
+	return forEachIndex(len(resources), func(i int) error {
+		return action(resources[i])
+	})
+}
+
+// forEachIndex executes an action for every index up to the count in parallel, and returns the error of each index
+func forEachIndex(count int, action func(int) error) []error {
+	results := make([]error, count)
+	var wait sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			results[i] = action(i)
+		}(i)
+	}
+	wait.Wait()
+
+	return results
+}
+
+// aggregateErrors combines the errors of a bulk operation, in the order of its resources
+func aggregateErrors(description string, results []error) error {
+	var errors []string
+	for _, err := range results {
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("- %s", strings.ReplaceAll(err.Error(), "\n", "\n  ")))
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("%s:\n%s", description, strings.Join(errors, "\n"))
+	}
+
+	return nil
+}
+
+// aggregateNamespaceErrors combines the errors of a bulk operation on the resources of several namespaces, such as the namespaces of a namespace selector.
+// The errors are grouped by namespace, in the order of the namespaces, so that each namespace is reported separately.
+// If no namespaces are given, the errors are combined like aggregateErrors.
+func aggregateNamespaceErrors(description string, namespaces []string, resources []Resource, results []error) error {
+	if len(namespaces) == 0 {
+		return aggregateErrors(description, results)
+	}
+
+	// Resources outside of the given namespaces are reported after them
+	ordered := append([]string{}, namespaces...)
+	namespaceResults := make(map[string][]error)
+	for _, namespace := range namespaces {
+		namespaceResults[namespace] = nil
+	}
+	for i, resource := range resources {
+		if _, exists := namespaceResults[resource.Namespace]; !exists {
+			ordered = append(ordered, resource.Namespace)
+		}
+		namespaceResults[resource.Namespace] = append(namespaceResults[resource.Namespace], results[i])
+	}
+
+	var errors []string
+	for _, namespace := range ordered {
+		if err := aggregateErrors(description, namespaceResults[namespace]); err != nil {
+			errors = append(errors, fmt.Sprintf("- Namespace %s: %s", namespace, strings.ReplaceAll(err.Error(), "\n", "\n  ")))
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("Errors in %d of %d namespaces:\n%s", len(errors), len(ordered), strings.Join(errors, "\n"))
+	}
+
+	return nil
+}
@@ -0,0 +1,393 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+func newTestResources(count int) []Resource {
+	var resources []Resource
+	for i := 0; i < count; i++ {
+		resources = append(resources, Resource{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("resource-%d", i)}})
+	}
+	return resources
+}
+
+func TestExecutorConcurrency(t *testing.T) {
+	executor := newExecutor(2, 0)
+
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	change := func(resource Resource) error {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+
+		if resource.Name == "resource-1" || resource.Name == "resource-7" {
+			return fmt.Errorf("Error changing %s", resource.Name)
+		}
+		return nil
+	}
+
+	// The bound is shared by concurrent bulk operations
+	errors := make([]error, 2)
+	var wait sync.WaitGroup
+	for i := range errors {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			errors[i] = executor.run(newTestResources(10), "Errors changing resources", change)
+		}(i)
+	}
+	wait.Wait()
+
+	if maxRunning != 2 {
+		t.Errorf("Expected at most 2 changes at once, but %d ran at once", maxRunning)
+	}
+	for _, err := range errors {
+		expected := "Errors changing resources:\n- Error changing resource-1\n- Error changing resource-7"
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected the errors in the order of the resources, but received: %v", err)
+		}
+	}
+}
+
+func TestExecutorBackoffReleasesSlot(t *testing.T) {
+	executor := newExecutor(1, 1)
+	executor.backoff = 200 * time.Millisecond
+
+	conflict := apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "settings", fmt.Errorf("the object has been modified"))
+	events := make(chan string, 3)
+	failed := make(chan struct{})
+	attempts := 0
+
+	done := make(chan error)
+	go func() {
+		done <- executor.run(newTestResources(1), "Errors changing resources", func(resource Resource) error {
+			attempts++
+			if attempts == 1 {
+				events <- "conflict"
+				close(failed)
+				return conflict
+			}
+			events <- "retried"
+			return nil
+		})
+	}()
+
+	// Another bulk operation runs while the first one waits to retry, even though there is a single slot
+	<-failed
+	if err := executor.run(newTestResources(1), "Errors changing resources", func(resource Resource) error {
+		events <- "other"
+		return nil
+	}); err != nil {
+		t.Errorf("Expected the other change to succeed: %s", err.Error())
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected the retried change to succeed: %s", err.Error())
+	}
+
+	close(events)
+	var order []string
+	for event := range events {
+		order = append(order, event)
+	}
+	if strings.Join(order, ",") != "conflict,other,retried" {
+		t.Errorf("Expected the other change to run during the backoff, but received %v", order)
+	}
+}
+
+func TestExecutorPoll(t *testing.T) {
+	executor := newExecutor(2, 0)
+
+	// Polling doesn't need a slot, so it isn't held up by changes
+	for i := 0; i < cap(executor.slots); i++ {
+		executor.slots <- struct{}{}
+	}
+
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	err := executor.poll(newTestResources(6), "Errors waiting for resources", func(resource Resource) error {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Expected polling to succeed: %s", err.Error())
+	}
+	if maxRunning != 2 {
+		t.Errorf("Expected at most 2 resources to be polled at once, but %d were polled at once", maxRunning)
+	}
+}
+
+func TestForEachNamespace(t *testing.T) {
+	client := ClientImpl{executor: newExecutor(2, 0)}
+	namespaces := []string{"team-a", "team-b", "team-c", "team-d", "team-e", "team-f"}
+
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	results := client.ForEachNamespace(namespaces, func(namespace string) error {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+
+		// The namespaces don't take the slots, so their changes can still run
+		err := client.executor.run(newTestResources(2), "Errors changing resources", func(resource Resource) error {
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		})
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+
+		if err == nil && namespace == "team-c" {
+			err = fmt.Errorf("Error in namespace %s", namespace)
+		}
+		return err
+	})
+
+	if maxRunning != 2 {
+		t.Errorf("Expected at most 2 namespaces to run at once, but %d ran at once", maxRunning)
+	}
+	for i, err := range results {
+		if (err != nil) != (namespaces[i] == "team-c") {
+			t.Errorf("Expected only the error of namespace team-c in its position, but received %v", results)
+		}
+	}
+}
+
+func TestExecutorRetry(t *testing.T) {
+	conflict := apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "settings", fmt.Errorf("the object has been modified"))
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+	}{
+		{"conflict", conflict, 3},
+		{"wrapped_conflict", fmt.Errorf("Error patching v1 ConfigMap settings: %w", conflict), 3},
+		{"too_many_requests", apierrors.NewTooManyRequests("slow down", 0), 3},
+		{"internal_error", apierrors.NewInternalError(fmt.Errorf("etcd is unavailable")), 3},
+		{"already_exists", apierrors.NewAlreadyExists(schema.GroupResource{Resource: "configmaps"}, "settings"), 1},
+		{"not_found", apierrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, "settings"), 1},
+		{"not_an_api_error", fmt.Errorf("Error parsing the source"), 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			executor := newExecutor(1, 2)
+			executor.backoff = time.Millisecond
+
+			attempts := 0
+			err := executor.retry(func() error {
+				attempts++
+				return test.err
+			})
+			if err != test.err {
+				t.Errorf("Expected the last error to be returned, but received: %v", err)
+			}
+			if attempts != test.attempts {
+				t.Errorf("Expected %d attempts, but there were %d", test.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestDeleteRetries(t *testing.T) {
+	var mutex sync.Mutex
+	attempts := make(map[string]int)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		attempts[request.URL.Path]++
+		writer.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(request.URL.Path, "/flaky") && attempts[request.URL.Path] == 1 {
+			writer.WriteHeader(http.StatusConflict)
+			writer.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"Conflict","code":409}`))
+			return
+		} else if strings.HasSuffix(request.URL.Path, "/broken") {
+			writer.WriteHeader(http.StatusBadGateway)
+			writer.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","code":502}`))
+			return
+		}
+		writer.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+	}))
+	defer server.Close()
+
+	client := ClientImpl{config: &rest.Config{Host: server.URL}, apiResources: newDiscoveryCache("", 0), executor: newExecutor(2, 1)}
+	client.executor.backoff = time.Millisecond
+	apiResource := &metav1.APIResource{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}
+	resources := []Resource{
+		Resource{ObjectMeta: metav1.ObjectMeta{Namespace: "preview", Name: "flaky"}},
+		Resource{ObjectMeta: metav1.ObjectMeta{Namespace: "preview", Name: "broken"}},
+		Resource{ObjectMeta: metav1.ObjectMeta{Namespace: "preview", Name: "settings"}},
+	}
+
+	err := client.deleteResources("v1", apiResource, resources, DeleteOptions{})
+	if err == nil || strings.Contains(err.Error(), "flaky") || !strings.Contains(err.Error(), "Error deleting v1 ConfigMap preview/broken") {
+		t.Errorf("Expected only the broken ConfigMap to fail, but received: %v", err)
+	}
+
+	expected := map[string]int{
+		"/api/v1/namespaces/preview/configmaps/flaky":    2,
+		"/api/v1/namespaces/preview/configmaps/broken":   2,
+		"/api/v1/namespaces/preview/configmaps/settings": 1,
+	}
+	for path, count := range expected {
+		if attempts[path] != count {
+			t.Errorf("Expected %d requests to %s, but there were %d", count, path, attempts[path])
+		}
+	}
+}
+
+func TestDeleteWaitsShareTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "application/json")
+		if request.Method == http.MethodDelete {
+			writer.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+			return
+		}
+		// The ConfigMaps are never deleted
+		name := request.URL.Path[strings.LastIndex(request.URL.Path, "/")+1:]
+		writer.Write([]byte(fmt.Sprintf(`{"kind":"ConfigMap","apiVersion":"v1","metadata":{"namespace":"preview","name":"%s"}}`, name)))
+	}))
+	defer server.Close()
+
+	apiResource := metav1.APIResource{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}
+	// Requests aren't rate limited, so only the waits take time
+	client := ClientImpl{config: &rest.Config{Host: server.URL, QPS: 1000, Burst: 1000}, apiResources: newDiscoveryCache("", 0), executor: newExecutor(1, 0)}
+	client.apiResources.groupVersions["v1"] = discoveryEntry{
+		resources: metav1.APIResourceList{GroupVersion: "v1", APIResources: []metav1.APIResource{apiResource}},
+		fetched:   time.Now(),
+	}
+
+	resources := newTestResources(4)
+	for i := range resources {
+		resources[i].Namespace = "preview"
+	}
+
+	waitTimeout := 200 * time.Millisecond
+	start := time.Now()
+	err := client.deleteResources("v1", &apiResource, resources, DeleteOptions{Wait: true, WaitTimeout: waitTimeout, PollInterval: 20 * time.Millisecond})
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("Expected the waits to time out")
+	}
+	for _, resource := range resources {
+		if !strings.Contains(err.Error(), resource.Name) {
+			t.Errorf("Expected the timeout of %s to be reported, but received: %v", resource.Name, err)
+		}
+	}
+	// One wait at a time: without a shared deadline, the waits would take 4 times the wait timeout
+	if elapsed > 2*waitTimeout {
+		t.Errorf("Expected the waits to take about %s in total, but they took %s", waitTimeout, elapsed)
+	}
+}
+
+func TestDeleteAcrossNamespaces(t *testing.T) {
+	var mutex sync.Mutex
+	var deleted []string
+	failing := ""
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		writer.Header().Set("Content-Type", "application/json")
+		if request.Method == http.MethodDelete && failing != "" && strings.HasPrefix(request.URL.Path, "/api/v1/namespaces/"+failing+"/") {
+			writer.WriteHeader(http.StatusForbidden)
+			writer.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"Forbidden","code":403}`))
+			return
+		} else if request.Method == http.MethodDelete {
+			deleted = append(deleted, request.URL.Path)
+			writer.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+			return
+		}
+		// Each namespace has the ConfigMaps of two builds
+		namespace := strings.Split(request.URL.Path, "/")[4]
+		builds := map[string][]string{"team-a": []string{"1", "4"}, "team-b": []string{"2", "3"}}[namespace]
+		var items []string
+		for _, build := range builds {
+			items = append(items, fmt.Sprintf(`{"metadata":{"namespace":"%s","name":"build-%s","labels":{"build":"%s"}}}`, namespace, build, build))
+		}
+		writer.Write([]byte(`{"apiVersion":"v1","kind":"ConfigMapList","items":[` + strings.Join(items, ",") + `]}`))
+	}))
+	defer server.Close()
+
+	apiResource := metav1.APIResource{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}
+	client := ClientImpl{config: &rest.Config{Host: server.URL}, apiResources: newDiscoveryCache("", 0), executor: newExecutor(2, 0)}
+	client.apiResources.groupVersions["v1"] = discoveryEntry{
+		resources: metav1.APIResourceList{GroupVersion: "v1", APIResources: []metav1.APIResource{apiResource}},
+		fetched:   time.Now(),
+	}
+	selector := metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "build", Operator: metav1.LabelSelectorOpExists}}}
+
+	// The limit counts the resources of every namespace
+	limit := 3
+	err := client.Delete("v1", "ConfigMap", "", "", selector, DeleteOptions{Namespaces: []string{"team-a", "team-b"}, Limit: &limit})
+	if err == nil || !strings.Contains(err.Error(), "4 resources matched") {
+		t.Errorf("Expected the limit to be exceeded, but received: %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("Expected nothing to be deleted, but received %v", deleted)
+	}
+
+	// The newest builds are retained across the namespaces
+	err = client.Delete("v1", "ConfigMap", "", "", selector, DeleteOptions{Namespaces: []string{"team-a", "team-b"}, Retain: &RetentionPolicy{Count: 2, Label: "build"}})
+	if err != nil {
+		t.Fatalf("Expected the delete to succeed: %s", err.Error())
+	}
+	sort.Strings(deleted)
+	expected := []string{"/api/v1/namespaces/team-a/configmaps/build-1", "/api/v1/namespaces/team-b/configmaps/build-2"}
+	if strings.Join(deleted, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v to be deleted, but received %v", expected, deleted)
+	}
+
+	// The errors of each namespace are reported separately
+	deleted, failing = nil, "team-b"
+	err = client.Delete("v1", "ConfigMap", "", "", selector, DeleteOptions{Namespaces: []string{"team-a", "team-b"}})
+	if err == nil || !strings.HasPrefix(err.Error(), "Errors in 1 of 2 namespaces:\n- Namespace team-b: ") || strings.Contains(err.Error(), "team-a") {
+		t.Errorf("Expected only namespace team-b to fail, but received: %v", err)
+	} else if !strings.Contains(err.Error(), "Error deleting v1 ConfigMap team-b/build-2") || !strings.Contains(err.Error(), "Error deleting v1 ConfigMap team-b/build-3") {
+		t.Errorf("Expected the namespace of each failed ConfigMap to be reported, but received: %v", err)
+	}
+	if len(deleted) != 2 {
+		t.Errorf("Expected the ConfigMaps of namespace team-a to be deleted, but received %v", deleted)
+	}
+}
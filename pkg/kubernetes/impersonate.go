@@ -0,0 +1,80 @@
+package kubernetes
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+
+	k8s "k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// impersonationCache holds the config and clientset of every identity that a cluster's client impersonates, so that they are only built once.
+// It is shared by every copy of the cluster's client, which also share its discovery cache.
+type impersonationCache struct {
+	mutex   sync.Mutex
+	clients map[string]impersonatedClient
+}
+
+// impersonatedClient is the config and clientset of an impersonated identity
+type impersonatedClient struct {
+	config *rest.Config
+	client *k8s.Clientset
+}
+
+// newImpersonationCache returns an empty cache
+func newImpersonationCache() *impersonationCache {
+	return &impersonationCache{clients: make(map[string]impersonatedClient)}
+}
+
+// Impersonate returns a copy of the client that sends requests as the given user and groups, so that their RBAC decides what the client may do.
+// The copy keeps the cluster, transaction, dry run mode and execution of the client. An empty user sends requests as the client's own identity.
+func (c ClientImpl) Impersonate(user string, groups []string) (Client, error) {
+	c.impersonate = rest.ImpersonationConfig{UserName: user, Groups: groups}
+	return c.impersonated()
+}
+
+// impersonated returns a copy of the client whose config and clientset impersonate the user and groups of the client.
+// The config and clientset of each identity are built once per cluster.
+func (c ClientImpl) impersonated() (ClientImpl, error) {
+	if c.config.Impersonate.UserName == c.impersonate.UserName && reflect.DeepEqual(c.config.Impersonate.Groups, c.impersonate.Groups) {
+		return c, nil
+	}
+
+	if c.impersonations == nil {
+		impersonated, err := newImpersonatedClient(c.config, c.impersonate)
+		if err != nil {
+			return c, err
+		}
+		c.config, c.client = impersonated.config, impersonated.client
+		return c, nil
+	}
+
+	c.impersonations.mutex.Lock()
+	defer c.impersonations.mutex.Unlock()
+
+	key := c.impersonate.UserName + "\n" + strings.Join(c.impersonate.Groups, "\n")
+	impersonated, exists := c.impersonations.clients[key]
+	if !exists {
+		var err error
+		if impersonated, err = newImpersonatedClient(c.config, c.impersonate); err != nil {
+			return c, err
+		}
+		c.impersonations.clients[key] = impersonated
+	}
+
+	c.config, c.client = impersonated.config, impersonated.client
+	return c, nil
+}
+
+// newImpersonatedClient builds the config and clientset that impersonate an identity
+func newImpersonatedClient(config *rest.Config, impersonate rest.ImpersonationConfig) (impersonatedClient, error) {
+	config = rest.CopyConfig(config)
+	config.Impersonate = impersonate
+
+	clientset, err := k8s.NewForConfig(config)
+	if err != nil {
+		return impersonatedClient{}, err
+	}
+	return impersonatedClient{config, clientset}, nil
+}
@@ -0,0 +1,101 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/rest"
+)
+
+func TestImpersonate(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		requests = append(requests, fmt.Sprintf("%s %s as %s %v", request.Method, request.URL.Path, request.Header.Get("Impersonate-User"), request.Header["Impersonate-Group"]))
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+	}))
+	defer server.Close()
+
+	client := ClientImpl{config: &rest.Config{Host: server.URL}, apiResources: newDiscoveryCache("", 0)}
+	transaction := client.Begin().(TransactionImpl)
+
+	impersonated, err := transaction.Impersonate("system:serviceaccount:team-a:deployer", []string{"team-a"})
+	if err != nil {
+		t.Fatalf("Expected the impersonation to succeed: %s", err.Error())
+	}
+	impersonatedClient := impersonated.(ClientImpl)
+
+	restClient, err := impersonatedClient.RESTClient("v1")
+	if err != nil {
+		t.Fatalf("Expected a REST client: %s", err.Error())
+	}
+	if err := restClient.Get().Namespace("team-a").Resource("configmaps").Do().Error(); err != nil {
+		t.Fatalf("Expected the request to succeed: %s", err.Error())
+	}
+
+	configMap := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}}
+	configMap.SetNamespace("team-a")
+	configMap.SetName("settings")
+	impersonatedClient.recordCreate(&metav1.APIResource{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}, configMap)
+
+	if err := transaction.Rollback(); err != nil {
+		t.Fatalf("Expected the rollback to succeed: %s", err.Error())
+	}
+
+	expected := []string{
+		"GET /api/v1/namespaces/team-a/configmaps as system:serviceaccount:team-a:deployer [team-a]",
+		"DELETE /api/v1/namespaces/team-a/configmaps/settings as system:serviceaccount:team-a:deployer [team-a]",
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected requests:\n%s\nbut received:\n%s", strings.Join(expected, "\n"), strings.Join(requests, "\n"))
+	}
+
+	if client.config.Impersonate.UserName != "" {
+		t.Errorf("Expected the impersonation to not change the original client")
+	}
+}
+
+func TestImpersonateReusesClients(t *testing.T) {
+	client, err := newClient("", &rest.Config{Host: "https://kubernetes.example.com"}, ClientOptions{})
+	if err != nil {
+		t.Fatalf("Expected a client: %s", err.Error())
+	}
+
+	impersonate := func(client ClientImpl, user string, groups ...string) ClientImpl {
+		impersonated, err := client.Impersonate(user, groups)
+		if err != nil {
+			t.Fatalf("Expected the impersonation of %s to succeed: %s", user, err.Error())
+		}
+		return impersonated.(ClientImpl)
+	}
+
+	first := impersonate(client, "deployer", "team-a")
+	second := impersonate(client.Begin().(TransactionImpl).ClientImpl, "deployer", "team-a")
+	if first.client != second.client || first.config != second.config {
+		t.Errorf("Expected repeated impersonations of the same identity to reuse one client")
+	}
+	if first.apiResources != client.apiResources {
+		t.Errorf("Expected the impersonated client to share the discovery cache")
+	}
+
+	if other := impersonate(client, "deployer", "team-b"); other.client == first.client {
+		t.Errorf("Expected an impersonation with other groups to use another client")
+	}
+	if own := impersonate(first, ""); own.client == first.client || own.config.Impersonate.UserName != "" {
+		t.Errorf("Expected an empty user to use the client's own identity")
+	}
+	if len(client.impersonations.clients) != 3 {
+		t.Errorf("Expected 3 impersonated clients, but received %d", len(client.impersonations.clients))
+	}
+}
@@ -0,0 +1,215 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/rest"
+)
+
+// JobOptions holds the options to run a Job
+type JobOptions struct {
+	// How long to wait for the Job to succeed or fail
+	Timeout time.Duration
+
+	// How often to check the status of the Job
+	PollInterval time.Duration
+
+	// The number of lines of pod logs to include when the Job fails
+	LogLines int64
+}
+
+// RunJob creates a Job, and waits until it succeeds, fails or times out. If the Job doesn't succeed, the error includes the end of the pod logs.
+// A Job that times out is deleted, so that its pods don't keep running.
+func (c ClientImpl) RunJob(resource unstructured.Unstructured, options JobOptions) error {
+	apiVersion := resource.GetAPIVersion()
+	kind := resource.GetKind()
+
+	apiResource, err := c.GetAPIResource(apiVersion, kind)
+	if err != nil {
+		return fmt.Errorf("Error getting API Resource %s for API %s: %s", kind, apiVersion, err.Error())
+	}
+
+	client, err := c.RESTClient(apiVersion)
+	if err != nil {
+		return fmt.Errorf("Error getting REST client for API %s: %s", apiVersion, err.Error())
+	}
+
+	if resource.GetNamespace() == "" {
+		return fmt.Errorf("Error running %s %s %s: no namespace is defined", apiVersion, kind, resource.GetGenerateName()+resource.GetName())
+	}
+
+	job, err := c.create(client, apiResource, resource)
+	if err != nil {
+		return err
+	}
+
+	// The Job was never persisted, so there is nothing to wait for
+	if c.dryRun != nil {
+		return nil
+	}
+
+	var failure string
+	err = wait.PollImmediate(options.PollInterval, options.Timeout, func() (bool, error) {
+		body, err := client.Get().
+			Namespace(job.GetNamespace()).
+			Resource(apiResource.Name).
+			Name(job.GetName()).
+			Do().
+			Raw()
+		if err != nil {
+			logger.Warningf("Error getting the status of Job %s/%s: %s", job.GetNamespace(), job.GetName(), err.Error())
+			return false, nil
+		}
+
+		current := unstructured.Unstructured{}
+		if err := json.Unmarshal(body, &current.Object); err != nil {
+			return false, err
+		}
+
+		conditions, _, _ := unstructured.NestedSlice(current.Object, "status", "conditions")
+		for _, condition := range conditions {
+			conditionMap, ok := condition.(map[string]interface{})
+			if !ok || conditionMap["status"] != "True" {
+				continue
+			}
+			switch conditionMap["type"] {
+			case "Complete":
+				return true, nil
+			case "Failed":
+				failure = fmt.Sprintf("%v: %v", conditionMap["reason"], conditionMap["message"])
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+
+	timedOut := err == wait.ErrWaitTimeout
+	if timedOut {
+		failure = fmt.Sprintf("timed out after %s", options.Timeout)
+	} else if err != nil {
+		failure = err.Error()
+	}
+
+	if failure == "" {
+		logger.Infof("Job %s/%s succeeded", job.GetNamespace(), job.GetName())
+		return nil
+	}
+
+	// The logs are read before a Job that timed out is deleted, since its pods are deleted with it
+	logs := c.getJobLogs(job, options.LogLines)
+	if timedOut {
+		logs += deleteJob(client, apiResource, job)
+	}
+
+	return fmt.Errorf("Job %s/%s did not succeed: %s%s", job.GetNamespace(), job.GetName(), failure, logs)
+}
+
+// deleteJob deletes a Job that timed out, and its pods in the background, so that they don't keep running after the rule failed.
+// This function returns an error message to add to the error of the rule, or an empty string if the Job was deleted.
+func deleteJob(client rest.Interface, apiResource *metav1.APIResource, job unstructured.Unstructured) string {
+	background := metav1.DeletePropagationBackground
+	body, err := json.Marshal(metav1.DeleteOptions{
+		TypeMeta:          metav1.TypeMeta{APIVersion: "v1", Kind: "DeleteOptions"},
+		PropagationPolicy: &background,
+	})
+	if err != nil {
+		return fmt.Sprintf("\nError serializing the delete options of the Job: %s", err.Error())
+	}
+
+	err = client.Delete().
+		Namespace(job.GetNamespace()).
+		Resource(apiResource.Name).
+		Name(job.GetName()).
+		Body(body).
+		Do().
+		Error()
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Sprintf("\nError deleting the Job after it timed out: %s", err.Error())
+	}
+
+	logger.Infof("Deleted Job %s/%s after it timed out", job.GetNamespace(), job.GetName())
+	return ""
+}
+
+// getJobLogs returns the last lines of the logs of every pod of a Job. For each pod, the logs of the containers that failed are returned,
+// or the logs of every container that started if none failed.
+func (c ClientImpl) getJobLogs(job unstructured.Unstructured, lines int64) string {
+	if lines <= 0 {
+		return ""
+	}
+
+	client, err := c.RESTClient("v1")
+	if err != nil {
+		return fmt.Sprintf("\nError getting REST client for API v1: %s", err.Error())
+	}
+
+	body, err := client.Get().
+		Namespace(job.GetNamespace()).
+		Resource("pods").
+		Param("labelSelector", labels.SelectorFromSet(labels.Set{"job-name": job.GetName()}).String()).
+		Do().
+		Raw()
+	if err != nil {
+		return fmt.Sprintf("\nError listing the pods of the Job: %s", err.Error())
+	}
+
+	pods := corev1.PodList{}
+	if err := json.Unmarshal(body, &pods); err != nil {
+		return fmt.Sprintf("\nError parsing the pods of the Job: %s", err.Error())
+	}
+
+	logs := ""
+	for _, pod := range pods.Items {
+		for _, container := range logContainers(pod) {
+			logs += getContainerLogs(client, pod, container, lines)
+		}
+	}
+	return logs
+}
+
+// logContainers returns the names of the containers of a pod that exited with an error, or of every container that started if none did
+func logContainers(pod corev1.Pod) []string {
+	var failed []string
+	var started []string
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if status.State.Running == nil && status.State.Terminated == nil {
+			continue
+		}
+		started = append(started, status.Name)
+		if status.State.Terminated != nil && status.State.Terminated.ExitCode != 0 {
+			failed = append(failed, status.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return failed
+	}
+	return started
+}
+
+// getContainerLogs returns the last lines of the logs of a container of a pod
+func getContainerLogs(client rest.Interface, pod corev1.Pod, container string, lines int64) string {
+	body, err := client.Get().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("log").
+		Param("container", container).
+		Param("tailLines", fmt.Sprintf("%d", lines)).
+		Do().
+		Raw()
+	if err != nil {
+		return fmt.Sprintf("\nError getting the logs of container %s of pod %s: %s", container, pod.Name, err.Error())
+	}
+	return fmt.Sprintf("\nLast %d lines of the logs of container %s of pod %s:\n  %s", lines, container, pod.Name, strings.ReplaceAll(strings.TrimRight(string(body), "\n"), "\n", "\n  "))
+}
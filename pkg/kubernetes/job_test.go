@@ -0,0 +1,127 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/rest"
+)
+
+func TestGetJobLogs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/api/v1/namespaces/dev/pods":
+			if selector := request.URL.Query().Get("labelSelector"); selector != "job-name=migrate" {
+				t.Errorf("Expected the pods of the Job to be listed, but received selector %s", selector)
+			}
+			writer.Header().Set("Content-Type", "application/json")
+			writer.Write([]byte(`{"kind":"PodList","apiVersion":"v1","items":[` +
+				`{"metadata":{"name":"migrate-failed","namespace":"dev"},"status":{` +
+				`"initContainerStatuses":[{"name":"wait-for-db","state":{"terminated":{"exitCode":0}}}],` +
+				`"containerStatuses":[{"name":"migrate","state":{"terminated":{"exitCode":1}}},{"name":"proxy","state":{"running":{}}}]}},` +
+				`{"metadata":{"name":"migrate-running","namespace":"dev"},"status":{` +
+				`"containerStatuses":[{"name":"migrate","state":{"running":{}}},{"name":"proxy","state":{"waiting":{}}}]}}]}`))
+		case "/api/v1/namespaces/dev/pods/migrate-failed/log", "/api/v1/namespaces/dev/pods/migrate-running/log":
+			if request.URL.Query().Get("tailLines") != "5" {
+				t.Errorf("Expected the last 5 lines, but received %s", request.URL.Query().Get("tailLines"))
+			}
+			writer.Write([]byte("logs of " + request.URL.Query().Get("container") + "\n"))
+		default:
+			writer.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := newClient("", &rest.Config{Host: server.URL}, ClientOptions{})
+	if err != nil {
+		t.Fatalf("Expected a client: %s", err.Error())
+	}
+
+	job := unstructured.Unstructured{}
+	job.SetNamespace("dev")
+	job.SetName("migrate")
+
+	logs := client.getJobLogs(job, 5)
+	expected := "\nLast 5 lines of the logs of container migrate of pod migrate-failed:\n  logs of migrate" +
+		"\nLast 5 lines of the logs of container migrate of pod migrate-running:\n  logs of migrate"
+	if logs != expected {
+		t.Errorf("Expected the logs of the failed container, or of the started containers, but received:%s", logs)
+	}
+}
+
+func TestRunJobDeletesJobsThatTimeOut(t *testing.T) {
+	var mutex sync.Mutex
+	var created []string
+	deleted := make(map[string]metav1.DeletionPropagation)
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		writer.Header().Set("Content-Type", "application/json")
+		switch {
+		case request.Method == http.MethodPost && request.URL.Path == "/apis/batch/v1/namespaces/dev/jobs":
+			// The server generates a new name for every Job
+			job := unstructured.Unstructured{}
+			if err := json.NewDecoder(request.Body).Decode(&job.Object); err != nil {
+				t.Errorf("Expected a Job: %s", err.Error())
+			}
+			job.SetName(fmt.Sprintf("%s%d", job.GetGenerateName(), len(created)))
+			created = append(created, job.GetName())
+			body, _ := job.MarshalJSON()
+			writer.Write(body)
+		case request.Method == http.MethodDelete:
+			options := metav1.DeleteOptions{}
+			if err := json.NewDecoder(request.Body).Decode(&options); err != nil || options.PropagationPolicy == nil {
+				t.Errorf("Expected delete options with a propagation policy, but received %v", options)
+			} else {
+				deleted[request.URL.Path] = *options.PropagationPolicy
+			}
+			writer.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+		case request.URL.Path == "/api/v1/namespaces/dev/pods":
+			writer.Write([]byte(`{"kind":"PodList","apiVersion":"v1","items":[]}`))
+		default:
+			// The Job never finishes
+			writer.Write([]byte(`{"apiVersion":"batch/v1","kind":"Job","metadata":{"namespace":"dev"},"status":{"active":1}}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := newClient("", &rest.Config{Host: server.URL}, ClientOptions{})
+	if err != nil {
+		t.Fatalf("Expected a client: %s", err.Error())
+	}
+	client.apiResources.groupVersions["batch/v1"] = discoveryEntry{
+		resources: metav1.APIResourceList{GroupVersion: "batch/v1", APIResources: []metav1.APIResource{{Name: "jobs", Kind: "Job", Namespaced: true}}},
+		fetched:   time.Now(),
+	}
+
+	job := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "batch/v1", "kind": "Job"}}
+	job.SetNamespace("dev")
+	job.SetGenerateName("migrate-")
+
+	// The second run creates its own Job, instead of failing because the first Job still exists
+	options := JobOptions{Timeout: 30 * time.Millisecond, PollInterval: 10 * time.Millisecond, LogLines: 5}
+	for run := 0; run < 2; run++ {
+		if err := client.RunJob(job, options); err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("Expected run %d to time out, but received: %v", run, err)
+		}
+	}
+
+	if strings.Join(created, ",") != "migrate-0,migrate-1" {
+		t.Errorf("Expected a new Job for every run, but received %v", created)
+	}
+	for _, name := range created {
+		if policy := deleted["/apis/batch/v1/namespaces/dev/jobs/"+name]; policy != metav1.DeletePropagationBackground {
+			t.Errorf("Expected Job %s to be deleted in the background after it timed out, but received %v", name, deleted)
+		}
+	}
+}
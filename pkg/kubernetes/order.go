@@ -0,0 +1,78 @@
+package kubernetes
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// otherClusterScopedKinds is the position in applyOrder of the cluster-scoped kinds that aren't listed
+const otherClusterScopedKinds = ""
+
+// applyOrder lists kinds in the order they should be created, so that cluster-scoped resources and
+// namespaces exist before the resources that depend on them. Namespaced kinds that aren't listed are applied last.
+var applyOrder = []string{
+	"Namespace",
+	"CustomResourceDefinition",
+	"PriorityClass",
+	"StorageClass",
+	"PersistentVolume",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"PodSecurityPolicy",
+	otherClusterScopedKinds,
+	"NetworkPolicy",
+	"ResourceQuota",
+	"LimitRange",
+	"PodDisruptionBudget",
+	"ServiceAccount",
+	"Secret",
+	"ConfigMap",
+	"PersistentVolumeClaim",
+	"Role",
+	"RoleBinding",
+	"Service",
+	"DaemonSet",
+	"Pod",
+	"ReplicationController",
+	"ReplicaSet",
+	"Deployment",
+	"HorizontalPodAutoscaler",
+	"StatefulSet",
+	"Job",
+	"CronJob",
+	"Ingress",
+	"APIService",
+}
+
+// applyOrderIndex returns the position of a kind in applyOrder
+func applyOrderIndex(kind string) int {
+	for pos, orderedKind := range applyOrder {
+		if orderedKind == kind {
+			return pos
+		}
+	}
+	return len(applyOrder)
+}
+
+// SortByApplyOrder sorts resources in the order they should be applied. Resources of the same kind keep their original order.
+// The namespaced function is only called for kinds that aren't in applyOrder, so that cluster-scoped kinds are applied before namespaced kinds.
+func SortByApplyOrder(resources []unstructured.Unstructured, namespaced func(resource unstructured.Unstructured) bool) {
+	indexes := make(map[string]int)
+	for _, resource := range resources {
+		key := resource.GetAPIVersion() + "/" + resource.GetKind()
+		if _, exists := indexes[key]; exists {
+			continue
+		}
+
+		index := applyOrderIndex(resource.GetKind())
+		if index == len(applyOrder) && !namespaced(resource) {
+			index = applyOrderIndex(otherClusterScopedKinds)
+		}
+		indexes[key] = index
+	}
+
+	sort.SliceStable(resources, func(i, j int) bool {
+		return indexes[resources[i].GetAPIVersion()+"/"+resources[i].GetKind()] < indexes[resources[j].GetAPIVersion()+"/"+resources[j].GetKind()]
+	})
+}
@@ -0,0 +1,163 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	newerrors "errors"
+	"fmt"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// changeVerbs are the verbs that the safeguards refuse in protected namespaces
+var changeVerbs = []string{"create", "update", "patch", "delete"}
+
+// PreflightCheck is a kind of resource, and the verbs that a rule needs on it
+type PreflightCheck struct {
+	APIVersion string
+	Kind       string
+
+	// The subresource, such as "scale" or "log"
+	Subresource string
+
+	// The namespace of the resources. If empty, the verbs are checked in every namespace.
+	Namespace string
+
+	// If true, the namespace is only known when the rule runs.
+	// The verbs are checked in every namespace, and denied verbs are warnings, since they might be allowed in the namespaces that the rule uses.
+	NamespaceTemplated bool
+
+	// If true, the resources are created, and must define their namespace if the kind is namespaced
+	RequiresNamespace bool
+
+	// If true, the kind is defined by a CustomResourceDefinition that the rules apply, so it might only be served once the rules run.
+	// If the kind isn't found, a warning is returned instead of an error.
+	DefinedByRules bool
+
+	// The verbs that the rule needs
+	Verbs []string
+}
+
+// Describe returns a user-friendly representation of a PreflightCheck
+func (c PreflightCheck) Describe() string {
+	resource := fmt.Sprintf("%s %s", c.APIVersion, c.Kind)
+	if c.Subresource != "" {
+		resource = fmt.Sprintf("%s/%s", resource, c.Subresource)
+	}
+	return resource
+}
+
+// Preflight resolves the kind of a check through discovery, and checks that the client is allowed the verbs with SelfSubjectAccessReviews.
+// This function returns a slice of warnings and an error.
+func (c ClientImpl) Preflight(check PreflightCheck) ([]string, error) {
+	apiResource, err := c.GetAPIResource(check.APIVersion, check.Kind)
+	if err != nil && check.DefinedByRules {
+		return []string{fmt.Sprintf("%s: the kind wasn't checked, because it is defined by a CustomResourceDefinition that the rules apply, and isn't served yet: %s", check.Describe(), err.Error())}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %s", check.Describe(), err.Error())
+	}
+
+	namespace := check.Namespace
+	if !apiResource.Namespaced {
+		namespace = ""
+	}
+
+	var warnings []string
+	var errors []string
+	if check.RequiresNamespace && apiResource.Namespaced && namespace == "" && !check.NamespaceTemplated {
+		errors = append(errors, fmt.Sprintf("%s: the kind is namespaced, but the rule doesn't define the namespace of the resources", check.Describe()))
+	}
+	if c.changesProtectedNamespace(check, namespace) {
+		errors = append(errors, fmt.Sprintf("%s: namespace %s is protected, so the rule would always fail to change the resources", check.Describe(), namespace))
+	}
+	for _, verb := range check.Verbs {
+		allowed, reason, err := c.reviewAccess(check, apiResource, namespace, verb)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: could not check the verb %s: %s", check.Describe(), verb, err.Error()))
+		} else if !allowed {
+			message := fmt.Sprintf("%s: the verb %s is not allowed %s", check.Describe(), verb, describeAccessNamespace(apiResource, namespace))
+			if reason != "" {
+				message = fmt.Sprintf("%s (%s)", message, reason)
+			}
+			if check.NamespaceTemplated && apiResource.Namespaced {
+				warnings = append(warnings, fmt.Sprintf("%s. It might be allowed in the namespaces that the rule uses.", message))
+			} else {
+				errors = append(errors, message)
+			}
+		}
+	}
+
+	if len(errors) > 0 {
+		return warnings, newerrors.New(strings.Join(errors, "\n"))
+	}
+	return warnings, nil
+}
+
+// changesProtectedNamespace returns true if a check needs to change resources in a protected namespace, which the safeguards never allow
+func (c ClientImpl) changesProtectedNamespace(check PreflightCheck, namespace string) bool {
+	if c.safeguards == nil || namespace == "" || check.NamespaceTemplated || !containsFold(c.safeguards.ProtectedNamespaces, namespace) {
+		return false
+	}
+
+	for _, verb := range check.Verbs {
+		if containsFold(changeVerbs, verb) {
+			return true
+		}
+	}
+	return false
+}
+
+// reviewAccess issues a SelfSubjectAccessReview for a verb. This function returns whether the verb is allowed, and why not.
+func (c ClientImpl) reviewAccess(check PreflightCheck, apiResource *metav1.APIResource, namespace string, verb string) (bool, string, error) {
+	groupVersion := c.GetGroupVersion(check.APIVersion)
+	review := authorizationv1.SelfSubjectAccessReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: "authorization.k8s.io/v1", Kind: "SelfSubjectAccessReview"},
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   namespace,
+				Verb:        verb,
+				Group:       groupVersion.Group,
+				Version:     groupVersion.Version,
+				Resource:    apiResource.Name,
+				Subresource: check.Subresource,
+			},
+		},
+	}
+
+	body, err := json.Marshal(review)
+	if err != nil {
+		return false, "", err
+	}
+
+	client, err := c.RESTClient("authorization.k8s.io/v1")
+	if err != nil {
+		return false, "", err
+	}
+
+	response, err := client.Post().
+		Resource("selfsubjectaccessreviews").
+		Body(body).
+		Do().
+		Raw()
+	if err != nil {
+		return false, "", err
+	}
+
+	result := authorizationv1.SelfSubjectAccessReview{}
+	if err := json.Unmarshal(response, &result); err != nil {
+		return false, "", err
+	}
+
+	return result.Status.Allowed, result.Status.Reason, nil
+}
+
+// describeAccessNamespace returns where a verb was checked
+func describeAccessNamespace(apiResource *metav1.APIResource, namespace string) string {
+	if !apiResource.Namespaced {
+		return "cluster-wide"
+	} else if namespace == "" {
+		return "in every namespace"
+	}
+	return fmt.Sprintf("in namespace %s", namespace)
+}
@@ -0,0 +1,92 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestPreflight(t *testing.T) {
+	var mutex sync.Mutex
+	var reviews []authorizationv1.ResourceAttributes
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		writer.Header().Set("Content-Type", "application/json")
+		switch request.URL.Path {
+		case "/api/v1":
+			writer.Write([]byte(`{"kind":"APIResourceList","groupVersion":"v1","resources":[` +
+				`{"name":"configmaps","kind":"ConfigMap","namespaced":true,"verbs":["get","list","create","update","delete"]},` +
+				`{"name":"namespaces","kind":"Namespace","namespaced":false,"verbs":["get","list"]}]}`))
+		case "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews":
+			review := authorizationv1.SelfSubjectAccessReview{}
+			if err := json.NewDecoder(request.Body).Decode(&review); err != nil {
+				t.Errorf("Expected a SelfSubjectAccessReview: %s", err.Error())
+			}
+			reviews = append(reviews, *review.Spec.ResourceAttributes)
+			review.Status.Allowed = review.Spec.ResourceAttributes.Verb != "delete"
+			json.NewEncoder(writer).Encode(review)
+		default:
+			writer.WriteHeader(http.StatusNotFound)
+			writer.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := newClient("", &rest.Config{Host: server.URL}, ClientOptions{})
+	if err != nil {
+		t.Fatalf("Expected a client: %s", err.Error())
+	}
+	client.safeguards = newSafeguards(Safeguards{ProtectedNamespaces: []string{"default"}})
+
+	tests := []struct {
+		name     string
+		check    PreflightCheck
+		warnings int
+		error    string
+	}{
+		{"allowed", PreflightCheck{APIVersion: "v1", Kind: "ConfigMap", Namespace: "preview", Verbs: []string{"get", "update"}}, 0, ""},
+		{"denied", PreflightCheck{APIVersion: "v1", Kind: "ConfigMap", Namespace: "preview", Verbs: []string{"list", "delete"}}, 0, "v1 ConfigMap: the verb delete is not allowed in namespace preview"},
+		{"denied_templated", PreflightCheck{APIVersion: "v1", Kind: "ConfigMap", NamespaceTemplated: true, Verbs: []string{"delete"}}, 1, ""},
+		{"denied_cluster_scoped", PreflightCheck{APIVersion: "v1", Kind: "Namespace", Namespace: "preview", NamespaceTemplated: true, Verbs: []string{"delete"}}, 0, "v1 Namespace: the verb delete is not allowed cluster-wide"},
+		{"protected_namespace", PreflightCheck{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Verbs: []string{"get", "create", "update"}}, 0, "v1 ConfigMap: namespace default is protected"},
+		{"protected_namespace_read", PreflightCheck{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Verbs: []string{"get", "list"}}, 0, ""},
+		{"protected_namespace_cluster_scoped", PreflightCheck{APIVersion: "v1", Kind: "Namespace", Namespace: "default", Verbs: []string{"get"}}, 0, ""},
+		{"missing_namespace", PreflightCheck{APIVersion: "v1", Kind: "ConfigMap", RequiresNamespace: true, Verbs: []string{"create"}}, 0, "v1 ConfigMap: the kind is namespaced, but the rule doesn't define the namespace"},
+		{"missing_namespace_cluster_scoped", PreflightCheck{APIVersion: "v1", Kind: "Namespace", RequiresNamespace: true, Verbs: []string{"get"}}, 0, ""},
+		{"unknown_kind", PreflightCheck{APIVersion: "v1", Kind: "Widget", Verbs: []string{"get"}}, 0, "Kind 'Widget' was not found in API Version 'v1'"},
+		{"unknown_api_version", PreflightCheck{APIVersion: "example.com/v1", Kind: "Widget", Verbs: []string{"get"}}, 0, "example.com/v1 Widget: "},
+		{"unknown_kind_defined_by_rules", PreflightCheck{APIVersion: "example.com/v1", Kind: "Widget", DefinedByRules: true, Verbs: []string{"get"}}, 1, ""},
+		{"known_kind_defined_by_rules", PreflightCheck{APIVersion: "v1", Kind: "ConfigMap", Namespace: "preview", DefinedByRules: true, Verbs: []string{"delete"}}, 0, "v1 ConfigMap: the verb delete is not allowed in namespace preview"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			warnings, err := client.Preflight(test.check)
+			if len(warnings) != test.warnings {
+				t.Errorf("Expected %d warnings, but received %v", test.warnings, warnings)
+			}
+			if test.error == "" && err != nil {
+				t.Errorf("Expected no error, but received: %s", err.Error())
+			} else if test.error != "" && (err == nil || !strings.Contains(err.Error(), test.error)) {
+				t.Errorf("Expected an error containing '%s', but received: %v", test.error, err)
+			}
+		})
+	}
+
+	for _, review := range reviews {
+		if review.Resource == "namespaces" && review.Namespace != "" {
+			t.Errorf("Expected the cluster-scoped Namespace to be reviewed cluster-wide, but received namespace %s", review.Namespace)
+		} else if review.Resource == "configmaps" && review.Namespace != "preview" && review.Namespace != "default" && review.Namespace != "" {
+			t.Errorf("Unexpected namespace %s for a ConfigMap review", review.Namespace)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package kubernetes
 
 import (
+	"fmt"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
@@ -24,6 +26,14 @@ func (in *Resource) DeepCopyObject() runtime.Object {
 	return out
 }
 
+// describeName returns the namespace and name of a resource
+func (in Resource) describeName() string {
+	if in.Namespace == "" {
+		return in.Name
+	}
+	return fmt.Sprintf("%s/%s", in.Namespace, in.Name)
+}
+
 // ResourceList represents a list of Kubernetes resources
 type ResourceList struct {
 	metav1.TypeMeta `json:",inline"`
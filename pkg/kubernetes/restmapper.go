@@ -0,0 +1,238 @@
+package kubernetes
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// apiGroupsFetcher fetches the API groups of a cluster
+type apiGroupsFetcher func() (*metav1.APIGroupList, error)
+
+// discoveryRESTMapper maps kinds to resources, and resources to kinds, through the discovery cache of a cluster.
+// API Versions are only discovered when a mapping needs them, so the mappings expire with the cached API Versions,
+// and a kind that isn't found discovers its API Version again. The API groups are only listed for mappings that don't name a version.
+type discoveryRESTMapper struct {
+	cache       *discoveryCache
+	fetch       discoveryFetcher
+	fetchGroups apiGroupsFetcher
+}
+
+// RESTMapper returns a RESTMapper backed by the discovery cache of the client's cluster
+func (c ClientImpl) RESTMapper() meta.RESTMapper {
+	return discoveryRESTMapper{cache: c.apiResources, fetch: c.fetchAPIResources, fetchGroups: c.fetchAPIGroups}
+}
+
+// fetchAPIGroups discovers the API groups of the cluster
+func (c ClientImpl) fetchAPIGroups() (*metav1.APIGroupList, error) {
+	return c.client.Discovery().ServerGroups()
+}
+
+// RESTMapping returns the mapping of a kind in the first of the versions that serves it, or in the preferred version of its API group
+func (m discoveryRESTMapper) RESTMapping(groupKind schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+	mappings, err := m.RESTMappings(groupKind, versions...)
+	if err != nil {
+		return nil, err
+	}
+	return mappings[0], nil
+}
+
+// RESTMappings returns the mappings of a kind in the given versions, or in every version of its API group with the preferred version first
+func (m discoveryRESTMapper) RESTMappings(groupKind schema.GroupKind, versions ...string) ([]*meta.RESTMapping, error) {
+	var groupVersions []schema.GroupVersion
+	if len(versions) > 0 {
+		for _, version := range versions {
+			groupVersions = append(groupVersions, groupKind.WithVersion(version).GroupVersion())
+		}
+	} else {
+		var err error
+		if groupVersions, err = m.groupVersions(groupKind.Group); err != nil {
+			return nil, err
+		}
+	}
+
+	var mappings []*meta.RESTMapping
+	var lastErr error
+	for _, groupVersion := range groupVersions {
+		apiResource, err := m.cache.resource(groupVersion.String(), groupKind.Kind, m.fetch)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		mappings = append(mappings, toRESTMapping(groupVersion, apiResource))
+	}
+
+	if len(mappings) == 0 {
+		if len(groupVersions) == 1 {
+			// A single API Version was searched, so its error says why the kind wasn't found
+			return nil, lastErr
+		}
+		return nil, &meta.NoKindMatchError{GroupKind: groupKind, SearchedVersions: versions}
+	}
+	return mappings, nil
+}
+
+// ResourceFor returns the single resource matching a partial resource
+func (m discoveryRESTMapper) ResourceFor(input schema.GroupVersionResource) (schema.GroupVersionResource, error) {
+	resources, err := m.ResourcesFor(input)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+
+	for _, resource := range resources[1:] {
+		if resource.GroupResource() != resources[0].GroupResource() {
+			return schema.GroupVersionResource{}, &meta.AmbiguousResourceError{PartialResource: input, MatchingResources: resources}
+		}
+	}
+	return resources[0], nil
+}
+
+// ResourcesFor returns the resources matching a partial resource, with the preferred version of each API group first
+func (m discoveryRESTMapper) ResourcesFor(input schema.GroupVersionResource) ([]schema.GroupVersionResource, error) {
+	var resources []schema.GroupVersionResource
+	err := m.eachResource(input, func(groupVersion schema.GroupVersion, apiResource metav1.APIResource) {
+		resources = append(resources, groupVersion.WithResource(apiResource.Name))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// KindFor returns the kind of the single resource matching a partial resource
+func (m discoveryRESTMapper) KindFor(input schema.GroupVersionResource) (schema.GroupVersionKind, error) {
+	kinds, err := m.KindsFor(input)
+	if err != nil {
+		return schema.GroupVersionKind{}, err
+	}
+
+	for _, kind := range kinds[1:] {
+		if kind.GroupKind() != kinds[0].GroupKind() {
+			return schema.GroupVersionKind{}, &meta.AmbiguousResourceError{PartialResource: input, MatchingKinds: kinds}
+		}
+	}
+	return kinds[0], nil
+}
+
+// KindsFor returns the kinds of the resources matching a partial resource, with the preferred version of each API group first
+func (m discoveryRESTMapper) KindsFor(input schema.GroupVersionResource) ([]schema.GroupVersionKind, error) {
+	var kinds []schema.GroupVersionKind
+	err := m.eachResource(input, func(groupVersion schema.GroupVersion, apiResource metav1.APIResource) {
+		kinds = append(kinds, groupVersion.WithKind(apiResource.Kind))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return kinds, nil
+}
+
+// ResourceSingularizer returns the singular name of a resource
+func (m discoveryRESTMapper) ResourceSingularizer(resource string) (string, error) {
+	var singular string
+	err := m.eachResource(schema.GroupVersionResource{Resource: resource}, func(groupVersion schema.GroupVersion, apiResource metav1.APIResource) {
+		if singular == "" {
+			singular = apiResource.SingularName
+			if singular == "" {
+				singular = strings.ToLower(apiResource.Kind)
+			}
+		}
+	})
+	if err != nil {
+		return resource, err
+	}
+	return singular, nil
+}
+
+// eachResource calls the function for every API resource matching a partial resource by its plural or singular name.
+// If none match, the API groups are listed again, unless they were just listed, so that new API groups are found.
+func (m discoveryRESTMapper) eachResource(input schema.GroupVersionResource, function func(schema.GroupVersion, metav1.APIResource)) error {
+	name := strings.ToLower(input.Resource)
+	matched := false
+	for _, refresh := range []bool{false, true} {
+		groupVersions, err := m.cachedGroupVersions(input.Group, input.Version, true, refresh)
+		if err != nil {
+			return err
+		}
+
+		for _, groupVersion := range groupVersions {
+			apiResources, err := m.cache.resources(groupVersion.String(), m.fetch)
+			if err != nil {
+				// API Versions that can't be discovered, such as unavailable aggregated APIs, don't serve the resource
+				continue
+			}
+			for _, apiResource := range apiResources.APIResources {
+				if apiResource.Name == name || (apiResource.SingularName != "" && apiResource.SingularName == name) {
+					function(groupVersion, apiResource)
+					matched = true
+				}
+			}
+		}
+
+		if matched {
+			return nil
+		}
+	}
+	return &meta.NoResourceMatchError{PartialResource: input}
+}
+
+// groupVersions returns the versions of an API group, with the preferred version first.
+// If the group isn't found, the API groups are listed again, unless they were just listed.
+func (m discoveryRESTMapper) groupVersions(group string) ([]schema.GroupVersion, error) {
+	groupVersions, err := m.cachedGroupVersions(group, "", false, false)
+	if err == nil && len(groupVersions) == 0 {
+		groupVersions, err = m.cachedGroupVersions(group, "", false, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(groupVersions) == 0 {
+		return nil, &meta.NoKindMatchError{GroupKind: schema.GroupKind{Group: group}}
+	}
+	return groupVersions, nil
+}
+
+// cachedGroupVersions returns the versions of the given API group, with the preferred version first. If anyGroup is true, an empty group is every API group.
+// If a version is given, only that version of each group is returned.
+func (m discoveryRESTMapper) cachedGroupVersions(group string, version string, anyGroup bool, refresh bool) ([]schema.GroupVersion, error) {
+	if (group != "" || !anyGroup) && version != "" {
+		return []schema.GroupVersion{{Group: group, Version: version}}, nil
+	}
+
+	groups, err := m.cache.apiGroups(refresh, m.fetchGroups)
+	if err != nil {
+		return nil, err
+	}
+
+	var groupVersions []schema.GroupVersion
+	for _, apiGroup := range groups.Groups {
+		if (group != "" || !anyGroup) && apiGroup.Name != group {
+			continue
+		}
+
+		preferred := apiGroup.PreferredVersion.Version
+		if version == "" || version == preferred {
+			groupVersions = append(groupVersions, schema.GroupVersion{Group: apiGroup.Name, Version: preferred})
+		}
+		for _, groupVersion := range apiGroup.Versions {
+			if groupVersion.Version != preferred && (version == "" || version == groupVersion.Version) {
+				groupVersions = append(groupVersions, schema.GroupVersion{Group: apiGroup.Name, Version: groupVersion.Version})
+			}
+		}
+	}
+	return groupVersions, nil
+}
+
+// toRESTMapping maps an API resource to a RESTMapping
+func toRESTMapping(groupVersion schema.GroupVersion, apiResource *metav1.APIResource) *meta.RESTMapping {
+	scope := meta.RESTScopeRoot
+	if apiResource.Namespaced {
+		scope = meta.RESTScopeNamespace
+	}
+	return &meta.RESTMapping{
+		Resource:         groupVersion.WithResource(apiResource.Name),
+		GroupVersionKind: groupVersion.WithKind(apiResource.Kind),
+		Scope:            scope,
+	}
+}
@@ -0,0 +1,109 @@
+package kubernetes
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestDiscoveryRESTMapper(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	discovery := &fakeDiscovery{lists: make(map[string]metav1.APIResourceList), fetches: make(map[string]int)}
+	discovery.lists["v1"] = metav1.APIResourceList{GroupVersion: "v1", APIResources: []metav1.APIResource{
+		{Name: "configmaps", SingularName: "configmap", Kind: "ConfigMap", Namespaced: true},
+		{Name: "namespaces", SingularName: "namespace", Kind: "Namespace"},
+	}}
+	for _, apiVersion := range []string{"apps/v1", "apps/v1beta2"} {
+		discovery.lists[apiVersion] = metav1.APIResourceList{GroupVersion: apiVersion, APIResources: []metav1.APIResource{
+			{Name: "deployments", SingularName: "deployment", Kind: "Deployment", Namespaced: true},
+		}}
+	}
+
+	var mutex sync.Mutex
+	groups := []metav1.APIGroup{
+		{Name: "", Versions: []metav1.GroupVersionForDiscovery{{GroupVersion: "v1", Version: "v1"}}, PreferredVersion: metav1.GroupVersionForDiscovery{GroupVersion: "v1", Version: "v1"}},
+		{
+			Name:             "apps",
+			Versions:         []metav1.GroupVersionForDiscovery{{GroupVersion: "apps/v1beta2", Version: "v1beta2"}, {GroupVersion: "apps/v1", Version: "v1"}},
+			PreferredVersion: metav1.GroupVersionForDiscovery{GroupVersion: "apps/v1", Version: "v1"},
+		},
+	}
+	groupFetches := 0
+	fetchGroups := func() (*metav1.APIGroupList, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		groupFetches++
+		return &metav1.APIGroupList{Groups: append([]metav1.APIGroup{}, groups...)}, nil
+	}
+
+	cache := newDiscoveryCache("restmapper-test", time.Minute)
+	cache.now = func() time.Time { return now }
+	mapper := discoveryRESTMapper{cache: cache, fetch: discovery.fetch, fetchGroups: fetchGroups}
+
+	// Kinds are mapped in the preferred version of their API group
+	mapping, err := mapper.RESTMapping(schema.GroupKind{Group: "apps", Kind: "Deployment"})
+	if err != nil {
+		t.Fatalf("Expected Deployment to be mapped: %s", err.Error())
+	}
+	if mapping.Resource != (schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}) || mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		t.Errorf("Expected Deployments to be mapped to apps/v1 deployments, but received %+v", mapping)
+	}
+
+	mapping, err = mapper.RESTMapping(schema.GroupKind{Kind: "Namespace"}, "v1")
+	if err != nil || mapping.Resource.Resource != "namespaces" || mapping.Scope.Name() != meta.RESTScopeNameRoot {
+		t.Errorf("Expected Namespace to be mapped to the cluster-scoped namespaces, but received %+v (error: %v)", mapping, err)
+	}
+
+	// Resources are mapped by their plural or singular name
+	kind, err := mapper.KindFor(schema.GroupVersionResource{Resource: "deployments"})
+	if err != nil || kind != (schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}) {
+		t.Errorf("Expected deployments to be mapped to apps/v1 Deployment, but received %v (error: %v)", kind, err)
+	}
+	resource, err := mapper.ResourceFor(schema.GroupVersionResource{Resource: "configmap"})
+	if err != nil || resource != (schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}) {
+		t.Errorf("Expected configmap to be mapped to v1 configmaps, but received %v (error: %v)", resource, err)
+	}
+	if singular, err := mapper.ResourceSingularizer("deployments"); err != nil || singular != "deployment" {
+		t.Errorf("Expected the singular of deployments to be deployment, but received %s (error: %v)", singular, err)
+	}
+	if _, err := mapper.KindFor(schema.GroupVersionResource{Resource: "widgets"}); !meta.IsNoMatchError(err) {
+		t.Errorf("Expected no match for an unknown resource, but received %v", err)
+	}
+
+	// Mappings come from the discovery cache
+	if groupFetches != 1 || discovery.fetches["apps/v1"] != 1 || discovery.fetches["v1"] != 1 {
+		t.Errorf("Expected the API groups and API Versions to be fetched once, but received %d and %v", groupFetches, discovery.fetches)
+	}
+
+	// An API group installed after the API groups were cached is found by listing them again
+	mutex.Lock()
+	groups = append(groups, metav1.APIGroup{
+		Name:             "example.com",
+		Versions:         []metav1.GroupVersionForDiscovery{{GroupVersion: "example.com/v1", Version: "v1"}},
+		PreferredVersion: metav1.GroupVersionForDiscovery{GroupVersion: "example.com/v1", Version: "v1"},
+	})
+	mutex.Unlock()
+	discovery.lists["example.com/v1"] = metav1.APIResourceList{GroupVersion: "example.com/v1", APIResources: []metav1.APIResource{
+		{Name: "widgets", Kind: "Widget", Namespaced: true},
+	}}
+	now = now.Add(minDiscoveryRefreshInterval)
+	if mapping, err := mapper.RESTMapping(schema.GroupKind{Group: "example.com", Kind: "Widget"}); err != nil || mapping.Resource.Resource != "widgets" {
+		t.Errorf("Expected the new Widget kind to be mapped, but received %+v (error: %v)", mapping, err)
+	}
+	if groupFetches != 2 {
+		t.Errorf("Expected the API groups to be listed again, but they were listed %d times", groupFetches)
+	}
+
+	// Mappings expire with the discovery cache
+	now = now.Add(time.Minute)
+	if _, err := mapper.RESTMapping(schema.GroupKind{Group: "apps", Kind: "Deployment"}); err != nil {
+		t.Errorf("Expected Deployment to be mapped: %s", err.Error())
+	}
+	if groupFetches != 3 || discovery.fetches["apps/v1"] != 2 {
+		t.Errorf("Expected the expired API groups and API Version to be fetched again, but received %d and %v", groupFetches, discovery.fetches)
+	}
+}
@@ -0,0 +1,216 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	circuitBreakerCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "azd_kubernetes_manager_deletion_circuit_breaker_count",
+		Help: "The total number of executions aborted because they would have deleted too many resources",
+	}, []string{"limit"})
+)
+
+// Safeguards protect resources from being changed by mistake, such as by a selector template that renders to an empty value.
+// They are enforced by the client for every change, so that no rule can bypass them.
+type Safeguards struct {
+	// Resources in these namespaces, and the namespaces themselves, are never changed
+	ProtectedNamespaces []string
+
+	// Kinds that are never changed, as "Kind" or "Kind.group"
+	ProtectedKinds []string
+
+	// The label that every deleted resource must have, as "key" or "key=value". If empty, any resource can be deleted.
+	RequiredDeleteLabel string
+
+	// The maximum number of resources deleted by a single execution. If 0, the deletions aren't limited.
+	MaxDeletionsPerExecution int
+
+	// The maximum number of resources deleted within the deletion window. If 0, the deletions aren't limited.
+	MaxDeletionsPerWindow int
+
+	// The duration of the deletion window
+	DeletionWindow time.Duration
+}
+
+// Execution is a Client for a single execution of rules. Deletions are counted against the safeguards of the execution.
+type Execution interface {
+	Client
+
+	// Aborted returns why the execution was aborted by the deletion circuit breaker, or nil if it wasn't
+	Aborted() error
+}
+
+// ExecutionImpl is the interface implementation of Execution
+type ExecutionImpl struct {
+	ClientImpl
+}
+
+// safeguards is the state of the safeguards shared by every execution
+type safeguards struct {
+	Safeguards
+
+	mutex     sync.Mutex
+	deletions []time.Time
+}
+
+// execution is the state of a single execution
+type execution struct {
+	mutex     sync.Mutex
+	deletions int
+	aborted   error
+}
+
+// newSafeguards returns the state of the given safeguards
+func newSafeguards(config Safeguards) *safeguards {
+	return &safeguards{Safeguards: config}
+}
+
+// NewExecution returns a copy of the client for a single execution
+func (c ClientImpl) NewExecution() Execution {
+	c.execution = &execution{}
+	return ExecutionImpl{c}
+}
+
+// Aborted returns why the execution was aborted by the deletion circuit breaker, or nil if it wasn't
+func (e ExecutionImpl) Aborted() error {
+	e.execution.mutex.Lock()
+	defer e.execution.mutex.Unlock()
+
+	return e.execution.aborted
+}
+
+// checkProtected returns an error if a resource is in a protected namespace or of a protected kind, or if the execution was aborted
+func (c ClientImpl) checkProtected(apiVersion string, kind string, namespace string, name string) error {
+	if c.safeguards == nil {
+		return nil
+	}
+
+	if c.execution != nil {
+		c.execution.mutex.Lock()
+		aborted := c.execution.aborted
+		c.execution.mutex.Unlock()
+		if aborted != nil {
+			return aborted
+		}
+	}
+
+	groupVersion, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return err
+	}
+
+	if matchesKind(c.safeguards.ProtectedKinds, groupVersion.Group, kind) {
+		return fmt.Errorf("%s %s is a protected kind, so it is never changed", apiVersion, kind)
+	}
+
+	if containsFold(c.safeguards.ProtectedNamespaces, namespace) {
+		return fmt.Errorf("Namespace %s is protected, so %s %s %s is never changed", namespace, apiVersion, kind, name)
+	}
+
+	if groupVersion.Group == "" && strings.EqualFold(kind, "Namespace") && containsFold(c.safeguards.ProtectedNamespaces, name) {
+		return fmt.Errorf("Namespace %s is protected, so it is never changed", name)
+	}
+
+	return nil
+}
+
+// checkDeletions returns an error if any of the resources is protected or doesn't have the required label.
+// Otherwise, the deletions are counted against the circuit breaker, which aborts the execution if there are too many.
+func (c ClientImpl) checkDeletions(apiVersion string, apiResource *metav1.APIResource, resources []Resource) error {
+	if c.safeguards == nil || len(resources) == 0 {
+		return nil
+	}
+
+	var errors []string
+	for _, resource := range resources {
+		if err := c.checkProtected(apiVersion, apiResource.Kind, resource.Namespace, resource.Name); err != nil {
+			errors = append(errors, fmt.Sprintf("- %s", err.Error()))
+		} else if !c.safeguards.hasRequiredDeleteLabel(resource) {
+			errors = append(errors, fmt.Sprintf("- %s %s %s/%s doesn't have the label %s", apiVersion, apiResource.Kind, resource.Namespace, resource.Name, c.safeguards.RequiredDeleteLabel))
+		}
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("Refusing to delete %d %s %s resources, because the safeguards reject some of them:\n%s", len(resources), apiVersion, apiResource.Kind, strings.Join(errors, "\n"))
+	}
+
+	// Dry runs don't delete anything
+	if c.dryRun != nil {
+		return nil
+	}
+
+	return c.reserveDeletions(len(resources))
+}
+
+// reserveDeletions counts deletions against the per-execution and per-window limits
+func (c ClientImpl) reserveDeletions(count int) error {
+	if c.execution != nil {
+		c.execution.mutex.Lock()
+		defer c.execution.mutex.Unlock()
+
+		if c.execution.aborted != nil {
+			return c.execution.aborted
+		}
+
+		if max := c.safeguards.MaxDeletionsPerExecution; max > 0 && c.execution.deletions+count > max {
+			c.execution.aborted = tripCircuitBreaker("execution", fmt.Sprintf("deleting %d more resources would exceed the limit of %d deletions per execution, after %d deletions", count, max, c.execution.deletions))
+			return c.execution.aborted
+		}
+	}
+
+	c.safeguards.mutex.Lock()
+	defer c.safeguards.mutex.Unlock()
+
+	now := time.Now()
+	if max := c.safeguards.MaxDeletionsPerWindow; max > 0 {
+		// Forget the deletions that are outside of the window
+		start := 0
+		for start < len(c.safeguards.deletions) && now.Sub(c.safeguards.deletions[start]) >= c.safeguards.DeletionWindow {
+			start++
+		}
+		c.safeguards.deletions = c.safeguards.deletions[start:]
+
+		if len(c.safeguards.deletions)+count > max {
+			err := tripCircuitBreaker("window", fmt.Sprintf("deleting %d more resources would exceed the limit of %d deletions per %s, after %d deletions", count, max, c.safeguards.DeletionWindow, len(c.safeguards.deletions)))
+			if c.execution != nil {
+				c.execution.aborted = err
+			}
+			return err
+		}
+
+		for i := 0; i < count; i++ {
+			c.safeguards.deletions = append(c.safeguards.deletions, now)
+		}
+	}
+
+	if c.execution != nil {
+		c.execution.deletions += count
+	}
+	return nil
+}
+
+// hasRequiredDeleteLabel returns true if a resource has the label required to delete it
+func (s *safeguards) hasRequiredDeleteLabel(resource Resource) bool {
+	if s.RequiredDeleteLabel == "" {
+		return true
+	}
+
+	split := strings.SplitN(s.RequiredDeleteLabel, "=", 2)
+	value, exists := resource.Labels[split[0]]
+	return exists && (len(split) == 1 || value == split[1])
+}
+
+// tripCircuitBreaker logs an alert and returns the error that aborts the execution
+func tripCircuitBreaker(limit string, reason string) error {
+	circuitBreakerCounter.With(prometheus.Labels{"limit": limit}).Inc()
+	logger.Alertf("Deletion circuit breaker tripped: %s. The execution was aborted.", reason)
+	return fmt.Errorf("Deletion circuit breaker tripped: %s. The execution was aborted, and nothing more will be changed.", reason)
+}
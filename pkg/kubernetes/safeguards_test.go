@@ -0,0 +1,113 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckProtected(t *testing.T) {
+	client := ClientImpl{safeguards: newSafeguards(Safeguards{
+		ProtectedNamespaces: []string{"kube-system", "default"},
+		ProtectedKinds:      []string{"CustomResourceDefinition.apiextensions.k8s.io", "ClusterRole"},
+	})}
+
+	tests := []struct {
+		name       string
+		apiVersion string
+		kind       string
+		namespace  string
+		resource   string
+		protected  bool
+	}{
+		{"namespace", "v1", "ConfigMap", "kube-system", "coredns", true},
+		{"namespace_itself", "v1", "Namespace", "", "default", true},
+		{"kind_group", "apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "", "databases.example.com", true},
+		{"kind", "rbac.authorization.k8s.io/v1", "ClusterRole", "", "admin", true},
+		{"kind_other_group", "example.com/v1", "CustomResourceDefinition", "pr-12", "crd", false},
+		{"unprotected", "v1", "Namespace", "", "pr-12", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := client.checkProtected(test.apiVersion, test.kind, test.namespace, test.resource)
+			if test.protected && err == nil {
+				t.Errorf("Expected %s %s %s/%s to be protected", test.apiVersion, test.kind, test.namespace, test.resource)
+			} else if !test.protected && err != nil {
+				t.Errorf("Expected %s %s %s/%s to not be protected: %s", test.apiVersion, test.kind, test.namespace, test.resource, err.Error())
+			}
+		})
+	}
+}
+
+func TestCheckDeletions(t *testing.T) {
+	configMaps := &metav1.APIResource{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}
+	resource := func(name string, labels map[string]string) Resource {
+		return Resource{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "pr-12", Labels: labels}}
+	}
+	managed := map[string]string{"app.kubernetes.io/managed-by": "azd-kubernetes-manager"}
+
+	t.Run("required_label", func(t *testing.T) {
+		client := ClientImpl{safeguards: newSafeguards(Safeguards{RequiredDeleteLabel: "app.kubernetes.io/managed-by=azd-kubernetes-manager"})}
+
+		if err := client.checkDeletions("v1", configMaps, []Resource{resource("a", managed)}); err != nil {
+			t.Errorf("Expected a managed resource to be deleted: %s", err.Error())
+		}
+
+		err := client.checkDeletions("v1", configMaps, []Resource{resource("a", managed), resource("b", nil)})
+		if err == nil || !strings.Contains(err.Error(), "pr-12/b") {
+			t.Errorf("Expected the unmanaged resource to be rejected, but received %v", err)
+		}
+	})
+
+	t.Run("per_execution", func(t *testing.T) {
+		client := ClientImpl{safeguards: newSafeguards(Safeguards{MaxDeletionsPerExecution: 2})}
+		execution := client.NewExecution().(ExecutionImpl)
+
+		if err := execution.checkDeletions("v1", configMaps, []Resource{resource("a", nil), resource("b", nil)}); err != nil {
+			t.Fatalf("Expected 2 deletions to be allowed: %s", err.Error())
+		}
+		if err := execution.checkDeletions("v1", configMaps, []Resource{resource("c", nil)}); err == nil {
+			t.Fatalf("Expected the third deletion to trip the circuit breaker")
+		}
+		if execution.Aborted() == nil {
+			t.Errorf("Expected the execution to be aborted")
+		}
+		if err := execution.checkProtected("v1", "ConfigMap", "pr-12", "settings"); err == nil {
+			t.Errorf("Expected an aborted execution to refuse every change")
+		}
+
+		// Other executions have their own limit
+		if err := client.NewExecution().(ExecutionImpl).checkDeletions("v1", configMaps, []Resource{resource("c", nil)}); err != nil {
+			t.Errorf("Expected a new execution to be allowed to delete: %s", err.Error())
+		}
+	})
+
+	t.Run("per_window", func(t *testing.T) {
+		client := ClientImpl{safeguards: newSafeguards(Safeguards{MaxDeletionsPerWindow: 2, DeletionWindow: time.Hour})}
+
+		if err := client.NewExecution().(ExecutionImpl).checkDeletions("v1", configMaps, []Resource{resource("a", nil), resource("b", nil)}); err != nil {
+			t.Fatalf("Expected 2 deletions to be allowed: %s", err.Error())
+		}
+		if err := client.NewExecution().(ExecutionImpl).checkDeletions("v1", configMaps, []Resource{resource("c", nil)}); err == nil {
+			t.Fatalf("Expected the third deletion in the window to trip the circuit breaker")
+		}
+
+		// Deletions outside of the window are forgotten
+		client.safeguards.deletions[0] = time.Now().Add(-2 * time.Hour)
+		if err := client.NewExecution().(ExecutionImpl).checkDeletions("v1", configMaps, []Resource{resource("c", nil)}); err != nil {
+			t.Errorf("Expected a deletion to be allowed after the window: %s", err.Error())
+		}
+	})
+
+	t.Run("dry_run", func(t *testing.T) {
+		client := ClientImpl{safeguards: newSafeguards(Safeguards{MaxDeletionsPerExecution: 1})}
+		dryRun := client.NewExecution().(ExecutionImpl).DryRun().(DryRunClientImpl)
+
+		if err := dryRun.checkDeletions("v1", configMaps, []Resource{resource("a", nil), resource("b", nil)}); err != nil {
+			t.Errorf("Expected dry run deletions to not count: %s", err.Error())
+		}
+	})
+}
@@ -0,0 +1,195 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+)
+
+// ScaleOptions holds the options to scale resources
+type ScaleOptions struct {
+	// The number of replicas to scale to
+	Replicas *int32
+
+	// If defined, the replica count before scaling is recorded in this annotation
+	PreviousReplicasAnnotation string
+
+	// If true, scale to the replica count recorded in PreviousReplicasAnnotation, falling back to Replicas
+	Restore bool
+}
+
+// Scale Kubernetes resource(s) with the scale subresource. If a name is given, then only that resource is scaled. Otherwise, every resource matching the label selector is scaled.
+func (c ClientImpl) Scale(apiVersion string, kind string, namespace string, name string, labelSelector metav1.LabelSelector, options ScaleOptions) error {
+	apiResource, err := c.GetAPIResource(apiVersion, kind)
+	if err != nil {
+		return fmt.Errorf("Error getting API Resource %s for API %s: %s", kind, apiVersion, err.Error())
+	}
+
+	client, err := c.RESTClient(apiVersion)
+	if err != nil {
+		return fmt.Errorf("Error getting REST client for API %s: %s", apiVersion, err.Error())
+	}
+
+	resources, err := c.find(apiVersion, kind, namespace, name, labelSelector)
+	if err != nil {
+		return err
+	}
+
+	return c.executor.run(resources, "Errors scaling resources", func(resource Resource) error {
+		err := c.scaleResource(client, apiResource, resource, options)
+		if err != nil {
+			return fmt.Errorf("Error scaling %s %s %s: %w", apiVersion, kind, resource.Name, err)
+		}
+		return nil
+	})
+}
+
+// scaleResource scales a single resource
+func (c ClientImpl) scaleResource(client rest.Interface, apiResource *metav1.APIResource, resource Resource, options ScaleOptions) error {
+	if err := c.checkProtected(client.APIVersion().String(), apiResource.Kind, resource.Namespace, resource.Name); err != nil {
+		return err
+	}
+
+	scaleBody, err := client.Get().
+		NamespaceIfScoped(resource.Namespace, resource.Namespace != "").
+		Resource(apiResource.Name).
+		Name(resource.Name).
+		SubResource("scale").
+		Do().
+		Raw()
+	if err != nil {
+		return fmt.Errorf("Error getting the scale subresource: %w", err)
+	}
+
+	scale := unstructured.Unstructured{}
+	if err := json.Unmarshal(scaleBody, &scale.Object); err != nil {
+		return fmt.Errorf("Error parsing the scale subresource: %s", err.Error())
+	}
+
+	currentReplicas, _, err := unstructured.NestedFloat64(scale.Object, "spec", "replicas")
+	if err != nil {
+		return fmt.Errorf("Error reading the current replicas: %s", err.Error())
+	}
+
+	var replicas *int32
+	if options.Restore {
+		annotations, err := getAnnotations(client, apiResource, resource)
+		if err != nil {
+			return err
+		}
+		if value, exists := annotations[options.PreviousReplicasAnnotation]; exists {
+			previousReplicas, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return fmt.Errorf("Error parsing the previous replicas from annotation %s: %s", options.PreviousReplicasAnnotation, err.Error())
+			}
+			restoredReplicas := int32(previousReplicas)
+			replicas = &restoredReplicas
+		}
+	}
+	if replicas == nil {
+		replicas = options.Replicas
+	}
+	if replicas == nil {
+		return fmt.Errorf("No replica count was defined and annotation %s was not found", options.PreviousReplicasAnnotation)
+	}
+
+	if int32(currentReplicas) != *replicas || (options.Restore && options.PreviousReplicasAnnotation != "") {
+		if err := c.snapshot(client, apiResource, resource); err != nil {
+			return err
+		}
+	}
+
+	if int32(currentReplicas) != *replicas {
+		// Record the previous replica count before scaling, so that it can always be restored
+		if options.PreviousReplicasAnnotation != "" && !options.Restore {
+			if err := c.patchAnnotation(client, apiResource, resource, options.PreviousReplicasAnnotation, strconv.Itoa(int(currentReplicas))); err != nil {
+				return err
+			}
+		}
+
+		if err := unstructured.SetNestedField(scale.Object, int64(*replicas), "spec", "replicas"); err != nil {
+			return fmt.Errorf("Error setting the replicas: %s", err.Error())
+		}
+
+		body, err := scale.MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("Error serializing the scale subresource: %s", err.Error())
+		}
+
+		err = c.withDryRun(client.Put()).
+			NamespaceIfScoped(resource.Namespace, resource.Namespace != "").
+			Resource(apiResource.Name).
+			Name(resource.Name).
+			SubResource("scale").
+			Body(body).
+			Do().
+			Error()
+		if err != nil {
+			return fmt.Errorf("Error updating the scale subresource: %w", err)
+		}
+
+		if !c.recordDryRun(Change{ChangeActionScale, client.APIVersion().String(), apiResource.Kind, resource.Namespace, resource.Name, c.cluster}) {
+			logger.Infof("Scaled %s %s from %d to %d replicas", apiResource.Kind, resource.Name, int32(currentReplicas), *replicas)
+		}
+	} else {
+		logger.Infof("%s %s already has %d replicas", apiResource.Kind, resource.Name, *replicas)
+	}
+
+	if options.Restore && options.PreviousReplicasAnnotation != "" {
+		if err := c.patchAnnotation(client, apiResource, resource, options.PreviousReplicasAnnotation, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getAnnotations returns the annotations of a resource
+func getAnnotations(client rest.Interface, apiResource *metav1.APIResource, resource Resource) (map[string]string, error) {
+	body, err := client.Get().
+		NamespaceIfScoped(resource.Namespace, resource.Namespace != "").
+		Resource(apiResource.Name).
+		Name(resource.Name).
+		Do().
+		Raw()
+	if err != nil {
+		return nil, fmt.Errorf("Error getting the annotations: %w", err)
+	}
+
+	result := unstructured.Unstructured{}
+	if err := json.Unmarshal(body, &result.Object); err != nil {
+		return nil, fmt.Errorf("Error parsing the annotations: %s", err.Error())
+	}
+	return result.GetAnnotations(), nil
+}
+
+// patchAnnotation sets an annotation on a resource, or removes it if the value is nil
+func (c ClientImpl) patchAnnotation(client rest.Interface, apiResource *metav1.APIResource, resource Resource, annotation string, value interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				annotation: value,
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("Error serializing the annotation patch: %s", err.Error())
+	}
+
+	err = c.withDryRun(client.Patch(types.MergePatchType)).
+		NamespaceIfScoped(resource.Namespace, resource.Namespace != "").
+		Resource(apiResource.Name).
+		Name(resource.Name).
+		Body(patch).
+		Do().
+		Error()
+	if err != nil {
+		return fmt.Errorf("Error patching annotation %s: %w", annotation, err)
+	}
+	return nil
+}
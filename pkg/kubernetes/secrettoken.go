@@ -0,0 +1,106 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// minSecretRefreshInterval is how long a token read from a Secret is trusted, before a request that the cluster rejects reads the Secret again
+	minSecretRefreshInterval = 10 * time.Second
+)
+
+// secretTokenReader reads the bearer token of a cluster from its Secret
+type secretTokenReader func() (string, error)
+
+// secretToken is the bearer token of a cluster, read from a Secret in the default cluster.
+// When the cluster rejects the token, the Secret is read again, so that rotated or expired tokens are replaced without a restart.
+type secretToken struct {
+	mutex   sync.Mutex
+	token   string
+	fetched time.Time
+	read    secretTokenReader
+
+	// How long a token is trusted before a rejected request reads the Secret again
+	refreshInterval time.Duration
+}
+
+// newSecretToken returns the token that was read from a Secret, and reads the Secret again with the reader
+func newSecretToken(token string, read secretTokenReader) *secretToken {
+	return &secretToken{token: token, fetched: time.Now(), read: read, refreshInterval: minSecretRefreshInterval}
+}
+
+// get returns the current token
+func (t *secretToken) get() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.token
+}
+
+// refresh reads the Secret again after the cluster rejected the given token, and returns the current token.
+// If another request already replaced the rejected token, or the Secret was just read, the Secret isn't read again.
+func (t *secretToken) refresh(rejected string) (string, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.token != rejected || time.Since(t.fetched) < t.refreshInterval {
+		return t.token, nil
+	}
+
+	token, err := t.read()
+	if err != nil {
+		return t.token, err
+	}
+	if token != t.token {
+		logger.Infof("Read a new token from the Secret of a cluster, after the cluster rejected the previous token")
+	}
+	t.token, t.fetched = token, time.Now()
+	return t.token, nil
+}
+
+// wrapTransport returns a transport that authenticates requests with the token, and retries a request once with a new token if the cluster rejects it
+func (t *secretToken) wrapTransport(next http.RoundTripper) http.RoundTripper {
+	return secretTokenRoundTripper{token: t, next: next}
+}
+
+// secretTokenRoundTripper authenticates requests with the token of a Secret
+type secretTokenRoundTripper struct {
+	token *secretToken
+	next  http.RoundTripper
+}
+
+// RoundTrip sends a request with the current token. If the cluster responds with 401 Unauthorized, the Secret is read again,
+// and the request is sent again with the new token if there is one and the body of the request can be sent again.
+func (rt secretTokenRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	token := rt.token.get()
+	response, err := rt.next.RoundTrip(withBearerToken(request, token))
+	if err != nil || response.StatusCode != http.StatusUnauthorized {
+		return response, err
+	}
+
+	refreshed, err := rt.token.refresh(token)
+	if err != nil {
+		logger.Warningf("Error reading the token of a cluster again, after the cluster rejected it: %s", err.Error())
+		return response, nil
+	} else if refreshed == token || (request.Body != nil && request.GetBody == nil) {
+		return response, nil
+	}
+
+	retry := withBearerToken(request, refreshed)
+	if request.GetBody != nil {
+		if retry.Body, err = request.GetBody(); err != nil {
+			return response, nil
+		}
+	}
+	response.Body.Close()
+	return rt.next.RoundTrip(retry)
+}
+
+// withBearerToken returns a copy of a request that is authenticated with the token
+func withBearerToken(request *http.Request, token string) *http.Request {
+	request = request.Clone(request.Context())
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return request
+}
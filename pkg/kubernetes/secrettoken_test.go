@@ -0,0 +1,74 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSecretTokenRotation(t *testing.T) {
+	var mutex sync.Mutex
+	accepted := "Bearer new"
+	var bodies []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if request.Header.Get("Authorization") != accepted {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(request.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	reads := 0
+	token := newSecretToken("old", func() (string, error) {
+		reads++
+		return "new", nil
+	})
+	token.refreshInterval = 0
+	client := &http.Client{Transport: token.wrapTransport(http.DefaultTransport)}
+
+	send := func() int {
+		response, err := client.Post(server.URL, "application/json", strings.NewReader(`{"kind":"ConfigMap"}`))
+		if err != nil {
+			t.Fatalf("Expected the request to be sent: %s", err.Error())
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	// The rotated token is read from the Secret, and the request is sent again with its body
+	if status := send(); status != http.StatusOK || reads != 1 {
+		t.Errorf("Expected the request to succeed with the new token after 1 read, but received %d after %d reads", status, reads)
+	}
+	if len(bodies) != 1 || bodies[0] != `{"kind":"ConfigMap"}` {
+		t.Errorf("Expected the body to be sent again, but received %v", bodies)
+	}
+
+	// The new token is used without reading the Secret again
+	if status := send(); status != http.StatusOK || reads != 1 {
+		t.Errorf("Expected the request to succeed without reading the Secret, but received %d after %d reads", status, reads)
+	}
+
+	// A token that the Secret doesn't replace is rejected without sending the request again
+	mutex.Lock()
+	accepted = "Bearer newer"
+	mutex.Unlock()
+	if status := send(); status != http.StatusUnauthorized || reads != 2 {
+		t.Errorf("Expected the request to be rejected after 2 reads, but received %d after %d reads", status, reads)
+	}
+
+	// The Secret isn't read again while the token is trusted
+	token.refreshInterval = time.Hour
+	if status := send(); status != http.StatusUnauthorized || reads != 2 {
+		t.Errorf("Expected the request to be rejected without reading the Secret, but received %d after %d reads", status, reads)
+	}
+}
@@ -0,0 +1,256 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+)
+
+// SweepOptions holds the options to select which kinds of resources are deleted by a sweep
+type SweepOptions struct {
+	// The API groups to sweep. The core API group is "". If empty, every API group is swept.
+	Groups []string
+
+	// If defined, only namespaced (true) or cluster-scoped (false) kinds are swept
+	Namespaced *bool
+
+	// The kinds to sweep, as "Kind" or "Kind.group". If empty, every kind is swept.
+	IncludeKinds []string
+
+	// The kinds to never sweep, as "Kind" or "Kind.group"
+	ExcludeKinds []string
+}
+
+// SweepResult is what a sweep found and deleted for a kind
+type SweepResult struct {
+	APIVersion string
+	Kind       string
+
+	// The number of resources matching the selectors
+	Found int
+
+	// The number of resources deleted, after the retention policy
+	Deleted int
+
+	// The error deleting this kind, if any
+	Error error
+}
+
+// Describe returns a user-friendly representation of a SweepResult
+func (r SweepResult) Describe() string {
+	if r.Error != nil {
+		return fmt.Sprintf("%s %s: found %d, error: %s", r.APIVersion, r.Kind, r.Found, strings.ReplaceAll(r.Error.Error(), "\n", "\n  "))
+	}
+	return fmt.Sprintf("%s %s: found %d, deleted %d", r.APIVersion, r.Kind, r.Found, r.Deleted)
+}
+
+// Sweep deletes the resources of every kind that can be listed and deleted, and that match the sweep options.
+// If a namespace, or namespaces in the delete options, are given, only namespaced kinds are swept. A result is returned for every kind that had matching resources or an error.
+// Every kind is listed before anything is deleted, so that the limit and the retention policy apply to the resources of all of them together.
+func (c ClientImpl) Sweep(namespace string, name string, labelSelector metav1.LabelSelector, sweepOptions SweepOptions, options DeleteOptions) ([]SweepResult, error) {
+	if SelectsEverything(name, options.FieldSelector, labelSelector) {
+		return nil, fmt.Errorf("Error sweeping resources: the name, the field selector and the label selector are all empty, which would delete every resource")
+	}
+
+	fieldSelector, err := options.fieldSelector(name)
+	if err != nil {
+		return nil, fmt.Errorf("Error sweeping resources: %s", err.Error())
+	}
+
+	apiResourceLists, err := c.preferredAPIResources()
+	if err != nil {
+		return nil, fmt.Errorf("Error discovering the API resources to sweep: %s", err.Error())
+	}
+
+	apiResourceLists = discovery.FilteredBy(discovery.SupportsAllVerbs{Verbs: []string{"list", "delete"}}, apiResourceLists)
+
+	var kinds []*sweptKind
+	for _, apiResourceList := range apiResourceLists {
+		groupVersion, err := schema.ParseGroupVersion(apiResourceList.GroupVersion)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing API Version %s: %s", apiResourceList.GroupVersion, err.Error())
+		}
+
+		for i := range apiResourceList.APIResources {
+			apiResource := apiResourceList.APIResources[i]
+			if !sweepOptions.Matches(groupVersion.Group, apiResource) || ((namespace != "" || len(options.Namespaces) > 0) && !apiResource.Namespaced) {
+				continue
+			}
+			kinds = append(kinds, &sweptKind{
+				apiResource: &apiResource,
+				result:      SweepResult{APIVersion: apiResourceList.GroupVersion, Kind: apiResource.Kind},
+			})
+		}
+	}
+
+	// Some kinds are served by more than one API group, such as Ingresses in extensions and networking.k8s.io.
+	// Their resources are only counted and deleted for the first API group that lists them.
+	var found []Resource
+	listed := make(map[types.UID]bool)
+	listFailed := false
+	for _, kind := range kinds {
+		resources, err := c.listForDelete(kind.result.APIVersion, kind.result.Kind, namespace, labelSelector, fieldSelector, options)
+		if err != nil {
+			kind.result.Error = err
+			listFailed = true
+			continue
+		}
+
+		for _, resource := range resources {
+			if resource.UID != "" {
+				if listed[resource.UID] {
+					continue
+				}
+				listed[resource.UID] = true
+			}
+			// The kind is kept on the resource, so that the resources to delete can be grouped by kind again
+			resource.APIVersion = kind.result.APIVersion
+			resource.Kind = kind.result.Kind
+			found = append(found, resource)
+			kind.result.Found++
+		}
+	}
+
+	if listFailed && (options.Limit != nil || options.Retain != nil) {
+		// The limit and the retention policy can't be applied to resources that weren't listed
+		return sweepResults(kinds, fmt.Errorf("Errors sweeping resources, so nothing was deleted:\n%s", sweepErrors(kinds)))
+	}
+
+	resources, err := options.Filter(found)
+	if err != nil {
+		return sweepResults(kinds, fmt.Errorf("Error sweeping resources: %s", err.Error()))
+	}
+
+	for _, kind := range kinds {
+		var kindResources []Resource
+		for _, resource := range resources {
+			if resource.APIVersion == kind.result.APIVersion && resource.Kind == kind.result.Kind {
+				kindResources = append(kindResources, resource)
+			}
+		}
+		if kind.result.Error != nil || len(kindResources) == 0 {
+			continue
+		}
+
+		kind.result.Error = c.deleteResources(kind.result.APIVersion, kind.apiResource, kindResources, options)
+		if kind.result.Error == nil {
+			kind.result.Deleted = len(kindResources)
+		}
+	}
+
+	if errors := sweepErrors(kinds); errors != "" {
+		return sweepResults(kinds, fmt.Errorf("Errors sweeping resources:\n%s", errors))
+	}
+	return sweepResults(kinds, nil)
+}
+
+// sweptKind is a kind matched by a sweep, and what the sweep found and deleted for it
+type sweptKind struct {
+	apiResource *metav1.APIResource
+	result      SweepResult
+}
+
+// sweepResults returns the results of the kinds that had matching resources or an error, sorted by API Version and kind
+func sweepResults(kinds []*sweptKind, err error) ([]SweepResult, error) {
+	var results []SweepResult
+	for _, kind := range kinds {
+		if kind.result.Found > 0 || kind.result.Error != nil {
+			results = append(results, kind.result)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].APIVersion != results[j].APIVersion {
+			return results[i].APIVersion < results[j].APIVersion
+		}
+		return results[i].Kind < results[j].Kind
+	})
+
+	return results, err
+}
+
+// sweepErrors returns the errors of every kind, one per line
+func sweepErrors(kinds []*sweptKind) string {
+	var errors []string
+	for _, kind := range kinds {
+		if kind.result.Error != nil {
+			errors = append(errors, fmt.Sprintf("- %s", kind.result.Describe()))
+		}
+	}
+	return strings.Join(errors, "\n")
+}
+
+// preferredAPIResources returns the API resources of the preferred version of every API group.
+// The API groups are listed on every call, so that new API groups are swept, and the API resources of each version come from the discovery cache.
+// API groups that can't be discovered, such as unavailable aggregated APIs, are skipped, so that the other API groups are still swept.
+func (c ClientImpl) preferredAPIResources() ([]*metav1.APIResourceList, error) {
+	groups, err := c.client.Discovery().ServerGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	var apiResourceLists []*metav1.APIResourceList
+	var failed []string
+	for _, group := range groups.Groups {
+		apiVersion := group.PreferredVersion.GroupVersion
+		apiResourceList, err := c.GetAPIResources(apiVersion)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", apiVersion, err.Error()))
+			continue
+		}
+		apiResourceLists = append(apiResourceLists, apiResourceList)
+	}
+
+	if len(failed) > 0 {
+		logger.Warningf("Some API groups could not be discovered, so they won't be swept:\n%s", strings.Join(failed, "\n"))
+	}
+
+	return apiResourceLists, nil
+}
+
+// Matches returns true if a kind should be swept. Subresources are never swept.
+func (o SweepOptions) Matches(group string, apiResource metav1.APIResource) bool {
+	if strings.Contains(apiResource.Name, "/") {
+		return false
+	}
+
+	if len(o.Groups) > 0 && !containsFold(o.Groups, group) {
+		return false
+	}
+
+	if o.Namespaced != nil && *o.Namespaced != apiResource.Namespaced {
+		return false
+	}
+
+	if len(o.IncludeKinds) > 0 && !matchesKind(o.IncludeKinds, group, apiResource.Kind) {
+		return false
+	}
+
+	return !matchesKind(o.ExcludeKinds, group, apiResource.Kind)
+}
+
+// matchesKind returns true if a kind matches one of the "Kind" or "Kind.group" patterns
+func matchesKind(patterns []string, group string, kind string) bool {
+	for _, pattern := range patterns {
+		split := strings.SplitN(pattern, ".", 2)
+		if strings.EqualFold(split[0], kind) && (len(split) == 1 || strings.EqualFold(split[1], group)) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold returns true if the slice contains the value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
+
+func TestSweepOptionsMatches(t *testing.T) {
+	namespaced := true
+	deployments := metav1.APIResource{Name: "deployments", Kind: "Deployment", Namespaced: true}
+	namespaces := metav1.APIResource{Name: "namespaces", Kind: "Namespace", Namespaced: false}
+	podLogs := metav1.APIResource{Name: "pods/log", Kind: "Pod", Namespaced: true}
+
+	tests := []struct {
+		name        string
+		options     SweepOptions
+		group       string
+		apiResource metav1.APIResource
+		matches     bool
+	}{
+		{"everything", SweepOptions{}, "apps", deployments, true},
+		{"subresource", SweepOptions{}, "", podLogs, false},
+		{"group_match", SweepOptions{Groups: []string{"apps"}}, "apps", deployments, true},
+		{"group_core", SweepOptions{Groups: []string{""}}, "apps", deployments, false},
+		{"namespaced", SweepOptions{Namespaced: &namespaced}, "", namespaces, false},
+		{"include_kind", SweepOptions{IncludeKinds: []string{"deployment"}}, "apps", deployments, true},
+		{"include_kind_group", SweepOptions{IncludeKinds: []string{"Deployment.extensions"}}, "apps", deployments, false},
+		{"exclude_kind", SweepOptions{ExcludeKinds: []string{"Namespace"}}, "", namespaces, false},
+		{"exclude_kind_group", SweepOptions{ExcludeKinds: []string{"Deployment.extensions"}}, "apps", deployments, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if matches := test.options.Matches(test.group, test.apiResource); matches != test.matches {
+				t.Errorf("Expected %t but received %t", test.matches, matches)
+			}
+		})
+	}
+}
+
+func TestSweepAcrossKinds(t *testing.T) {
+	var mutex sync.Mutex
+	var deleted []string
+
+	// Each item is the name, the UID and the build of a resource
+	items := map[string][][]string{
+		"/api/v1/namespaces/preview/configmaps": {{"settings-1", "uid-1", "1"}, {"settings-4", "uid-4", "4"}},
+		// Ingresses are served by both extensions and networking.k8s.io
+		"/apis/extensions/v1beta1/namespaces/preview/ingresses":        {{"web-2", "uid-2", "2"}, {"web-3", "uid-3", "3"}},
+		"/apis/networking.k8s.io/v1beta1/namespaces/preview/ingresses": {{"web-2", "uid-2", "2"}, {"web-3", "uid-3", "3"}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		writer.Header().Set("Content-Type", "application/json")
+		if request.Method == http.MethodDelete {
+			deleted = append(deleted, request.URL.Path)
+			writer.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+			return
+		}
+
+		group := func(name string, version string) string {
+			return fmt.Sprintf(`{"name":"%s","versions":[{"groupVersion":"%s/%s","version":"%s"}],"preferredVersion":{"groupVersion":"%s/%s","version":"%s"}}`,
+				name, name, version, version, name, version, version)
+		}
+		ingresses := `{"kind":"APIResourceList","resources":[{"name":"ingresses","kind":"Ingress","namespaced":true,"verbs":["list","delete"]}]}`
+
+		switch request.URL.Path {
+		case "/api":
+			writer.Write([]byte(`{"kind":"APIVersions","versions":["v1"]}`))
+		case "/apis":
+			writer.Write([]byte(`{"kind":"APIGroupList","apiVersion":"v1","groups":[` + group("extensions", "v1beta1") + "," + group("networking.k8s.io", "v1beta1") + `]}`))
+		case "/api/v1":
+			writer.Write([]byte(`{"kind":"APIResourceList","groupVersion":"v1","resources":[{"name":"configmaps","kind":"ConfigMap","namespaced":true,"verbs":["list","delete"]}]}`))
+		case "/apis/extensions/v1beta1", "/apis/networking.k8s.io/v1beta1":
+			writer.Write([]byte(ingresses))
+		default:
+			var list []string
+			for _, item := range items[request.URL.Path] {
+				list = append(list, fmt.Sprintf(`{"metadata":{"namespace":"preview","name":"%s","uid":"%s","labels":{"build":"%s"}}}`, item[0], item[1], item[2]))
+			}
+			writer.Write([]byte(`{"apiVersion":"v1","kind":"List","items":[` + strings.Join(list, ",") + `]}`))
+		}
+	}))
+	defer server.Close()
+
+	client, err := newClient("", &rest.Config{Host: server.URL, QPS: 1000, Burst: 1000}, ClientOptions{DiscoveryCacheTTL: time.Hour, Concurrency: 2})
+	if err != nil {
+		t.Fatalf("Expected a client: %s", err.Error())
+	}
+	client.executor = newExecutor(2, 0)
+	selector := metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "build", Operator: metav1.LabelSelectorOpExists}}}
+
+	// The limit counts the resources of every kind, and the Ingresses only once
+	limit := 3
+	results, err := client.Sweep("preview", "", selector, SweepOptions{}, DeleteOptions{Limit: &limit})
+	if err == nil || !strings.Contains(err.Error(), "4 resources matched") {
+		t.Errorf("Expected the limit to be exceeded by the 4 resources, but received: %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("Expected nothing to be deleted, but received %v", deleted)
+	}
+	found := 0
+	for _, result := range results {
+		found += result.Found
+	}
+	if found != 4 {
+		t.Errorf("Expected 4 resources to be found, but received %v", results)
+	}
+
+	// The newest builds are retained across the kinds
+	results, err = client.Sweep("preview", "", selector, SweepOptions{}, DeleteOptions{Retain: &RetentionPolicy{Count: 2, Label: "build"}})
+	if err != nil {
+		t.Fatalf("Expected the sweep to succeed: %s", err.Error())
+	}
+	sort.Strings(deleted)
+	expected := []string{"/api/v1/namespaces/preview/configmaps/settings-1", "/apis/extensions/v1beta1/namespaces/preview/ingresses/web-2"}
+	if strings.Join(deleted, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v to be deleted, but received %v", expected, deleted)
+	}
+	if len(results) != 2 || results[0].Deleted != 1 || results[1].Deleted != 1 {
+		t.Errorf("Expected a ConfigMap and an Ingress to be deleted, but received %v", results)
+	}
+}
@@ -0,0 +1,263 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/rest"
+)
+
+var (
+	rollbackCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "azd_kubernetes_manager_rollback_action_count",
+		Help: "The total number of compensation actions taken when rolling back a transaction",
+	}, []string{"action", "result"})
+)
+
+// Transaction is a Client that records the resources it creates and changes, so that they can be rolled back
+type Transaction interface {
+	Client
+
+	// Rollback deletes the created resources in reverse order, and restores the changed resources from the snapshots taken before they were first changed.
+	// The rollback is subject to the safeguards, and its deletions count against the circuit breaker.
+	Rollback() error
+}
+
+// TransactionImpl is the interface implementation of Transaction
+type TransactionImpl struct {
+	ClientImpl
+}
+
+// journal records the changes made during a transaction
+type journal struct {
+	mutex   sync.Mutex
+	entries []journalEntry
+	keys    map[string]bool
+}
+
+// journalEntry is a resource that was created, or a snapshot of a resource before it was changed
+type journalEntry struct {
+	cluster     string
+	impersonate rest.ImpersonationConfig
+	apiResource metav1.APIResource
+	created     bool
+	resource    unstructured.Unstructured
+}
+
+// Begin starts a transaction
+func (c ClientImpl) Begin() Transaction {
+	c.journal = &journal{keys: make(map[string]bool)}
+	return TransactionImpl{c}
+}
+
+// record adds an entry to the journal, unless the resource was already recorded
+func (j *journal) record(cluster string, impersonate rest.ImpersonationConfig, apiResource *metav1.APIResource, created bool, resource unstructured.Unstructured) {
+	if j == nil {
+		return
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	key := fmt.Sprintf("%s/%s/%s/%s/%s", cluster, resource.GetAPIVersion(), apiResource.Name, resource.GetNamespace(), resource.GetName())
+	if j.keys[key] {
+		return
+	}
+	j.keys[key] = true
+	j.entries = append(j.entries, journalEntry{cluster, impersonate, *apiResource, created, resource})
+}
+
+// recordCreate records a resource that was created
+func (c ClientImpl) recordCreate(apiResource *metav1.APIResource, resource unstructured.Unstructured) {
+	if c.dryRun != nil {
+		return
+	}
+	c.journal.record(c.cluster, c.impersonate, apiResource, true, resource)
+}
+
+// recordUpdate records the snapshot of a resource that is about to be changed
+func (c ClientImpl) recordUpdate(apiResource *metav1.APIResource, resource unstructured.Unstructured) {
+	if c.dryRun != nil {
+		return
+	}
+	c.journal.record(c.cluster, c.impersonate, apiResource, false, resource)
+}
+
+// snapshot records a resource that is about to be changed. Nothing is retrieved outside of a transaction or in dry run mode.
+func (c ClientImpl) snapshot(client rest.Interface, apiResource *metav1.APIResource, resource Resource) error {
+	if c.journal == nil || c.dryRun != nil {
+		return nil
+	}
+
+	body, err := client.Get().
+		NamespaceIfScoped(resource.Namespace, resource.Namespace != "").
+		Resource(apiResource.Name).
+		Name(resource.Name).
+		Do().
+		Raw()
+	if err != nil {
+		return fmt.Errorf("Error getting a snapshot of %s %s: %w", apiResource.Kind, resource.Name, err)
+	}
+
+	existing := unstructured.Unstructured{}
+	if err := json.Unmarshal(body, &existing.Object); err != nil {
+		return fmt.Errorf("Error parsing a snapshot of %s %s: %s", apiResource.Kind, resource.Name, err.Error())
+	}
+
+	c.recordUpdate(apiResource, existing)
+	return nil
+}
+
+// Rollback deletes the created resources in reverse order, and restores the changed resources from their snapshots
+func (t TransactionImpl) Rollback() error {
+	t.journal.mutex.Lock()
+	entries := t.journal.entries
+	t.journal.entries = nil
+	t.journal.keys = make(map[string]bool)
+	t.journal.mutex.Unlock()
+
+	var errors []string
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		description := describeResource(entry.resource)
+		if entry.cluster != "" {
+			description = fmt.Sprintf("%s on cluster %s", description, entry.cluster)
+		}
+
+		action := "restore"
+		var err error
+		if entry.created {
+			action = "delete"
+			err = t.rollbackCreate(entry)
+		} else {
+			err = t.rollbackUpdate(entry)
+		}
+
+		if err != nil {
+			logger.Errorf("Error rolling back %s: %s", description, err.Error())
+			rollbackCounter.With(prometheus.Labels{"action": action, "result": "failure"}).Inc()
+			errors = append(errors, fmt.Sprintf("- Error rolling back %s: %s", description, strings.ReplaceAll(err.Error(), "\n", "\n  ")))
+		} else {
+			rollbackCounter.With(prometheus.Labels{"action": action, "result": "success"}).Inc()
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("Errors rolling back the transaction:\n%s", strings.Join(errors, "\n"))
+	}
+
+	return nil
+}
+
+// clientFor returns a client for the cluster of a journal entry, impersonating the identity that made the change.
+// The client keeps the safeguards and the execution of the transaction.
+func (t TransactionImpl) clientFor(entry journalEntry) (ClientImpl, rest.Interface, error) {
+	clusterClient, err := t.forCluster(entry.cluster)
+	if err != nil {
+		return clusterClient, nil, err
+	}
+
+	clusterClient.impersonate = entry.impersonate
+	if clusterClient, err = clusterClient.impersonated(); err != nil {
+		return clusterClient, nil, err
+	}
+
+	client, err := clusterClient.RESTClient(entry.resource.GetAPIVersion())
+	return clusterClient, client, err
+}
+
+// rollbackCreate deletes a resource that was created during the transaction.
+// The deletion is checked by the safeguards and counted against the circuit breaker like any other deletion.
+func (t TransactionImpl) rollbackCreate(entry journalEntry) error {
+	clusterClient, client, err := t.clientFor(entry)
+	if err != nil {
+		return err
+	}
+
+	resource := Resource{
+		TypeMeta:   metav1.TypeMeta{APIVersion: entry.resource.GetAPIVersion(), Kind: entry.resource.GetKind()},
+		ObjectMeta: metav1.ObjectMeta{Namespace: entry.resource.GetNamespace(), Name: entry.resource.GetName(), Labels: entry.resource.GetLabels()},
+	}
+	if err := clusterClient.checkDeletions(entry.resource.GetAPIVersion(), &entry.apiResource, []Resource{resource}); err != nil {
+		return err
+	}
+
+	propagationPolicy := metav1.DeletePropagationBackground
+	body, err := DeleteOptions{PropagationPolicy: &propagationPolicy}.body()
+	if err != nil {
+		return err
+	}
+
+	err = client.Delete().
+		NamespaceIfScoped(entry.resource.GetNamespace(), entry.apiResource.Namespaced).
+		Resource(entry.apiResource.Name).
+		Name(entry.resource.GetName()).
+		Body(body).
+		Do().
+		Error()
+	if apierrors.IsNotFound(err) {
+		logger.Infof("Rollback: %s was already deleted", describeResource(entry.resource))
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	logger.Infof("Rollback: deleted %s", describeResource(entry.resource))
+	return nil
+}
+
+// rollbackUpdate restores a resource from the snapshot taken before it was changed
+func (t TransactionImpl) rollbackUpdate(entry journalEntry) error {
+	clusterClient, client, err := t.clientFor(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := clusterClient.checkProtected(entry.resource.GetAPIVersion(), entry.resource.GetKind(), entry.resource.GetNamespace(), entry.resource.GetName()); err != nil {
+		return err
+	}
+
+	body, err := client.Get().
+		NamespaceIfScoped(entry.resource.GetNamespace(), entry.apiResource.Namespaced).
+		Resource(entry.apiResource.Name).
+		Name(entry.resource.GetName()).
+		Do().
+		Raw()
+	if err != nil {
+		return err
+	}
+
+	current := unstructured.Unstructured{}
+	if err := json.Unmarshal(body, &current.Object); err != nil {
+		return err
+	}
+
+	restored := unstructured.Unstructured{Object: entry.resource.DeepCopy().Object}
+	restored.SetResourceVersion(current.GetResourceVersion())
+
+	restoredBody, err := restored.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	err = client.Put().
+		NamespaceIfScoped(entry.resource.GetNamespace(), entry.apiResource.Namespaced).
+		Resource(entry.apiResource.Name).
+		Name(entry.resource.GetName()).
+		Body(restoredBody).
+		Do().
+		Error()
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Rollback: restored %s", describeResource(entry.resource))
+	return nil
+}
@@ -0,0 +1,158 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/rest"
+)
+
+func TestTransactionRollback(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []string
+	var restored map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		requests = append(requests, fmt.Sprintf("%s %s", request.Method, request.URL.Path))
+		writer.Header().Set("Content-Type", "application/json")
+
+		switch request.Method {
+		case http.MethodGet:
+			json.NewEncoder(writer).Encode(map[string]interface{}{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]interface{}{"name": "settings", "namespace": "shared", "resourceVersion": "7"},
+				"data":       map[string]interface{}{"mode": "changed"},
+			})
+		case http.MethodPut:
+			json.NewDecoder(request.Body).Decode(&restored)
+			writer.Write([]byte("{}"))
+		default:
+			writer.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := ClientImpl{config: &rest.Config{Host: server.URL}, apiResources: newDiscoveryCache("", 0)}
+	transaction := client.Begin().(TransactionImpl)
+
+	namespaces := &metav1.APIResource{Name: "namespaces", Kind: "Namespace"}
+	configMaps := &metav1.APIResource{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}
+
+	resource := func(kind string, namespace string, name string, data string) unstructured.Unstructured {
+		object := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": kind}}
+		object.SetNamespace(namespace)
+		object.SetName(name)
+		object.SetResourceVersion("1")
+		if data != "" {
+			object.Object["data"] = map[string]interface{}{"mode": data}
+		}
+		return object
+	}
+
+	transaction.recordCreate(namespaces, resource("Namespace", "", "preview", ""))
+	transaction.recordUpdate(configMaps, resource("ConfigMap", "shared", "settings", "original"))
+	// Only the first snapshot of a resource is kept
+	transaction.recordUpdate(configMaps, resource("ConfigMap", "shared", "settings", "intermediate"))
+	transaction.recordCreate(configMaps, resource("ConfigMap", "preview", "settings", ""))
+
+	if err := transaction.Rollback(); err != nil {
+		t.Fatalf("Expected the rollback to succeed: %s", err.Error())
+	}
+
+	expected := []string{
+		"DELETE /api/v1/namespaces/preview/configmaps/settings",
+		"GET /api/v1/namespaces/shared/configmaps/settings",
+		"PUT /api/v1/namespaces/shared/configmaps/settings",
+		"DELETE /api/v1/namespaces/preview",
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected requests:\n%s\nbut received:\n%s", strings.Join(expected, "\n"), strings.Join(requests, "\n"))
+	}
+
+	restoredResource := unstructured.Unstructured{Object: restored}
+	mode, _, _ := unstructured.NestedString(restored, "data", "mode")
+	if mode != "original" || restoredResource.GetResourceVersion() != "7" {
+		t.Errorf("Expected the original snapshot to be restored with the current resource version, but received %v", restored)
+	}
+
+	if err := transaction.Rollback(); err != nil || len(requests) != len(expected) {
+		t.Errorf("Expected a second rollback to do nothing")
+	}
+}
+
+func TestTransactionRollbackSafeguards(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		requests = append(requests, fmt.Sprintf("%s %s", request.Method, request.URL.Path))
+		writer.Header().Set("Content-Type", "application/json")
+		writer.Write([]byte(`{"kind":"Status","apiVersion":"v1","status":"Success"}`))
+	}))
+	defer server.Close()
+
+	client := ClientImpl{
+		config:       &rest.Config{Host: server.URL},
+		apiResources: newDiscoveryCache("", 0),
+		safeguards: newSafeguards(Safeguards{
+			ProtectedNamespaces:      []string{"kube-system"},
+			RequiredDeleteLabel:      "app.kubernetes.io/managed-by",
+			MaxDeletionsPerExecution: 2,
+		}),
+	}
+	execution := client.NewExecution().(ExecutionImpl)
+	transaction := execution.Begin().(TransactionImpl)
+
+	configMaps := &metav1.APIResource{Name: "configmaps", Kind: "ConfigMap", Namespaced: true}
+	resource := func(namespace string, name string, managed bool) unstructured.Unstructured {
+		object := unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"}}
+		object.SetNamespace(namespace)
+		object.SetName(name)
+		if managed {
+			object.SetLabels(map[string]string{"app.kubernetes.io/managed-by": "azd-kubernetes-manager"})
+		}
+		return object
+	}
+
+	transaction.recordCreate(configMaps, resource("preview", "first", true))
+	transaction.recordCreate(configMaps, resource("preview", "second", true))
+	transaction.recordCreate(configMaps, resource("preview", "unmanaged", false))
+	transaction.recordCreate(configMaps, resource("preview", "third", true))
+	transaction.recordUpdate(configMaps, resource("kube-system", "coredns", true))
+
+	err := transaction.Rollback()
+	if err == nil {
+		t.Fatal("Expected the safeguards to reject part of the rollback")
+	}
+	for _, rejected := range []string{"kube-system", "preview/unmanaged doesn't have the label", "circuit breaker tripped"} {
+		if !strings.Contains(err.Error(), rejected) {
+			t.Errorf("Expected the rollback error to contain '%s', but received: %s", rejected, err.Error())
+		}
+	}
+
+	// The rollback deletions count against the circuit breaker, which trips on the third
+	expected := []string{
+		"DELETE /api/v1/namespaces/preview/configmaps/third",
+		"DELETE /api/v1/namespaces/preview/configmaps/second",
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected requests:\n%s\nbut received:\n%s", strings.Join(expected, "\n"), strings.Join(requests, "\n"))
+	}
+	if execution.Aborted() == nil {
+		t.Errorf("Expected the rollback deletions to abort the execution")
+	}
+}
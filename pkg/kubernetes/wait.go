@@ -0,0 +1,219 @@
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// WaitOptions holds the condition to wait for
+type WaitOptions struct {
+	// Wait until the resources have a status condition of this type
+	Condition string
+
+	// The status of the condition. Defaults to True.
+	Status string
+
+	// Wait until the resources no longer exist
+	Deleted bool
+
+	// Wait until this JSONPath expression returns Value on every resource
+	JSONPath string
+
+	// The value that the JSONPath expression must return
+	Value string
+
+	// How long to wait
+	Timeout time.Duration
+
+	// How often to check the resources
+	PollInterval time.Duration
+}
+
+// ParseJSONPath parses a kubectl-style JSONPath expression. The enclosing braces are optional.
+func ParseJSONPath(expression string) (*jsonpath.JSONPath, error) {
+	if !strings.HasPrefix(strings.TrimSpace(expression), "{") {
+		expression = fmt.Sprintf("{%s}", expression)
+	}
+
+	parser := jsonpath.New("WaitRule").AllowMissingKeys(true)
+	if err := parser.Parse(expression); err != nil {
+		return nil, err
+	}
+	return parser, nil
+}
+
+// Wait until Kubernetes resource(s) meet a condition. If a name is given, then only that resource is checked. Otherwise, every resource matching the label selector is checked.
+func (c ClientImpl) Wait(apiVersion string, kind string, namespace string, name string, labelSelector metav1.LabelSelector, options WaitOptions) error {
+	// The changes being waited for were never persisted
+	if c.dryRun != nil {
+		logger.Infof("Dry run: skipping the wait for %s %s", apiVersion, kind)
+		return nil
+	}
+
+	apiResource, err := c.GetAPIResource(apiVersion, kind)
+	if err != nil {
+		return fmt.Errorf("Error getting API Resource %s for API %s: %s", kind, apiVersion, err.Error())
+	}
+
+	client, err := c.RESTClient(apiVersion)
+	if err != nil {
+		return fmt.Errorf("Error getting REST client for API %s: %s", apiVersion, err.Error())
+	}
+
+	var parser *jsonpath.JSONPath
+	if options.JSONPath != "" {
+		if parser, err = ParseJSONPath(options.JSONPath); err != nil {
+			return fmt.Errorf("Error parsing JSONPath %s: %s", options.JSONPath, err.Error())
+		}
+	}
+
+	status := options.Status
+	if status == "" {
+		status = "True"
+	}
+
+	// The objects that haven't converged yet, and why
+	var pending map[string]string
+	err = wait.PollImmediate(options.PollInterval, options.Timeout, func() (bool, error) {
+		resources, err := c.getUnstructured(client, apiResource, namespace, name, labelSelector)
+		if err != nil {
+			pending = map[string]string{fmt.Sprintf("%s %s", apiVersion, kind): err.Error()}
+			return false, nil
+		}
+
+		pending = make(map[string]string)
+		for _, resource := range resources {
+			if reason := checkWaitCondition(resource, options, status, parser); reason != "" {
+				pending[describeResource(resource)] = reason
+			}
+		}
+
+		if len(resources) == 0 && !options.Deleted {
+			pending[fmt.Sprintf("%s %s", apiVersion, kind)] = "no resources were found"
+		}
+
+		return len(pending) == 0, nil
+	})
+
+	if err == wait.ErrWaitTimeout {
+		var descriptions []string
+		for resource, reason := range pending {
+			descriptions = append(descriptions, fmt.Sprintf("- %s: %s", resource, reason))
+		}
+		sort.Strings(descriptions)
+		return fmt.Errorf("Timed out after %s waiting for:\n%s", options.Timeout, strings.Join(descriptions, "\n"))
+	}
+
+	return err
+}
+
+// getUnstructured returns the named resource, or every resource matching the label selector if the name is empty
+func (c ClientImpl) getUnstructured(client rest.Interface, apiResource *metav1.APIResource, namespace string, name string, labelSelector metav1.LabelSelector) ([]unstructured.Unstructured, error) {
+	request := client.Get().
+		NamespaceIfScoped(namespace, namespace != "" && apiResource.Namespaced).
+		Resource(apiResource.Name)
+
+	if name != "" {
+		body, err := request.Name(name).Do().Raw()
+		if apierrors.IsNotFound(err) {
+			return []unstructured.Unstructured{}, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		resource := unstructured.Unstructured{}
+		if err := json.Unmarshal(body, &resource.Object); err != nil {
+			return nil, err
+		}
+		return []unstructured.Unstructured{resource}, nil
+	}
+
+	options := metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(&labelSelector),
+	}
+
+	body, err := request.VersionedParams(&options, scheme.ParameterCodec).Do().Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	list := unstructured.UnstructuredList{}
+	if err := list.UnmarshalJSON(body); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// checkWaitCondition returns why a resource hasn't met the wait condition, or an empty string if it has
+func checkWaitCondition(resource unstructured.Unstructured, options WaitOptions, status string, parser *jsonpath.JSONPath) string {
+	if options.Deleted {
+		if resource.GetDeletionTimestamp() == nil {
+			return "not deleted"
+		}
+
+		// Namespaces also have finalizers in their spec, and report what is blocking the deletion in their conditions
+		finalizers := resource.GetFinalizers()
+		specFinalizers, _, _ := unstructured.NestedStringSlice(resource.Object, "spec", "finalizers")
+		finalizers = append(finalizers, specFinalizers...)
+
+		reason := fmt.Sprintf("being deleted since %s, with finalizers %v", resource.GetDeletionTimestamp().UTC().Format(time.RFC3339), finalizers)
+		conditions, _, _ := unstructured.NestedSlice(resource.Object, "status", "conditions")
+		for _, condition := range conditions {
+			conditionMap, ok := condition.(map[string]interface{})
+			if ok && conditionMap["status"] == "True" {
+				reason += fmt.Sprintf("; %v: %v", conditionMap["type"], conditionMap["message"])
+			}
+		}
+		return reason
+	}
+
+	if options.Condition != "" {
+		conditions, _, _ := unstructured.NestedSlice(resource.Object, "status", "conditions")
+		found := false
+		for _, condition := range conditions {
+			conditionMap, ok := condition.(map[string]interface{})
+			if !ok || conditionMap["type"] != options.Condition {
+				continue
+			}
+			found = true
+			if conditionMap["status"] != status {
+				return fmt.Sprintf("condition %s is %v (%v)", options.Condition, conditionMap["status"], conditionMap["message"])
+			}
+		}
+		if !found {
+			return fmt.Sprintf("condition %s was not found", options.Condition)
+		}
+	}
+
+	if parser != nil {
+		buffer := new(bytes.Buffer)
+		if err := parser.Execute(buffer, resource.Object); err != nil {
+			return fmt.Sprintf("error executing JSONPath %s: %s", options.JSONPath, err.Error())
+		}
+		if buffer.String() != options.Value {
+			return fmt.Sprintf("JSONPath %s is \"%s\", not \"%s\"", options.JSONPath, buffer.String(), options.Value)
+		}
+	}
+
+	return ""
+}
+
+// describeResource returns the kind, namespace and name of a resource
+func describeResource(resource unstructured.Unstructured) string {
+	if resource.GetNamespace() == "" {
+		return fmt.Sprintf("%s %s", resource.GetKind(), resource.GetName())
+	}
+	return fmt.Sprintf("%s %s/%s", resource.GetKind(), resource.GetNamespace(), resource.GetName())
+}
@@ -0,0 +1,98 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestCheckWaitCondition(t *testing.T) {
+	deployment := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata": map[string]interface{}{
+			"name":      "web",
+			"namespace": "pr-7",
+		},
+		"status": map[string]interface{}{
+			"readyReplicas": int64(2),
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Available", "status": "True"},
+				map[string]interface{}{"type": "Progressing", "status": "False", "message": "deadline exceeded"},
+			},
+		},
+	}}
+
+	parser, err := ParseJSONPath(".status.readyReplicas")
+	if err != nil {
+		t.Fatalf("Expected JSONPath to parse: %s", err.Error())
+	}
+
+	tests := []struct {
+		name      string
+		options   WaitOptions
+		parser    bool
+		converged bool
+	}{
+		{"condition_true", WaitOptions{Condition: "Available"}, false, true},
+		{"condition_false", WaitOptions{Condition: "Progressing"}, false, false},
+		{"condition_missing", WaitOptions{Condition: "Ready"}, false, false},
+		{"condition_status", WaitOptions{Condition: "Progressing", Status: "False"}, false, true},
+		{"jsonpath_match", WaitOptions{JSONPath: ".status.readyReplicas", Value: "2"}, true, true},
+		{"jsonpath_mismatch", WaitOptions{JSONPath: ".status.readyReplicas", Value: "3"}, true, false},
+		{"deleted", WaitOptions{Deleted: true}, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := test.options.Status
+			if status == "" {
+				status = "True"
+			}
+
+			var p = parser
+			if !test.parser {
+				p = nil
+			}
+
+			reason := checkWaitCondition(deployment, test.options, status, p)
+			if test.converged && reason != "" {
+				t.Errorf("Expected resource to converge, but received: %s", reason)
+			} else if !test.converged && reason == "" {
+				t.Error("Expected resource to not converge")
+			}
+		})
+	}
+}
+
+func TestCheckWaitConditionDeletedNamespace(t *testing.T) {
+	namespace := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Namespace",
+		"metadata": map[string]interface{}{
+			"name":              "pr-7",
+			"deletionTimestamp": "2019-11-01T00:00:00Z",
+		},
+		"spec": map[string]interface{}{
+			"finalizers": []interface{}{"kubernetes"},
+		},
+		"status": map[string]interface{}{
+			"phase": "Terminating",
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "NamespaceContentRemaining", "status": "True", "message": "Some resources are remaining: pods. has 1 resource instances"},
+				map[string]interface{}{"type": "NamespaceDeletionDiscoveryFailure", "status": "False", "message": "All resources successfully discovered"},
+			},
+		},
+	}}
+
+	reason := checkWaitCondition(namespace, WaitOptions{Deleted: true}, "True", nil)
+	for _, expected := range []string{"[kubernetes]", "NamespaceContentRemaining", "pods"} {
+		if !strings.Contains(reason, expected) {
+			t.Errorf("Expected the reason to contain '%s', but received: %s", expected, reason)
+		}
+	}
+	if strings.Contains(reason, "NamespaceDeletionDiscoveryFailure") {
+		t.Errorf("Expected the reason to skip conditions that aren't true, but received: %s", reason)
+	}
+}
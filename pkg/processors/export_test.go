@@ -0,0 +1,8 @@
+package processors
+
+import "github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
+
+// NewRuleHandlerForCluster creates a RuleHandler whose rules target the given cluster unless they define their own, like the rules of a stage
+func NewRuleHandlerForCluster(client kubernetes.ClientAsync, cluster string) RuleHandler {
+	return RuleHandlerImpl{client: client, cluster: cluster}
+}
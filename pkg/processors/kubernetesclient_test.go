@@ -1,24 +1,277 @@
 package processors_test
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 type MockKubernetesClient struct {
-	listCounts   *map[string]*map[string]uint32
-	deleteCounts *map[string]*map[string]uint32
+	mutex         *sync.Mutex
+	listCounts    *map[string]*map[string]uint32
+	lists         *map[string][]kubernetes.Resource
+	failures      *map[string]error
+	deleteCounts  *map[string]*map[string]uint32
+	deletes       *[]MockDelete
+	sweeps        *[]MockSweep
+	applied       *[]MockApply
+	patches       *[]MockPatch
+	scales        *[]MockScale
+	copies        *[]MockCopy
+	jobs          *[]unstructured.Unstructured
+	jobError      *error
+	waits         *[]MockWait
+	rollbacks     *int
+	executions    *int
+	changes       *[]kubernetes.Change
+	aborted       *error
+	abortOnDelete *error
+	clusters      *map[string]bool
+	preflights    *[]MockPreflight
+	denied        *map[string]error
+	apiResources  *map[string]metav1.APIResource
+	dryRun        bool
+	cluster       string
+	user          string
+}
+
+type MockDelete struct {
+	Cluster       string
+	User          string
+	APIVersion    string
+	Kind          string
+	Namespace     string
+	Name          string
+	LabelSelector metav1.LabelSelector
+	Options       kubernetes.DeleteOptions
+}
+
+type MockApply struct {
+	Cluster  string
+	User     string
+	Resource unstructured.Unstructured
+	DryRun   bool
+}
+
+type MockPreflight struct {
+	Cluster string
+	User    string
+	Check   kubernetes.PreflightCheck
+}
+
+type MockSweep struct {
+	Namespace     string
+	Name          string
+	LabelSelector metav1.LabelSelector
+	SweepOptions  kubernetes.SweepOptions
+	Options       kubernetes.DeleteOptions
+}
+
+type MockWait struct {
+	APIVersion    string
+	Kind          string
+	Namespace     string
+	Name          string
+	LabelSelector metav1.LabelSelector
+	Options       kubernetes.WaitOptions
+}
+
+type MockCopy struct {
+	APIVersion      string
+	Kind            string
+	SourceNamespace string
+	SourceName      string
+	LabelSelector   metav1.LabelSelector
+	Options         kubernetes.CopyOptions
+}
+
+type MockScale struct {
+	APIVersion    string
+	Kind          string
+	Namespace     string
+	Name          string
+	LabelSelector metav1.LabelSelector
+	Options       kubernetes.ScaleOptions
+	DryRun        bool
+}
+
+type MockPatch struct {
+	Cluster       string
+	User          string
+	APIVersion    string
+	Kind          string
+	Namespace     string
+	Name          string
+	LabelSelector metav1.LabelSelector
+	PatchType     types.PatchType
+	Patch         string
 }
 
 func NewMockKubernetesClient() MockKubernetesClient {
 	listCounts := make(map[string]*map[string]uint32)
+	lists := make(map[string][]kubernetes.Resource)
+	failures := make(map[string]error)
 	deleteCounts := make(map[string]*map[string]uint32)
+	var deletes []MockDelete
+	var sweeps []MockSweep
+	var applied []MockApply
+	var patches []MockPatch
+	var scales []MockScale
+	var copies []MockCopy
+	var jobs []unstructured.Unstructured
+	var jobError error
+	var waits []MockWait
+	var rollbacks int
+	var executions int
+	var changes []kubernetes.Change
+	var aborted error
+	var abortOnDelete error
+	clusters := make(map[string]bool)
+	var preflights []MockPreflight
+	denied := make(map[string]error)
+	apiResources := make(map[string]metav1.APIResource)
 	return MockKubernetesClient{
-		listCounts:   &listCounts,
-		deleteCounts: &deleteCounts,
+		mutex:         &sync.Mutex{},
+		listCounts:    &listCounts,
+		lists:         &lists,
+		failures:      &failures,
+		deleteCounts:  &deleteCounts,
+		deletes:       &deletes,
+		sweeps:        &sweeps,
+		applied:       &applied,
+		patches:       &patches,
+		scales:        &scales,
+		copies:        &copies,
+		jobs:          &jobs,
+		jobError:      &jobError,
+		waits:         &waits,
+		rollbacks:     &rollbacks,
+		executions:    &executions,
+		changes:       &changes,
+		aborted:       &aborted,
+		abortOnDelete: &abortOnDelete,
+		clusters:      &clusters,
+		preflights:    &preflights,
+		denied:        &denied,
+		apiResources:  &apiResources,
 	}
 }
 
+// SetList sets the resources returned when listing a kind
+func (c MockKubernetesClient) SetList(apiVersion string, kind string, resources []kubernetes.Resource) {
+	(*c.lists)[apiVersion+"/"+kind] = resources
+}
+
+// FailNamespace makes every delete and patch in a namespace fail
+func (c MockKubernetesClient) FailNamespace(namespace string, err error) {
+	(*c.failures)[namespace] = err
+}
+
+// AbortOnDelete makes the next delete trip the deletion circuit breaker
+func (c MockKubernetesClient) AbortOnDelete(err error) {
+	*c.abortOnDelete = err
+}
+
+// AddCluster defines a named cluster that rules can target
+func (c MockKubernetesClient) AddCluster(name string) {
+	(*c.clusters)[name] = true
+}
+
+// DenyKind makes the preflight of a kind fail
+func (c MockKubernetesClient) DenyKind(kind string, err error) {
+	(*c.denied)[kind] = err
+}
+
+// AddAPIResource makes the API resource of a kind discoverable
+func (c MockKubernetesClient) AddAPIResource(apiResource metav1.APIResource) {
+	(*c.apiResources)[apiResource.Kind] = apiResource
+}
+
+func (c MockKubernetesClient) Preflights() []MockPreflight {
+	return *c.preflights
+}
+
+func (c MockKubernetesClient) Cluster(name string) (kubernetes.Client, error) {
+	if name != "" && !(*c.clusters)[name] {
+		return nil, fmt.Errorf("Cluster %s is not defined", name)
+	}
+	c.cluster = name
+	return c, nil
+}
+
+func (c MockKubernetesClient) Impersonate(user string, groups []string) (kubernetes.Client, error) {
+	c.user = user
+	return c, nil
+}
+
+func (c MockKubernetesClient) NewExecution() kubernetes.Execution {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	*c.executions++
+	return c
+}
+
+func (c MockKubernetesClient) Executions() int {
+	return *c.executions
+}
+
+func (c MockKubernetesClient) Aborted() error {
+	return *c.aborted
+}
+
+func (c MockKubernetesClient) Rollbacks() int {
+	return *c.rollbacks
+}
+
+func (c MockKubernetesClient) Waits() []MockWait {
+	return *c.waits
+}
+
+func (c MockKubernetesClient) Jobs() []unstructured.Unstructured {
+	return *c.jobs
+}
+
+func (c MockKubernetesClient) FailJobs(err error) {
+	*c.jobError = err
+}
+
+func (c MockKubernetesClient) Copies() []MockCopy {
+	return *c.copies
+}
+
+func (c MockKubernetesClient) Scales() []MockScale {
+	return *c.scales
+}
+
+func (c MockKubernetesClient) Patches() []MockPatch {
+	return *c.patches
+}
+
+func (c MockKubernetesClient) Applied() []unstructured.Unstructured {
+	var resources []unstructured.Unstructured
+	for _, apply := range c.Applies() {
+		resources = append(resources, apply.Resource)
+	}
+	return resources
+}
+
+func (c MockKubernetesClient) Applies() []MockApply {
+	return *c.applied
+}
+
+func (c MockKubernetesClient) Deletes() []MockDelete {
+	return *c.deletes
+}
+
+func (c MockKubernetesClient) Sweeps() []MockSweep {
+	return *c.sweeps
+}
+
 func (c MockKubernetesClient) DeleteCount(apiVersion string, kind string) *uint32 {
 	if kinds, apiVersionExists := (*c.deleteCounts)[apiVersion]; apiVersionExists {
 		if count, kindExists := (*kinds)[kind]; kindExists {
@@ -41,10 +294,27 @@ func (c MockKubernetesClient) List(apiVersion string, kind string, namespace str
 		(*c.listCounts)[apiVersion] = &newKinds
 		return c.List(apiVersion, kind, namespace, labelSelector)
 	}
+	if resources, exists := (*c.lists)[apiVersion+"/"+kind]; exists {
+		return resources, nil
+	}
 	return []kubernetes.Resource{}, nil
 }
 
-func (c MockKubernetesClient) Delete(apiVersion string, kind string, namespace string, labelSelector metav1.LabelSelector) error {
+func (c MockKubernetesClient) Delete(apiVersion string, kind string, namespace string, name string, labelSelector metav1.LabelSelector, options kubernetes.DeleteOptions) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	*c.deletes = append(*c.deletes, MockDelete{
+		Cluster:       c.cluster,
+		User:          c.user,
+		APIVersion:    apiVersion,
+		Kind:          kind,
+		Namespace:     namespace,
+		Name:          name,
+		LabelSelector: labelSelector,
+		Options:       options,
+	})
+
 	if kinds, apiVersionExists := (*c.deleteCounts)[apiVersion]; apiVersionExists {
 		if count, kindExists := (*kinds)[kind]; kindExists {
 			(*kinds)[kind] = count + 1
@@ -53,8 +323,177 @@ func (c MockKubernetesClient) Delete(apiVersion string, kind string, namespace s
 		}
 	} else {
 		newKinds := make(map[string]uint32)
+		newKinds[kind] = 1
 		(*c.deleteCounts)[apiVersion] = &newKinds
-		return c.Delete(apiVersion, kind, namespace, labelSelector)
 	}
+	if *c.abortOnDelete != nil {
+		*c.aborted = *c.abortOnDelete
+		return *c.aborted
+	}
+	return c.deleteFailure(namespace, options)
+}
+
+// deleteFailure returns the failure of the namespace, or of the first failing namespace of the delete options
+func (c MockKubernetesClient) deleteFailure(namespace string, options kubernetes.DeleteOptions) error {
+	for _, namespace := range options.Namespaces {
+		if err := (*c.failures)[namespace]; err != nil {
+			return err
+		}
+	}
+	return (*c.failures)[namespace]
+}
+
+func (c MockKubernetesClient) Sweep(namespace string, name string, labelSelector metav1.LabelSelector, sweepOptions kubernetes.SweepOptions, options kubernetes.DeleteOptions) ([]kubernetes.SweepResult, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	*c.sweeps = append(*c.sweeps, MockSweep{
+		Namespace:     namespace,
+		Name:          name,
+		LabelSelector: labelSelector,
+		SweepOptions:  sweepOptions,
+		Options:       options,
+	})
+	return []kubernetes.SweepResult{}, c.deleteFailure(namespace, options)
+}
+
+func (c MockKubernetesClient) Apply(resource unstructured.Unstructured) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	*c.applied = append(*c.applied, MockApply{
+		Cluster:  c.cluster,
+		User:     c.user,
+		Resource: resource,
+		DryRun:   c.dryRun,
+	})
+	return (*c.failures)[resource.GetNamespace()]
+}
+
+func (c MockKubernetesClient) Patch(apiVersion string, kind string, namespace string, name string, labelSelector metav1.LabelSelector, patchType types.PatchType, patch []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	*c.patches = append(*c.patches, MockPatch{
+		Cluster:       c.cluster,
+		User:          c.user,
+		APIVersion:    apiVersion,
+		Kind:          kind,
+		Namespace:     namespace,
+		Name:          name,
+		LabelSelector: labelSelector,
+		PatchType:     patchType,
+		Patch:         string(patch),
+	})
+	return (*c.failures)[namespace]
+}
+
+func (c MockKubernetesClient) Scale(apiVersion string, kind string, namespace string, name string, labelSelector metav1.LabelSelector, options kubernetes.ScaleOptions) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	*c.scales = append(*c.scales, MockScale{
+		APIVersion:    apiVersion,
+		Kind:          kind,
+		Namespace:     namespace,
+		Name:          name,
+		LabelSelector: labelSelector,
+		Options:       options,
+		DryRun:        c.dryRun,
+	})
+	if c.dryRun {
+		*c.changes = append(*c.changes, kubernetes.Change{Action: kubernetes.ChangeActionScale, APIVersion: apiVersion, Kind: kind, Namespace: namespace, Name: name})
+	}
+	return (*c.failures)[namespace]
+}
+
+func (c MockKubernetesClient) Copy(apiVersion string, kind string, sourceNamespace string, sourceName string, labelSelector metav1.LabelSelector, options kubernetes.CopyOptions) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	*c.copies = append(*c.copies, MockCopy{
+		APIVersion:      apiVersion,
+		Kind:            kind,
+		SourceNamespace: sourceNamespace,
+		SourceName:      sourceName,
+		LabelSelector:   labelSelector,
+		Options:         options,
+	})
+	return nil
+}
+
+func (c MockKubernetesClient) RunJob(resource unstructured.Unstructured, options kubernetes.JobOptions) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	*c.jobs = append(*c.jobs, resource)
+	return *c.jobError
+}
+
+func (c MockKubernetesClient) Wait(apiVersion string, kind string, namespace string, name string, labelSelector metav1.LabelSelector, options kubernetes.WaitOptions) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	*c.waits = append(*c.waits, MockWait{
+		APIVersion:    apiVersion,
+		Kind:          kind,
+		Namespace:     namespace,
+		Name:          name,
+		LabelSelector: labelSelector,
+		Options:       options,
+	})
+	return nil
+}
+
+func (c MockKubernetesClient) ForEachNamespace(namespaces []string, action func(namespace string) error) []error {
+	results := make([]error, len(namespaces))
+	for i, namespace := range namespaces {
+		results[i] = action(namespace)
+	}
+	return results
+}
+
+func (c MockKubernetesClient) Preflight(check kubernetes.PreflightCheck) ([]string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	*c.preflights = append(*c.preflights, MockPreflight{
+		Cluster: c.cluster,
+		User:    c.user,
+		Check:   check,
+	})
+	if check.NamespaceTemplated || check.DefinedByRules {
+		if err := (*c.denied)[check.Kind]; err != nil {
+			return []string{err.Error()}, nil
+		}
+	}
+	return nil, (*c.denied)[check.Kind]
+}
+
+func (c MockKubernetesClient) GetAPIResource(apiVersion string, kind string) (*metav1.APIResource, error) {
+	apiResource, exists := (*c.apiResources)[kind]
+	if !exists {
+		return nil, fmt.Errorf("Kind '%s' was not found in API Version '%s'", kind, apiVersion)
+	}
+	return &apiResource, nil
+}
+
+func (c MockKubernetesClient) Begin() kubernetes.Transaction {
+	return c
+}
+
+func (c MockKubernetesClient) Rollback() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	*c.rollbacks++
 	return nil
 }
+
+func (c MockKubernetesClient) DryRun() kubernetes.DryRunClient {
+	c.dryRun = true
+	return c
+}
+
+func (c MockKubernetesClient) Changes() []kubernetes.Change {
+	return *c.changes
+}
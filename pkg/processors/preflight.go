@@ -0,0 +1,113 @@
+package processors
+
+import (
+	newerrors "errors"
+	"fmt"
+	"strings"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/config"
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// preflightRule is a rule, and the verbs it needs on each kind
+type preflightRule struct {
+	description string
+	options     config.RuleOptions
+	checks      []kubernetes.PreflightCheck
+	err         error
+}
+
+// Preflight resolves the kinds of every rule through discovery, and checks that the rules are allowed the verbs they need.
+// The checks use the cluster and impersonation of each rule. Kinds defined by the CustomResourceDefinitions of the apply rules
+// might only be served once the rules run, so if they aren't found, a warning is returned. This function returns a slice of warnings and an error.
+func (rh RuleHandlerImpl) Preflight(rules config.Rules) ([]string, error) {
+	rh.dryRunClient = rh.client.Sync().DryRun()
+	definedKinds := rules.GetDefinedKinds()
+
+	warnings, errors := rh.preflightStage(rules, definedKinds)
+	for _, stage := range rules.Stages {
+		stageHandler := rh
+		if stage.Cluster != "" {
+			stageHandler.cluster = stage.Cluster
+		}
+
+		stageWarnings, stageErrors := stageHandler.preflightStage(stage.Rules, definedKinds)
+		for _, warning := range stageWarnings {
+			warnings = append(warnings, fmt.Sprintf("Stage '%s': %s", stage.Name, warning))
+		}
+		for _, err := range stageErrors {
+			errors = append(errors, fmt.Sprintf("Stage '%s': %s", stage.Name, err))
+		}
+	}
+
+	var err error
+	if len(errors) > 0 {
+		err = newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return warnings, err
+}
+
+// preflightStage checks the rules of a stage. This function returns a slice of warnings and a slice of errors.
+func (rh RuleHandlerImpl) preflightStage(rules config.Rules, definedKinds map[schema.GroupKind]bool) ([]string, []string) {
+	var preflightRules []preflightRule
+	for pos, rule := range rules.Apply {
+		checks, err := rule.ToPreflightChecks()
+		preflightRules = append(preflightRules, preflightRule{fmt.Sprintf("Apply resource rule %d", pos), rule.RuleOptions, checks, err})
+	}
+	for pos, rule := range rules.Delete {
+		preflightRules = append(preflightRules, preflightRule{fmt.Sprintf("Delete resource rule %d", pos), rule.RuleOptions, rule.ToPreflightChecks(), nil})
+	}
+	for pos, rule := range rules.Patch {
+		preflightRules = append(preflightRules, preflightRule{fmt.Sprintf("Patch resource rule %d", pos), rule.RuleOptions, rule.ToPreflightChecks(), nil})
+	}
+	for pos, rule := range rules.Scale {
+		preflightRules = append(preflightRules, preflightRule{fmt.Sprintf("Scale resource rule %d", pos), rule.RuleOptions, rule.ToPreflightChecks(), nil})
+	}
+	for pos, rule := range rules.Restart {
+		preflightRules = append(preflightRules, preflightRule{fmt.Sprintf("Restart resource rule %d", pos), rule.RuleOptions, rule.ToPreflightChecks(), nil})
+	}
+	for pos, rule := range rules.Label {
+		preflightRules = append(preflightRules, preflightRule{fmt.Sprintf("Label resource rule %d", pos), rule.RuleOptions, rule.ToPreflightChecks(), nil})
+	}
+	for pos, rule := range rules.Copy {
+		preflightRules = append(preflightRules, preflightRule{fmt.Sprintf("Copy resource rule %d", pos), rule.RuleOptions, rule.ToPreflightChecks(), nil})
+	}
+	for pos, rule := range rules.Job {
+		checks, err := rule.ToPreflightChecks()
+		preflightRules = append(preflightRules, preflightRule{fmt.Sprintf("Job rule %d", pos), rule.RuleOptions, checks, err})
+	}
+	for pos, rule := range rules.Wait {
+		preflightRules = append(preflightRules, preflightRule{fmt.Sprintf("Wait rule %d", pos), rule.RuleOptions, rule.ToPreflightChecks(), nil})
+	}
+
+	var warnings []string
+	var errors []string
+	for _, rule := range preflightRules {
+		if rule.err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %s", rule.description, rule.err.Error()))
+			continue
+		}
+
+		client, err := rh.clientFor(rule.options)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %s", rule.description, err.Error()))
+			continue
+		}
+
+		for _, check := range rule.checks {
+			check.DefinedByRules = definedKinds[schema.FromAPIVersionAndKind(check.APIVersion, check.Kind).GroupKind()]
+			checkWarnings, err := client.Preflight(check)
+			for _, warning := range checkWarnings {
+				warnings = append(warnings, fmt.Sprintf("%s: %s", rule.description, warning))
+			}
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("%s: %s", rule.description, strings.ReplaceAll(err.Error(), "\n", fmt.Sprintf("\n%s: ", rule.description))))
+			}
+		}
+	}
+
+	return warnings, errors
+}
@@ -4,6 +4,11 @@ import (
 	newerrors "errors"
 	"fmt"
 	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
 
 	"github.com/ogmaresca/azd-kubernetes-manager/pkg/config"
 	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
@@ -13,18 +18,51 @@ import (
 // RuleHandler handles Kubernetes rules
 type RuleHandler interface {
 	Handle(rules config.Rules, args templating.Args) error
+	HandleTransaction(rules config.Rules, args templating.Args) error
+	HandleDryRun(rules config.Rules, args templating.Args) ([]kubernetes.Change, error)
+	Impersonating(impersonation *config.Impersonation) RuleHandler
+	NewExecution() RuleHandler
+	DryRunChanges() []kubernetes.Change
+	Preflight(rules config.Rules) ([]string, error)
 }
 
 // RuleHandlerImpl is the default implementation of RuleHandler
 type RuleHandlerImpl struct {
 	client kubernetes.ClientAsync
+
+	// The client for rules in dry run mode. This is created for every execution, and records the changes of every copy of the execution.
+	dryRunClient kubernetes.DryRunClient
+
+	// The execution that counts deletions against the safeguards. If nil, one is created for every execution.
+	execution kubernetes.Execution
+
+	// The cluster of the rules that don't define their own cluster. The default cluster is "".
+	cluster string
+
+	// The identity of the rules that don't define their own impersonation. If nil, the rules use the identity of the client.
+	impersonate *config.Impersonation
 }
 
 // NewRuleHandler creates a RuleHandler
 func NewRuleHandler(client kubernetes.ClientAsync) RuleHandler {
-	return RuleHandlerImpl{client}
+	return RuleHandlerImpl{client: client}
+}
+
+// runningRule is a rule that was started, and the policy to follow if it fails
+type runningRule struct {
+	channel   chan error
+	onFailure config.FailurePolicy
 }
 
+// stageState is the state of a stage when executing stages
+type stageState int
+
+const (
+	stagePending stageState = iota
+	stageSucceeded
+	stageAborted
+)
+
 // Handle executes configuration rules
 func (rh RuleHandlerImpl) Handle(rules config.Rules, args templating.Args) error {
 	if rules.IsEmpty() {
@@ -32,33 +70,264 @@ func (rh RuleHandlerImpl) Handle(rules config.Rules, args templating.Args) error
 		return nil
 	}
 
-	var channels []chan error
+	dependencies, err := rules.GetStageDependencies()
+	if err != nil {
+		return err
+	}
+
+	if rh.execution == nil {
+		rh.execution = rh.client.Sync().NewExecution()
+		rh.client = kubernetes.MakeFromClient(rh.execution)
+	}
+
+	if rh.dryRunClient == nil {
+		rh.dryRunClient = rh.client.Sync().DryRun()
+		defer func() {
+			if changes := rh.dryRunClient.Changes(); len(changes) > 0 {
+				logger.Infof("[%s] Rules in dry run mode would have made these changes:\n%s", args.ServiceHook.Describe(), describeChanges(changes))
+			}
+		}()
+	}
+
+	errors, onFailure := rh.handleStage(rules, args, config.FailurePolicyAbortStage)
+	if len(rules.Stages) > 0 {
+		if onFailure == config.FailurePolicyAbortStage || onFailure == config.FailurePolicyAbortAll {
+			errors = append(errors, "- Skipped all stages because a rule failed")
+		} else {
+			errors = append(errors, rh.handleStages(rules.Stages, dependencies, args)...)
+		}
+	}
+
+	if len(errors) > 0 {
+		err = newerrors.New(strings.Join(errors, "\n"))
+	}
+
+	return err
+}
+
+// HandleTransaction executes configuration rules. If any rule fails, the changes made by the rules are rolled back.
+func (rh RuleHandlerImpl) HandleTransaction(rules config.Rules, args templating.Args) error {
+	transaction := rh.client.Sync().Begin()
+
+	err := RuleHandlerImpl{client: kubernetes.MakeFromClient(transaction), dryRunClient: rh.dryRunClient, execution: rh.execution, impersonate: rh.impersonate}.Handle(rules, args)
+	if err == nil {
+		return nil
+	}
+
+	logger.Warningf("[%s] Rolling back the changes made by the rules, because a rule failed", args.ServiceHook.Describe())
+	if rollbackErr := transaction.Rollback(); rollbackErr != nil {
+		return fmt.Errorf("%s\n%s", err.Error(), rollbackErr.Error())
+	}
+
+	return fmt.Errorf("%s\nThe changes made by the rules were rolled back.", err.Error())
+}
+
+// HandleDryRun executes configuration rules in dry run mode, and returns the changes that would have been made
+func (rh RuleHandlerImpl) HandleDryRun(rules config.Rules, args templating.Args) ([]kubernetes.Change, error) {
+	dryRunClient := rh.client.Sync().DryRun()
+
+	err := RuleHandlerImpl{client: kubernetes.MakeFromClient(dryRunClient), dryRunClient: dryRunClient, execution: rh.execution, cluster: rh.cluster, impersonate: rh.impersonate}.Handle(rules, args)
+
+	changes := dryRunClient.Changes()
+	if len(changes) > 0 {
+		logger.Infof("[%s] Dry run: the rules would have made these changes:\n%s", args.ServiceHook.Describe(), describeChanges(changes))
+	}
+
+	return changes, err
+}
+
+// NewExecution returns a copy of the RuleHandler whose rules count their deletions against a single execution, such as for every configuration that a Service Hook matches.
+// Once the deletion circuit breaker aborts the execution, the rules of every copy stop making changes.
+// The changes of the rules in dry run mode are recorded for the whole execution, and returned by DryRunChanges.
+func (rh RuleHandlerImpl) NewExecution() RuleHandler {
+	rh.execution = rh.client.Sync().NewExecution()
+	rh.client = kubernetes.MakeFromClient(rh.execution)
+	rh.dryRunClient = rh.client.Sync().DryRun()
+	return rh
+}
+
+// DryRunChanges returns the changes that the rules in dry run mode of the execution would have made
+func (rh RuleHandlerImpl) DryRunChanges() []kubernetes.Change {
+	if rh.dryRunClient == nil {
+		return nil
+	}
+	return rh.dryRunClient.Changes()
+}
+
+// Impersonating returns a copy of the RuleHandler whose rules send requests as the given identity, unless a rule defines its own
+func (rh RuleHandlerImpl) Impersonating(impersonation *config.Impersonation) RuleHandler {
+	rh.impersonate = impersonation
+	return rh
+}
+
+// handleStages executes stages once the stages they depend on have finished. This function returns a slice of errors.
+func (rh RuleHandlerImpl) handleStages(stages []config.RuleStage, dependencies [][]int, args templating.Args) []string {
+	var errors []string
+	states := make([]stageState, len(stages))
+	abortAll := false
+
+	for {
+		var ready []int
+		skipped := false
+		for i := range stages {
+			if states[i] != stagePending {
+				continue
+			}
+
+			isReady := true
+			var abortedDependency *config.RuleStage
+			for _, dependency := range dependencies[i] {
+				if states[dependency] == stagePending {
+					isReady = false
+				} else if states[dependency] == stageAborted {
+					abortedDependency = &stages[dependency]
+				}
+			}
+
+			if !isReady {
+				continue
+			} else if abortAll {
+				states[i] = stageAborted
+				skipped = true
+				errors = append(errors, fmt.Sprintf("- Skipped stage '%s' because a rule failed with policy %s", stages[i].Name, config.FailurePolicyAbortAll))
+			} else if abortedDependency != nil {
+				states[i] = stageAborted
+				skipped = true
+				errors = append(errors, fmt.Sprintf("- Skipped stage '%s' because stage '%s' did not succeed", stages[i].Name, abortedDependency.Name))
+			} else {
+				ready = append(ready, i)
+			}
+		}
+
+		if len(ready) == 0 {
+			if skipped {
+				// The dependents of the skipped stages are skipped too
+				continue
+			}
+			return errors
+		}
+
+		type stageResult struct {
+			index     int
+			errors    []string
+			onFailure config.FailurePolicy
+		}
+
+		results := make(chan stageResult)
+		for _, i := range ready {
+			go func(i int) {
+				run, err := stages[i].Matches(args)
+				if err != nil {
+					results <- stageResult{i, []string{fmt.Sprintf("- Error evaluating the stage condition: %s", err.Error())}, stages[i].GetOnFailure()}
+					return
+				} else if !run {
+					logger.Debugf("[%s] Skipping stage '%s' because its condition is false", args.ServiceHook.Describe(), stages[i].Name)
+					results <- stageResult{i, nil, ""}
+					return
+				}
+
+				logger.Debugf("[%s] Starting stage '%s'", args.ServiceHook.Describe(), stages[i].Name)
+				stageHandler := rh
+				if stages[i].DryRun {
+					stageHandler.client = kubernetes.MakeFromClient(rh.dryRunClient)
+				}
+				if stages[i].Cluster != "" {
+					stageHandler.cluster = stages[i].Cluster
+				}
+				stageErrors, onFailure := stageHandler.handleStage(stages[i].Rules, args, stages[i].GetOnFailure())
+				results <- stageResult{i, stageErrors, onFailure}
+			}(i)
+		}
+
+		for range ready {
+			result := <-results
+			states[result.index] = stageSucceeded
+			if len(result.errors) > 0 {
+				errors = append(errors, fmt.Sprintf("- Stage '%s':\n  %s", stages[result.index].Name, strings.ReplaceAll(strings.Join(result.errors, "\n"), "\n", "\n  ")))
+			}
+			if result.onFailure == config.FailurePolicyAbortStage || result.onFailure == config.FailurePolicyAbortAll {
+				states[result.index] = stageAborted
+			}
+			if result.onFailure == config.FailurePolicyAbortAll {
+				abortAll = true
+			}
+		}
+	}
+}
+
+// handleStage executes every rule in parallel. This function returns a slice of errors, and the most severe failure policy of the rules that failed.
+func (rh RuleHandlerImpl) handleStage(rules config.Rules, args templating.Args, onFailure config.FailurePolicy) ([]string, config.FailurePolicy) {
+	var rulesRunning []runningRule
 	for _, rule := range rules.Apply {
 		channel := make(chan error)
 		go rh.handleApply(rule, args, channel)
-		channels = append(channels, channel)
+		rulesRunning = append(rulesRunning, runningRule{channel, rule.GetOnFailure(onFailure)})
 	}
 
 	for _, rule := range rules.Delete {
 		channel := make(chan error)
 		go rh.handleDelete(rule, args, channel)
-		channels = append(channels, channel)
+		rulesRunning = append(rulesRunning, runningRule{channel, rule.GetOnFailure(onFailure)})
+	}
+
+	for _, rule := range rules.Patch {
+		channel := make(chan error)
+		go rh.handlePatch(rule, args, channel)
+		rulesRunning = append(rulesRunning, runningRule{channel, rule.GetOnFailure(onFailure)})
+	}
+
+	for _, rule := range rules.Scale {
+		channel := make(chan error)
+		go rh.handleScale(rule, args, channel)
+		rulesRunning = append(rulesRunning, runningRule{channel, rule.GetOnFailure(onFailure)})
+	}
+
+	for _, rule := range rules.Restart {
+		channel := make(chan error)
+		go rh.handleRestart(rule, args, channel)
+		rulesRunning = append(rulesRunning, runningRule{channel, rule.GetOnFailure(onFailure)})
+	}
+
+	for _, rule := range rules.Label {
+		channel := make(chan error)
+		go rh.handleLabel(rule, args, channel)
+		rulesRunning = append(rulesRunning, runningRule{channel, rule.GetOnFailure(onFailure)})
+	}
+
+	for _, rule := range rules.Copy {
+		channel := make(chan error)
+		go rh.handleCopy(rule, args, channel)
+		rulesRunning = append(rulesRunning, runningRule{channel, rule.GetOnFailure(onFailure)})
+	}
+
+	for _, rule := range rules.Job {
+		channel := make(chan error)
+		go rh.handleJob(rule, args, channel)
+		rulesRunning = append(rulesRunning, runningRule{channel, rule.GetOnFailure(onFailure)})
+	}
+
+	for _, rule := range rules.Wait {
+		channel := make(chan error)
+		go rh.handleWait(rule, args, channel)
+		rulesRunning = append(rulesRunning, runningRule{channel, rule.GetOnFailure(onFailure)})
 	}
 
 	var errors []string
-	for _, channel := range channels {
-		err := <-channel
+	var failurePolicy config.FailurePolicy
+	for _, rule := range rulesRunning {
+		err := <-rule.channel
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("- %s", strings.ReplaceAll(err.Error(), "\n", "\n  ")))
+			failurePolicy = failurePolicy.Max(rule.onFailure)
 		}
 	}
 
-	var err error
-	if len(errors) > 0 {
-		err = newerrors.New(strings.Join(errors, "\n"))
+	// The deletion circuit breaker aborts the whole execution, regardless of the failure policies
+	if rh.execution != nil && rh.execution.Aborted() != nil {
+		failurePolicy = config.FailurePolicyAbortAll
 	}
 
-	return err
+	return errors, failurePolicy
 }
 
 // handleApply executes Apply Resource rules
@@ -69,7 +338,55 @@ func (rh RuleHandlerImpl) handleApply(rule config.ApplyResourceRule, args templa
 		}
 	}()
 
-	logger.Alert("Apply resource rule is not implemented")
+	logger.Debugf("Processing apply resource rule:\n%s", rule.Describe())
+
+	if !checkWhen(rule.RuleOptions, "apply resource", rule.Describe(), args, channel) {
+		return
+	}
+
+	resources, err := rule.ParseTemplated(args)
+	if err != nil {
+		channel <- fmt.Errorf("Error templating apply resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	if err = config.ValidateKubernetesResources(resources); err != nil {
+		channel <- fmt.Errorf("Error validating apply resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	client, err := rh.clientFor(rule.RuleOptions)
+	if err != nil {
+		channel <- fmt.Errorf("Error applying apply resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	var objects []unstructured.Unstructured
+	for _, resource := range resources {
+		objects = append(objects, resource.ToUnstructured())
+	}
+	kubernetes.SortByApplyOrder(objects, func(object unstructured.Unstructured) bool {
+		apiResource, err := client.GetAPIResource(object.GetAPIVersion(), object.GetKind())
+		if err != nil {
+			// The kind might be defined by a CustomResourceDefinition that this rule applies
+			return object.GetNamespace() != ""
+		}
+		return apiResource.Namespaced
+	})
+
+	// Apply each document in order, since later documents may depend on earlier ones
+
+	var errors []string
+	for _, object := range objects {
+		if err := client.Apply(object); err != nil {
+			errors = append(errors, fmt.Sprintf("- %s %s/%s: %s", object.GetAPIVersion(), object.GetKind(), object.GetName(), strings.ReplaceAll(err.Error(), "\n", "\n  ")))
+		}
+	}
+
+	if len(errors) > 0 {
+		channel <- fmt.Errorf("Error applying apply resource rule:\n%s\nErrors:\n%s", rule.Describe(), strings.Join(errors, "\n"))
+		return
+	}
 
 	channel <- nil
 }
@@ -84,13 +401,52 @@ func (rh RuleHandlerImpl) handleDelete(rule config.DeleteResourceRule, args temp
 
 	logger.Debugf("Processing delete resource rule:\n%s", rule.Describe())
 
-	templatedSelector, err := rule.Selector.ToTemplatedKubernetesLabelSelector(args)
+	if !checkWhen(rule.RuleOptions, "delete resource", rule.Describe(), args, channel) {
+		return
+	}
+
+	templatedNamespace, templatedName, templatedSelector, err := templateTarget(rule.Namespace, rule.Name, rule.Selector, args)
+	if err != nil {
+		channel <- fmt.Errorf("Error templating delete resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	options, err := rule.ToTemplatedDeleteOptions(args)
 	if err != nil {
 		channel <- fmt.Errorf("Error templating delete resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
 		return
 	}
 
-	err = rh.client.Sync().Delete(rule.APIVersion, rule.Kind, rule.Namespace, templatedSelector)
+	// A name or field selector whose template renders to an empty value must not delete every resource
+	if kubernetes.SelectsEverything(templatedName, options.FieldSelector, templatedSelector) {
+		channel <- fmt.Errorf("Error templating delete resource rule:\n%s\nError: The name, the field selector and the label selector are all empty after templating", rule.Describe())
+		return
+	}
+
+	client, err := rh.clientFor(rule.RuleOptions)
+	if err != nil {
+		channel <- fmt.Errorf("Error applying delete resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	// The selected namespaces are deleted from together, so that the limit and the retention policy apply to all of their resources
+	if rule.NamespaceSelector != nil {
+		if options.Namespaces, err = selectNamespaces(client, rule.NamespaceSelector, args); err != nil {
+			channel <- fmt.Errorf("Error applying delete resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+			return
+		} else if len(options.Namespaces) == 0 {
+			channel <- nil
+			return
+		}
+	}
+
+	if rule.Sweep == nil {
+		err = client.Delete(rule.APIVersion, rule.Kind, templatedNamespace, templatedName, templatedSelector, options)
+	} else {
+		var results []kubernetes.SweepResult
+		results, err = client.Sweep(templatedNamespace, templatedName, templatedSelector, rule.ToSweepOptions(), options)
+		logger.Infof("Swept resources matching %s%s:\n%s", metav1.FormatLabelSelector(&templatedSelector), describeNamespaces(templatedNamespace, options.Namespaces), describeSweepResults(results))
+	}
 	if err != nil {
 		channel <- fmt.Errorf("Error applying delete resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
 		return
@@ -98,3 +454,413 @@ func (rh RuleHandlerImpl) handleDelete(rule config.DeleteResourceRule, args temp
 
 	channel <- nil
 }
+
+// handlePatch executes Patch Resource rules
+func (rh RuleHandlerImpl) handlePatch(rule config.PatchResourceRule, args templating.Args, channel chan<- error) {
+	defer func() {
+		if err := recover(); err != nil { //catch
+			channel <- fmt.Errorf("Recovered from panic when executing patch resource rule: %v", err)
+		}
+	}()
+
+	logger.Debugf("Processing patch resource rule:\n%s", rule.Describe())
+
+	if !checkWhen(rule.RuleOptions, "patch resource", rule.Describe(), args, channel) {
+		return
+	}
+
+	templatedNamespace, templatedName, templatedSelector, err := templateTarget(rule.Namespace, rule.Name, rule.Selector, args)
+	if err != nil {
+		channel <- fmt.Errorf("Error templating patch resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	patch, err := rule.ToTemplatedPatch(args)
+	if err != nil {
+		channel <- fmt.Errorf("Error templating patch resource rule patch:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	client, err := rh.clientFor(rule.RuleOptions)
+	if err != nil {
+		channel <- fmt.Errorf("Error applying patch resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	err = forEachNamespace(client, templatedNamespace, rule.NamespaceSelector, args, func(namespace string) error {
+		return client.Patch(rule.APIVersion, rule.Kind, namespace, templatedName, templatedSelector, rule.ToKubernetesPatchType(), patch)
+	})
+	if err != nil {
+		channel <- fmt.Errorf("Error applying patch resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	channel <- nil
+}
+
+// handleScale executes Scale Resource rules
+func (rh RuleHandlerImpl) handleScale(rule config.ScaleResourceRule, args templating.Args, channel chan<- error) {
+	defer func() {
+		if err := recover(); err != nil { //catch
+			channel <- fmt.Errorf("Recovered from panic when executing scale resource rule: %v", err)
+		}
+	}()
+
+	logger.Debugf("Processing scale resource rule:\n%s", rule.Describe())
+
+	if !checkWhen(rule.RuleOptions, "scale resource", rule.Describe(), args, channel) {
+		return
+	}
+
+	templatedNamespace, templatedName, templatedSelector, err := templateTarget(rule.Namespace, rule.Name, rule.Selector, args)
+	if err != nil {
+		channel <- fmt.Errorf("Error templating scale resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	client, err := rh.clientFor(rule.RuleOptions)
+	if err == nil {
+		err = client.Scale(rule.APIVersion, rule.Kind, templatedNamespace, templatedName, templatedSelector, rule.ToScaleOptions())
+	}
+	if err != nil {
+		channel <- fmt.Errorf("Error applying scale resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	channel <- nil
+}
+
+// handleRestart executes Restart Resource rules
+func (rh RuleHandlerImpl) handleRestart(rule config.RestartResourceRule, args templating.Args, channel chan<- error) {
+	defer func() {
+		if err := recover(); err != nil { //catch
+			channel <- fmt.Errorf("Recovered from panic when executing restart resource rule: %v", err)
+		}
+	}()
+
+	logger.Debugf("Processing restart resource rule:\n%s", rule.Describe())
+
+	if !checkWhen(rule.RuleOptions, "restart resource", rule.Describe(), args, channel) {
+		return
+	}
+
+	templatedNamespace, templatedName, templatedSelector, err := templateTarget(rule.Namespace, rule.Name, rule.Selector, args)
+	if err != nil {
+		channel <- fmt.Errorf("Error templating restart resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	patch, err := rule.ToPatch(args, time.Now())
+	if err != nil {
+		channel <- fmt.Errorf("Error creating restart resource rule patch:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	client, err := rh.clientFor(rule.RuleOptions)
+	if err == nil {
+		err = client.Patch(rule.GetAPIVersion(), rule.Kind, templatedNamespace, templatedName, templatedSelector, types.MergePatchType, patch)
+	}
+	if err != nil {
+		channel <- fmt.Errorf("Error applying restart resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	channel <- nil
+}
+
+// handleLabel executes Label Resource rules
+func (rh RuleHandlerImpl) handleLabel(rule config.LabelResourceRule, args templating.Args, channel chan<- error) {
+	defer func() {
+		if err := recover(); err != nil { //catch
+			channel <- fmt.Errorf("Recovered from panic when executing label resource rule: %v", err)
+		}
+	}()
+
+	logger.Debugf("Processing label resource rule:\n%s", rule.Describe())
+
+	if !checkWhen(rule.RuleOptions, "label resource", rule.Describe(), args, channel) {
+		return
+	}
+
+	templatedNamespace, templatedName, templatedSelector, err := templateTarget(rule.Namespace, rule.Name, rule.Selector, args)
+	if err != nil {
+		channel <- fmt.Errorf("Error templating label resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	patch, err := rule.ToTemplatedPatch(args)
+	if err != nil {
+		channel <- fmt.Errorf("Error templating label resource rule patch:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	client, err := rh.clientFor(rule.RuleOptions)
+	if err == nil {
+		err = client.Patch(rule.APIVersion, rule.Kind, templatedNamespace, templatedName, templatedSelector, types.MergePatchType, patch)
+	}
+	if err != nil {
+		channel <- fmt.Errorf("Error applying label resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	channel <- nil
+}
+
+// handleCopy executes Copy Resource rules
+func (rh RuleHandlerImpl) handleCopy(rule config.CopyResourceRule, args templating.Args, channel chan<- error) {
+	defer func() {
+		if err := recover(); err != nil { //catch
+			channel <- fmt.Errorf("Recovered from panic when executing copy resource rule: %v", err)
+		}
+	}()
+
+	logger.Debugf("Processing copy resource rule:\n%s", rule.Describe())
+
+	if !checkWhen(rule.RuleOptions, "copy resource", rule.Describe(), args, channel) {
+		return
+	}
+
+	templatedNamespace, templatedName, templatedSelector, err := templateTarget(rule.Source.Namespace, rule.Source.Name, rule.Source.Selector, args)
+	if err != nil {
+		channel <- fmt.Errorf("Error templating copy resource rule source:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	options, err := rule.ToTemplatedCopyOptions(args)
+	if err != nil {
+		channel <- fmt.Errorf("Error templating copy resource rule target:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	client, err := rh.clientFor(rule.RuleOptions)
+	if err == nil {
+		err = client.Copy(rule.APIVersion, rule.Kind, templatedNamespace, templatedName, templatedSelector, options)
+	}
+	if err != nil {
+		channel <- fmt.Errorf("Error applying copy resource rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	channel <- nil
+}
+
+// handleJob executes Job rules
+func (rh RuleHandlerImpl) handleJob(rule config.JobRule, args templating.Args, channel chan<- error) {
+	defer func() {
+		if err := recover(); err != nil { //catch
+			channel <- fmt.Errorf("Recovered from panic when executing job rule: %v", err)
+		}
+	}()
+
+	logger.Debugf("Processing job rule:\n%s", rule.Describe())
+
+	if !checkWhen(rule.RuleOptions, "job", rule.Describe(), args, channel) {
+		return
+	}
+
+	job, err := rule.ParseTemplated(args)
+	if err != nil {
+		channel <- fmt.Errorf("Error templating job rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	client, err := rh.clientFor(rule.RuleOptions)
+	if err == nil {
+		err = client.RunJob(job.ToUnstructured(), rule.ToJobOptions())
+	}
+	if err != nil {
+		channel <- fmt.Errorf("Error applying job rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	channel <- nil
+}
+
+// handleWait executes Wait rules
+func (rh RuleHandlerImpl) handleWait(rule config.WaitRule, args templating.Args, channel chan<- error) {
+	defer func() {
+		if err := recover(); err != nil { //catch
+			channel <- fmt.Errorf("Recovered from panic when executing wait rule: %v", err)
+		}
+	}()
+
+	logger.Debugf("Processing wait rule:\n%s", rule.Describe())
+
+	if !checkWhen(rule.RuleOptions, "wait", rule.Describe(), args, channel) {
+		return
+	}
+
+	templatedNamespace, templatedName, templatedSelector, err := templateTarget(rule.Namespace, rule.Name, rule.Selector, args)
+	if err != nil {
+		channel <- fmt.Errorf("Error templating wait rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	options, err := rule.ToTemplatedWaitOptions(args)
+	if err != nil {
+		channel <- fmt.Errorf("Error templating wait rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	client, err := rh.clientFor(rule.RuleOptions)
+	if err == nil {
+		err = client.Wait(rule.APIVersion, rule.Kind, templatedNamespace, templatedName, templatedSelector, options)
+	}
+	if err != nil {
+		channel <- fmt.Errorf("Error applying wait rule:\n%s\nError: %s", rule.Describe(), err.Error())
+		return
+	}
+
+	channel <- nil
+}
+
+// clientFor returns the client to execute a rule with, for the cluster of the rule or else the cluster of the stage,
+// and impersonating the identity of the rule or else the identity of the Service Hook
+func (rh RuleHandlerImpl) clientFor(options config.RuleOptions) (kubernetes.Client, error) {
+	cluster := options.Cluster
+	if cluster == "" {
+		cluster = rh.cluster
+	}
+
+	var client kubernetes.Client
+	var err error
+	if options.DryRun {
+		client, err = rh.dryRunClient.Cluster(cluster)
+	} else {
+		client, err = rh.client.Cluster(cluster)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	impersonate := options.Impersonate
+	if impersonate == nil {
+		impersonate = rh.impersonate
+	}
+	if impersonate == nil {
+		return client, nil
+	}
+	return client.Impersonate(impersonate.User, impersonate.Groups)
+}
+
+// describeChanges returns a user-friendly list of changes
+func describeChanges(changes []kubernetes.Change) string {
+	var descriptions []string
+	for _, change := range changes {
+		descriptions = append(descriptions, fmt.Sprintf("- %s", change.Describe()))
+	}
+	return strings.Join(descriptions, "\n")
+}
+
+// describeSweepResults returns a user-friendly list of what a sweep found for each kind
+func describeSweepResults(results []kubernetes.SweepResult) string {
+	if len(results) == 0 {
+		return "- No resources were found"
+	}
+
+	var descriptions []string
+	for _, result := range results {
+		descriptions = append(descriptions, fmt.Sprintf("- %s", result.Describe()))
+	}
+	return strings.Join(descriptions, "\n")
+}
+
+// describeNamespaces returns " in namespace X", " in namespaces X, Y", or an empty string if no namespace is given
+func describeNamespaces(namespace string, namespaces []string) string {
+	if len(namespaces) > 0 {
+		return fmt.Sprintf(" in namespaces %s", strings.Join(namespaces, ", "))
+	} else if namespace == "" {
+		return ""
+	}
+	return fmt.Sprintf(" in namespace %s", namespace)
+}
+
+// checkWhen evaluates the when condition of a rule. If the rule shouldn't run, the result is sent to the channel and false is returned.
+func checkWhen(options config.RuleOptions, ruleType string, description string, args templating.Args, channel chan<- error) bool {
+	run, err := options.Matches(args)
+	if err != nil {
+		channel <- fmt.Errorf("Error evaluating %s rule condition:\n%s\nError: %s", ruleType, description, err.Error())
+		return false
+	} else if !run {
+		logger.Debugf("Skipping %s rule because its condition is false:\n%s", ruleType, description)
+		channel <- nil
+		return false
+	}
+	return true
+}
+
+// templateTarget templates the namespace, name and label selector that a rule uses to find resources
+func templateTarget(namespace string, name string, selector config.LabelSelector, args templating.Args) (string, string, metav1.LabelSelector, error) {
+	templatedNamespace, err := templating.Execute("Namespace", namespace, args)
+	if err != nil {
+		return "", "", metav1.LabelSelector{}, fmt.Errorf("Namespace templating error: %s", err.Error())
+	} else if namespace != "" && strings.TrimSpace(templatedNamespace) == "" {
+		// Without a namespace, the rule would target the resources of every namespace
+		return "", "", metav1.LabelSelector{}, fmt.Errorf("Namespace template '%s' rendered an empty value", namespace)
+	}
+
+	templatedName, err := templating.Execute("Name", name, args)
+	if err != nil {
+		return "", "", metav1.LabelSelector{}, fmt.Errorf("Name templating error: %s", err.Error())
+	} else if name != "" && strings.TrimSpace(templatedName) == "" {
+		// Without a name, the rule would target every resource of the kind
+		return "", "", metav1.LabelSelector{}, fmt.Errorf("Name template '%s' rendered an empty value", name)
+	}
+
+	templatedSelector, err := selector.ToTemplatedKubernetesLabelSelector(args)
+	if err != nil {
+		return "", "", metav1.LabelSelector{}, err
+	}
+
+	return templatedNamespace, templatedName, templatedSelector, nil
+}
+
+// forEachNamespace runs an action in the given namespace, or in parallel in every namespace matching the namespace selector,
+// with at most as many namespaces at once as the client has workers for bulk changes.
+// The namespaces are resolved when the rule runs, and errors are reported for each namespace.
+func forEachNamespace(client kubernetes.Client, namespace string, namespaceSelector *config.LabelSelector, args templating.Args, action func(namespace string) error) error {
+	if namespaceSelector == nil {
+		return action(namespace)
+	}
+
+	namespaces, err := selectNamespaces(client, namespaceSelector, args)
+	if err != nil {
+		return err
+	}
+
+	var errors []string
+	for pos, err := range client.ForEachNamespace(namespaces, action) {
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("- Namespace %s: %s", namespaces[pos], strings.ReplaceAll(err.Error(), "\n", "\n  ")))
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("Errors in %d of %d namespaces:\n%s", len(errors), len(namespaces), strings.Join(errors, "\n"))
+	}
+
+	return nil
+}
+
+// selectNamespaces returns the names of the namespaces matching the namespace selector when the rule runs
+func selectNamespaces(client kubernetes.Client, namespaceSelector *config.LabelSelector, args templating.Args) ([]string, error) {
+	templatedNamespaceSelector, err := namespaceSelector.ToTemplatedKubernetesLabelSelector(args)
+	if err != nil {
+		return nil, fmt.Errorf("Namespace selector templating error: %s", err.Error())
+	}
+
+	namespaces, err := client.List("v1", "Namespace", "", templatedNamespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("Error listing the namespaces matching the namespace selector: %s", err.Error())
+	}
+
+	if len(namespaces) == 0 {
+		logger.Infof("No namespaces matched the namespace selector %s", metav1.FormatLabelSelector(&templatedNamespaceSelector))
+	}
+
+	var names []string
+	for _, namespace := range namespaces {
+		names = append(names, namespace.Name)
+	}
+	return names, nil
+}
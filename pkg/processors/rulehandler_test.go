@@ -1,10 +1,1490 @@
 package processors_test
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/azuredevops"
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/config"
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/processors"
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/templating"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 func TestDeleteRules(t *testing.T) {
-	//handler := processors.NewRuleHandler(kubernetes.MakeFromClient(NewMockKubernetesClient()))
+	pullRequestID := 12
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{
+		EventType: "git.pullrequest.merged",
+		Resource: azuredevops.ServiceHookResource{
+			ServiceHookResourcePullRequest: azuredevops.ServiceHookResourcePullRequest{
+				PullRequestID: &pullRequestID,
+			},
+		},
+	})
+
+	t.Run("delete_test_name", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Delete: []config.DeleteResourceRule{
+				config.DeleteResourceRule{
+					APIVersion:    "v1",
+					Kind:          "ConfigMap",
+					Namespace:     "pr-{{ .PullRequestID }}",
+					Name:          "settings-{{ .PullRequestID }}",
+					FieldSelector: "metadata.namespace=pr-{{ .PullRequestID }}",
+				},
+			},
+		}
+
+		if err := handler.Handle(rules, args); err != nil {
+			t.Fatalf("Expected delete rule to succeed: %s", err.Error())
+		}
+
+		deletes := client.Deletes()
+		if len(deletes) != 1 {
+			t.Fatalf("Expected 1 delete but received %d", len(deletes))
+		}
+		if deletes[0].Namespace != "pr-12" || deletes[0].Name != "settings-12" {
+			t.Errorf("Expected to delete pr-12/settings-12 but received %s/%s", deletes[0].Namespace, deletes[0].Name)
+		}
+		if deletes[0].Options.FieldSelector != "metadata.namespace=pr-12" {
+			t.Errorf("Expected field selector metadata.namespace=pr-12 but received %s", deletes[0].Options.FieldSelector)
+		}
+		if len(deletes[0].LabelSelector.MatchLabels) != 0 || len(deletes[0].LabelSelector.MatchExpressions) != 0 {
+			t.Errorf("Expected an empty label selector but received %v", deletes[0].LabelSelector)
+		}
+	})
+
+	t.Run("delete_test_empty_name", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		// The resource name is empty for Pull Request events, so the name renders to ""
+		rules := config.Rules{
+			Delete: []config.DeleteResourceRule{
+				config.DeleteResourceRule{
+					APIVersion: "v1",
+					Kind:       "ConfigMap",
+					Namespace:  "pr-{{ .PullRequestID }}",
+					Name:       "{{ .ResourceName }}",
+				},
+				config.DeleteResourceRule{
+					Namespace: "pr-{{ .PullRequestID }}",
+					Name:      "{{ .ResourceName }}",
+					Sweep:     &config.DeleteSweep{},
+				},
+			},
+		}
+
+		err := handler.Handle(rules, args)
+		if err == nil || strings.Count(err.Error(), "rendered an empty value") != 2 {
+			t.Errorf("Expected an error for the empty name, but received %v", err)
+		}
+		if len(client.Deletes()) != 0 || len(client.Sweeps()) != 0 {
+			t.Errorf("Expected nothing to be deleted, but received %v and %v", client.Deletes(), client.Sweeps())
+		}
+	})
+
+	t.Run("delete_test_empty_namespace", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		// The resource name is empty for Pull Request events, so the namespace renders to ""
+		rules := config.Rules{
+			Delete: []config.DeleteResourceRule{
+				config.DeleteResourceRule{
+					APIVersion: "v1",
+					Kind:       "ConfigMap",
+					Namespace:  "{{ .ResourceName }}",
+					Selector:   config.LabelSelector{MatchLabels: map[string]string{"app": "preview"}},
+				},
+			},
+			Patch: []config.PatchResourceRule{
+				config.PatchResourceRule{
+					APIVersion: "v1",
+					Kind:       "ConfigMap",
+					Namespace:  "{{ .ResourceName }}",
+					Name:       "settings",
+					Type:       config.PatchTypeMerge,
+					Patch:      `{"data":{"key":"value"}}`,
+				},
+			},
+		}
+
+		err := handler.Handle(rules, args)
+		if err == nil || strings.Count(err.Error(), "Namespace template '{{ .ResourceName }}' rendered an empty value") != 2 {
+			t.Errorf("Expected an error for the empty namespaces, but received %v", err)
+		}
+		if len(client.Deletes()) != 0 || len(client.Patches()) != 0 {
+			t.Errorf("Expected nothing to be changed, but received %v and %v", client.Deletes(), client.Patches())
+		}
+	})
+
+	t.Run("delete_test_sweep", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Delete: []config.DeleteResourceRule{
+				config.DeleteResourceRule{
+					Namespace: "pr-{{ .PullRequestID }}",
+					Selector:  config.LabelSelector{MatchLabels: map[string]string{"azdPullRequestId": "{{ .PullRequestID }}"}},
+					Sweep:     &config.DeleteSweep{Groups: []string{"", "apps"}, ExcludeKinds: []string{"Secret"}},
+				},
+			},
+		}
+
+		if err := handler.Handle(rules, args); err != nil {
+			t.Fatalf("Expected sweeping delete rule to succeed: %s", err.Error())
+		}
+
+		sweeps := client.Sweeps()
+		if len(sweeps) != 1 {
+			t.Fatalf("Expected 1 sweep but received %d", len(sweeps))
+		}
+		if sweeps[0].Namespace != "pr-12" || sweeps[0].LabelSelector.MatchLabels["azdPullRequestId"] != "12" {
+			t.Errorf("Expected to sweep namespace pr-12 with label azdPullRequestId=12, but received %v", sweeps[0])
+		}
+		if len(sweeps[0].SweepOptions.Groups) != 2 || len(sweeps[0].SweepOptions.ExcludeKinds) != 1 {
+			t.Errorf("Expected the sweep options to be passed through, but received %v", sweeps[0].SweepOptions)
+		}
+		if len(client.Deletes()) != 0 {
+			t.Errorf("Expected no single-kind deletes but received %v", client.Deletes())
+		}
+	})
+
+	t.Run("delete_test_selector", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Delete: []config.DeleteResourceRule{
+				config.DeleteResourceRule{
+					APIVersion: "v1",
+					Kind:       "Namespace",
+					Selector:   config.LabelSelector{MatchLabels: map[string]string{"azdPullRequestId": "{{ .PullRequestID }}"}},
+				},
+			},
+		}
+
+		if err := handler.Handle(rules, args); err != nil {
+			t.Fatalf("Expected delete rule to succeed: %s", err.Error())
+		}
+
+		if count := client.DeleteCount("v1", "Namespace"); count == nil || *count != 1 {
+			t.Fatalf("Expected 1 Namespace delete but received %v", count)
+		}
+		if label := client.Deletes()[0].LabelSelector.MatchLabels["azdPullRequestId"]; label != "12" {
+			t.Errorf("Expected label azdPullRequestId=12 but received %s", label)
+		}
+	})
+}
+
+func TestNamespaceSelectorRules(t *testing.T) {
+	pullRequestID := 12
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{
+		EventType: "git.pullrequest.merged",
+		Resource: azuredevops.ServiceHookResource{
+			ServiceHookResourcePullRequest: azuredevops.ServiceHookResourcePullRequest{
+				PullRequestID: &pullRequestID,
+			},
+		},
+	})
+
+	namespaceSelector := &config.LabelSelector{MatchLabels: map[string]string{"azdPullRequestId": "{{ .PullRequestID }}"}}
+	namespaces := []kubernetes.Resource{
+		kubernetes.Resource{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}},
+		kubernetes.Resource{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+	}
+
+	t.Run("namespace_selector_test_delete", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		client.SetList("v1", "Namespace", namespaces)
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Delete: []config.DeleteResourceRule{
+				config.DeleteResourceRule{
+					APIVersion:        "networking.k8s.io/v1beta1",
+					Kind:              "Ingress",
+					NamespaceSelector: namespaceSelector,
+					Name:              "pr-{{ .PullRequestID }}",
+				},
+			},
+		}
+
+		if err := handler.Handle(rules, args); err != nil {
+			t.Fatalf("Expected delete rule to succeed: %s", err.Error())
+		}
+
+		// The namespaces are deleted from together, so that the limit and the retention policy apply to all of them
+		if len(client.Deletes()) != 1 {
+			t.Fatalf("Expected 1 delete but received %d", len(client.Deletes()))
+		}
+		deleted := client.Deletes()[0]
+		if deleted.Name != "pr-12" {
+			t.Errorf("Expected to delete pr-12 but received %s", deleted.Name)
+		}
+		if namespaces := deleted.Options.Namespaces; len(namespaces) != 2 || namespaces[0] != "team-a" || namespaces[1] != "team-b" {
+			t.Errorf("Expected deletes in team-a and team-b but received %v", namespaces)
+		}
+	})
+
+	t.Run("namespace_selector_test_sweep", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		client.SetList("v1", "Namespace", namespaces)
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		limit := 5
+		rules := config.Rules{
+			Delete: []config.DeleteResourceRule{
+				config.DeleteResourceRule{
+					NamespaceSelector: namespaceSelector,
+					Selector:          config.LabelSelector{MatchLabels: map[string]string{"azdPullRequestId": "{{ .PullRequestID }}"}},
+					Sweep:             &config.DeleteSweep{},
+					Limit:             &limit,
+				},
+			},
+		}
+
+		if err := handler.Handle(rules, args); err != nil {
+			t.Fatalf("Expected sweep rule to succeed: %s", err.Error())
+		}
+
+		if len(client.Sweeps()) != 1 {
+			t.Fatalf("Expected 1 sweep but received %d", len(client.Sweeps()))
+		}
+		swept := client.Sweeps()[0]
+		if namespaces := swept.Options.Namespaces; len(namespaces) != 2 || namespaces[0] != "team-a" || namespaces[1] != "team-b" {
+			t.Errorf("Expected to sweep team-a and team-b but received %v", namespaces)
+		}
+		if swept.Options.Limit == nil || *swept.Options.Limit != limit {
+			t.Errorf("Expected the limit of %d to be passed, but received %v", limit, swept.Options.Limit)
+		}
+	})
+
+	t.Run("namespace_selector_test_errors", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		client.SetList("v1", "Namespace", namespaces)
+		client.FailNamespace("team-b", errors.New("forbidden"))
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Patch: []config.PatchResourceRule{
+				config.PatchResourceRule{
+					APIVersion:        "networking.k8s.io/v1beta1",
+					Kind:              "Ingress",
+					NamespaceSelector: namespaceSelector,
+					Name:              "pr-{{ .PullRequestID }}",
+					Patch:             "metadata:\n  annotations:\n    azdMerged: 'true'\n",
+				},
+			},
+		}
+
+		err := handler.Handle(rules, args)
+		if err == nil {
+			t.Fatalf("Expected patch rule to fail in namespace team-b")
+		}
+		if !strings.Contains(err.Error(), "Namespace team-b: forbidden") || strings.Contains(err.Error(), "Namespace team-a") {
+			t.Errorf("Expected only namespace team-b to be reported, but received: %s", err.Error())
+		}
+		if len(client.Patches()) != 2 {
+			t.Errorf("Expected 2 patches but received %d", len(client.Patches()))
+		}
+	})
+
+	t.Run("namespace_selector_test_no_match", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Delete: []config.DeleteResourceRule{
+				config.DeleteResourceRule{
+					APIVersion:        "networking.k8s.io/v1beta1",
+					Kind:              "Ingress",
+					NamespaceSelector: namespaceSelector,
+					Name:              "pr-{{ .PullRequestID }}",
+				},
+			},
+		}
+
+		if err := handler.Handle(rules, args); err != nil {
+			t.Fatalf("Expected delete rule to succeed: %s", err.Error())
+		}
+		if len(client.Deletes()) != 0 {
+			t.Errorf("Expected no deletes but received %v", client.Deletes())
+		}
+	})
+}
+
+func TestClusterRules(t *testing.T) {
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{EventType: "git.pullrequest.merged"})
+
+	t.Run("cluster_test_rule", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		client.AddCluster("dev")
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Delete: []config.DeleteResourceRule{
+				config.DeleteResourceRule{
+					APIVersion:  "v1",
+					Kind:        "ConfigMap",
+					Namespace:   "preview",
+					Name:        "settings",
+					RuleOptions: config.RuleOptions{Cluster: "dev"},
+				},
+				config.DeleteResourceRule{
+					APIVersion: "v1",
+					Kind:       "ConfigMap",
+					Namespace:  "release",
+					Name:       "settings",
+				},
+			},
+		}
+
+		if err := handler.Handle(rules, args); err != nil {
+			t.Fatalf("Expected delete rules to succeed: %s", err.Error())
+		}
+
+		clusters := make(map[string]string)
+		for _, deleted := range client.Deletes() {
+			clusters[deleted.Namespace] = deleted.Cluster
+		}
+		if len(clusters) != 2 || clusters["preview"] != "dev" || clusters["release"] != "" {
+			t.Errorf("Expected the preview delete on cluster dev and the release delete on the default cluster, but received %v", clusters)
+		}
+	})
+
+	t.Run("cluster_test_stage", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		client.AddCluster("dev")
+		client.AddCluster("staging")
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Stages: []config.RuleStage{
+				config.RuleStage{
+					Name:    "preview",
+					Cluster: "dev",
+					Rules: config.Rules{
+						Patch: []config.PatchResourceRule{
+							config.PatchResourceRule{
+								APIVersion: "v1",
+								Kind:       "ConfigMap",
+								Namespace:  "preview",
+								Name:       "settings",
+								Patch:      "data:\n  merged: 'true'\n",
+							},
+							config.PatchResourceRule{
+								APIVersion:  "v1",
+								Kind:        "ConfigMap",
+								Namespace:   "staging",
+								Name:        "settings",
+								Patch:       "data:\n  merged: 'true'\n",
+								RuleOptions: config.RuleOptions{Cluster: "staging"},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		if err := handler.Handle(rules, args); err != nil {
+			t.Fatalf("Expected stage to succeed: %s", err.Error())
+		}
+
+		clusters := make(map[string]string)
+		for _, patch := range client.Patches() {
+			clusters[patch.Namespace] = patch.Cluster
+		}
+		if len(clusters) != 2 || clusters["preview"] != "dev" || clusters["staging"] != "staging" {
+			t.Errorf("Expected the stage cluster unless the rule defines its own, but received %v", clusters)
+		}
+	})
+
+	t.Run("cluster_test_undefined", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Delete: []config.DeleteResourceRule{
+				config.DeleteResourceRule{
+					APIVersion:  "v1",
+					Kind:        "ConfigMap",
+					Namespace:   "preview",
+					Name:        "settings",
+					RuleOptions: config.RuleOptions{Cluster: "dev"},
+				},
+			},
+		}
+
+		err := handler.Handle(rules, args)
+		if err == nil || !strings.Contains(err.Error(), "Cluster dev is not defined") {
+			t.Errorf("Expected the delete rule to fail because cluster dev is not defined, but received %v", err)
+		}
+		if len(client.Deletes()) != 0 {
+			t.Errorf("Expected no deletes but received %v", client.Deletes())
+		}
+	})
+}
+
+func TestImpersonationRules(t *testing.T) {
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{EventType: "git.pullrequest.merged"})
+
+	rules := config.Rules{
+		Delete: []config.DeleteResourceRule{
+			config.DeleteResourceRule{
+				APIVersion: "v1",
+				Kind:       "ConfigMap",
+				Namespace:  "team-a",
+				Name:       "settings",
+			},
+			config.DeleteResourceRule{
+				APIVersion:  "v1",
+				Kind:        "ConfigMap",
+				Namespace:   "team-b",
+				Name:        "settings",
+				RuleOptions: config.RuleOptions{Impersonate: &config.Impersonation{User: "team-b"}},
+			},
+		},
+	}
+
+	handlers := map[string]func(handler processors.RuleHandler) error{
+		"impersonation_test_handle": func(handler processors.RuleHandler) error {
+			return handler.Handle(rules, args)
+		},
+		"impersonation_test_transaction": func(handler processors.RuleHandler) error {
+			return handler.HandleTransaction(rules, args)
+		},
+		"impersonation_test_dry_run": func(handler processors.RuleHandler) error {
+			_, err := handler.HandleDryRun(rules, args)
+			return err
+		},
+	}
+
+	for name, handle := range handlers {
+		t.Run(name, func(t *testing.T) {
+			client := NewMockKubernetesClient()
+			handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client)).Impersonating(&config.Impersonation{User: "team-a"})
+
+			if err := handle(handler); err != nil {
+				t.Fatalf("Expected delete rules to succeed: %s", err.Error())
+			}
+
+			users := make(map[string]string)
+			for _, deleted := range client.Deletes() {
+				users[deleted.Namespace] = deleted.User
+			}
+			if len(users) != 2 || users["team-a"] != "team-a" || users["team-b"] != "team-b" {
+				t.Errorf("Expected the Service Hook identity unless the rule defines its own, but received %v", users)
+			}
+		})
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	pullRequestID := 12
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{
+		EventType: "git.pullrequest.created",
+		Resource: azuredevops.ServiceHookResource{
+			ServiceHookResourcePullRequest: azuredevops.ServiceHookResourcePullRequest{
+				PullRequestID: &pullRequestID,
+			},
+		},
+	})
+
+	t.Run("apply_test_good", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Apply: []config.ApplyResourceRule{
+				config.ApplyResourceRule{Resources: "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: pr-{{ .PullRequestID }}\n  labels:\n    azdPullRequestId: '{{ .PullRequestID }}'\n"},
+			},
+		}
+
+		if err := handler.Handle(rules, args); err != nil {
+			t.Fatalf("Expected apply rule to succeed: %s", err.Error())
+		}
+
+		applied := client.Applied()
+		if len(applied) != 1 {
+			t.Fatalf("Expected 1 applied resource but received %d", len(applied))
+		}
+		if applied[0].GetName() != "pr-12" {
+			t.Errorf("Expected name pr-12 but received %s", applied[0].GetName())
+		}
+		if applied[0].GetLabels()["azdPullRequestId"] != "12" {
+			t.Errorf("Expected label azdPullRequestId=12 but received %v", applied[0].GetLabels())
+		}
+	})
+
+	t.Run("apply_test_multidocument_order", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Apply: []config.ApplyResourceRule{
+				config.ApplyResourceRule{Resources: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n  namespace: pr-{{ .PullRequestID }}\n---\napiVersion: v1\nkind: Service\nmetadata:\n  name: app\n  namespace: pr-{{ .PullRequestID }}\n---\napiVersion: v1\nkind: Namespace\nmetadata:\n  name: pr-{{ .PullRequestID }}\n"},
+			},
+		}
+
+		if err := handler.Handle(rules, args); err != nil {
+			t.Fatalf("Expected apply rule to succeed: %s", err.Error())
+		}
+
+		applied := client.Applied()
+		expectedKinds := []string{"Namespace", "Service", "Deployment"}
+		if len(applied) != len(expectedKinds) {
+			t.Fatalf("Expected %d applied resources but received %d", len(expectedKinds), len(applied))
+		}
+		for pos, expectedKind := range expectedKinds {
+			if applied[pos].GetKind() != expectedKind {
+				t.Errorf("Expected resource %d to be a %s but received %s", pos, expectedKind, applied[pos].GetKind())
+			}
+		}
+	})
+
+	t.Run("apply_test_unknown_kinds_order", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		client.AddAPIResource(metav1.APIResource{Kind: "ClusterIssuer", Namespaced: false})
+		client.AddAPIResource(metav1.APIResource{Kind: "Certificate", Namespaced: true})
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		// Widget isn't discoverable, so it is treated as cluster-scoped because it has no namespace
+		rules := config.Rules{
+			Apply: []config.ApplyResourceRule{
+				config.ApplyResourceRule{Resources: "apiVersion: cert-manager.io/v1\nkind: Certificate\nmetadata:\n  name: app\n  namespace: pr-{{ .PullRequestID }}\n---\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n  namespace: pr-{{ .PullRequestID }}\n---\napiVersion: cert-manager.io/v1\nkind: ClusterIssuer\nmetadata:\n  name: pr-{{ .PullRequestID }}\n---\napiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: pr-{{ .PullRequestID }}\n"},
+			},
+		}
+
+		if err := handler.Handle(rules, args); err != nil {
+			t.Fatalf("Expected apply rule to succeed: %s", err.Error())
+		}
+
+		var kinds []string
+		for _, resource := range client.Applied() {
+			kinds = append(kinds, resource.GetKind())
+		}
+		if strings.Join(kinds, ",") != "ClusterIssuer,Widget,Deployment,Certificate" {
+			t.Errorf("Expected unknown cluster-scoped kinds before namespaced kinds, but received %v", kinds)
+		}
+	})
+
+	t.Run("apply_test_bad_noname", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Apply: []config.ApplyResourceRule{
+				config.ApplyResourceRule{Resources: "apiVersion: v1\nkind: Namespace\n"},
+			},
+		}
+
+		if err := handler.Handle(rules, args); err == nil {
+			t.Errorf("Expected apply rule without a name to fail")
+		}
+
+		if len(client.Applied()) != 0 {
+			t.Errorf("Expected no resources to be applied")
+		}
+	})
+	t.Run("apply_test_options", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		client.AddCluster("dev")
+		client.FailNamespace("broken", errors.New("admission webhook denied the request"))
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		configMap := func(name string, namespace string, options config.RuleOptions) config.ApplyResourceRule {
+			return config.ApplyResourceRule{
+				Resources:   config.Manifest(fmt.Sprintf("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\n  namespace: %s\n", name, namespace)),
+				RuleOptions: options,
+			}
+		}
+
+		rules := config.Rules{
+			Stages: []config.RuleStage{
+				config.RuleStage{Name: "settings", Rules: config.Rules{Apply: []config.ApplyResourceRule{
+					configMap("settings", "preview", config.RuleOptions{Cluster: "dev", DryRun: true, Impersonate: &config.Impersonation{User: "deployer"}}),
+					configMap("settings", "broken", config.RuleOptions{OnFailure: config.FailurePolicyContinue}),
+				}}},
+				config.RuleStage{Name: "smoke-test", Rules: config.Rules{Apply: []config.ApplyResourceRule{
+					configMap("smoke-test", "preview", config.RuleOptions{}),
+				}}},
+			},
+		}
+
+		err := handler.Handle(rules, args)
+		if err == nil || !strings.Contains(err.Error(), "admission webhook denied the request") {
+			t.Errorf("Expected the failed apply to be reported, but received %v", err)
+		}
+
+		applies := client.Applies()
+		if len(applies) != 3 {
+			t.Fatalf("Expected the next stage to run after an apply rule that continues on failure, but received %v", applies)
+		}
+		for _, apply := range applies {
+			dev := apply.Resource.GetNamespace() == "preview" && apply.Resource.GetName() == "settings"
+			if dev != (apply.Cluster == "dev") || dev != apply.DryRun || dev != (apply.User == "deployer") {
+				t.Errorf("Unexpected cluster %s, dry run %t and user %s for %s/%s", apply.Cluster, apply.DryRun, apply.User, apply.Resource.GetNamespace(), apply.Resource.GetName())
+			}
+		}
+	})
+}
+
+func TestPatchRules(t *testing.T) {
+	buildNumber := "20191012.3"
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{
+		EventType: "build.complete",
+		Resource: azuredevops.ServiceHookResource{
+			IntDefinition: azuredevops.IntDefinition{ID: 42},
+			ServiceHookResourceBuildComplete: azuredevops.ServiceHookResourceBuildComplete{
+				BuildNumber: &buildNumber,
+			},
+		},
+	})
+
+	t.Run("patch_test_empty_name", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		// The resource name is empty for build events, so the names render to ""
+		rules := config.Rules{
+			Patch: []config.PatchResourceRule{
+				config.PatchResourceRule{
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
+					Namespace:  "build-{{ .BuildID }}",
+					Name:       "{{ .ResourceName }}",
+					Patch:      "metadata:\n  annotations:\n    azdBuildNumber: '{{ .BuildNumber }}'\n",
+				},
+			},
+			Scale: []config.ScaleResourceRule{
+				config.ScaleResourceRule{
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
+					Namespace:  "build-{{ .BuildID }}",
+					Name:       "{{ .ResourceName }}",
+				},
+			},
+		}
+
+		err := handler.Handle(rules, args)
+		if err == nil || strings.Count(err.Error(), "rendered an empty value") != 2 {
+			t.Errorf("Expected an error for each empty name, but received %v", err)
+		}
+		if len(client.Patches()) != 0 || len(client.Scales()) != 0 {
+			t.Errorf("Expected nothing to be patched or scaled, but received %v and %v", client.Patches(), client.Scales())
+		}
+	})
+
+	t.Run("patch_test_merge", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Patch: []config.PatchResourceRule{
+				config.PatchResourceRule{
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
+					Namespace:  "build-{{ .BuildID }}",
+					Selector: config.LabelSelector{
+						MatchLabels: map[string]string{"azdBuildId": "{{ .BuildID }}"},
+					},
+					Patch: "metadata:\n  annotations:\n    azdBuildNumber: '{{ .BuildNumber }}'\n",
+				},
+			},
+		}
+
+		if err := handler.Handle(rules, args); err != nil {
+			t.Fatalf("Expected patch rule to succeed: %s", err.Error())
+		}
+
+		patches := client.Patches()
+		if len(patches) != 1 {
+			t.Fatalf("Expected 1 patch but received %d", len(patches))
+		}
+		if patches[0].Namespace != "build-42" {
+			t.Errorf("Expected namespace build-42 but received %s", patches[0].Namespace)
+		}
+		if patches[0].LabelSelector.MatchLabels["azdBuildId"] != "42" {
+			t.Errorf("Expected the label selector to be templated, but received %v", patches[0].LabelSelector.MatchLabels)
+		}
+		if patches[0].PatchType != types.MergePatchType {
+			t.Errorf("Expected a merge patch but received %s", patches[0].PatchType)
+		}
+		if patches[0].Patch != `{"metadata":{"annotations":{"azdBuildNumber":"20191012.3"}}}` {
+			t.Errorf("Unexpected patch %s", patches[0].Patch)
+		}
+	})
+
+	t.Run("patch_test_bad_jsonpatch", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Patch: []config.PatchResourceRule{
+				config.PatchResourceRule{
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
+					Namespace:  "build-{{ .BuildID }}",
+					Name:       "app",
+					Type:       config.PatchTypeJSON,
+					Patch:      `{"op": "replace"}`,
+				},
+			},
+		}
+
+		if err := handler.Handle(rules, args); err == nil {
+			t.Errorf("Expected a JSON patch that isn't a list to fail")
+		}
+
+		if len(client.Patches()) != 0 {
+			t.Errorf("Expected no resources to be patched")
+		}
+	})
+}
+
+func TestScaleRules(t *testing.T) {
+	pullRequestID := 7
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{
+		EventType: "git.pullrequest.updated",
+		Resource: azuredevops.ServiceHookResource{
+			ServiceHookResourcePullRequest: azuredevops.ServiceHookResourcePullRequest{
+				PullRequestID: &pullRequestID,
+			},
+		},
+	})
+
+	client := NewMockKubernetesClient()
+	handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+	replicas := int32(0)
+	rules := config.Rules{
+		Scale: []config.ScaleResourceRule{
+			config.ScaleResourceRule{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Namespace:  "pr-{{ .PullRequestID }}",
+				Selector: config.LabelSelector{
+					MatchLabels: map[string]string{"azdPullRequestId": "{{ .PullRequestID }}"},
+				},
+				Replicas:                   &replicas,
+				PreviousReplicasAnnotation: "azd-kubernetes-manager/previous-replicas",
+			},
+		},
+	}
+
+	if err := handler.Handle(rules, args); err != nil {
+		t.Fatalf("Expected scale rule to succeed: %s", err.Error())
+	}
+
+	scales := client.Scales()
+	if len(scales) != 1 {
+		t.Fatalf("Expected 1 scale but received %d", len(scales))
+	}
+	if scales[0].Namespace != "pr-7" || scales[0].LabelSelector.MatchLabels["azdPullRequestId"] != "7" {
+		t.Errorf("Expected the namespace and label selector to be templated, but received %+v", scales[0])
+	}
+	if scales[0].Options.Replicas == nil || *scales[0].Options.Replicas != 0 || scales[0].Options.PreviousReplicasAnnotation != "azd-kubernetes-manager/previous-replicas" {
+		t.Errorf("Unexpected scale options %+v", scales[0].Options)
+	}
+}
+
+func TestRestartRules(t *testing.T) {
+	buildNumber := "20191012.3"
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{
+		ID:        "MockServiceHookId",
+		EventType: "build.complete",
+		Resource: azuredevops.ServiceHookResource{
+			IntDefinition: azuredevops.IntDefinition{ID: 42},
+			ServiceHookResourceBuildComplete: azuredevops.ServiceHookResourceBuildComplete{
+				BuildNumber: &buildNumber,
+			},
+		},
+	})
+
+	client := NewMockKubernetesClient()
+	handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+	rules := config.Rules{
+		Restart: []config.RestartResourceRule{
+			config.RestartResourceRule{
+				Kind:      "Deployment",
+				Namespace: "dev",
+				Selector: config.LabelSelector{
+					MatchLabels: map[string]string{"imageTag": "latest-dev"},
+				},
+			},
+		},
+	}
+
+	if err := handler.Handle(rules, args); err != nil {
+		t.Fatalf("Expected restart rule to succeed: %s", err.Error())
+	}
+
+	patches := client.Patches()
+	if len(patches) != 1 {
+		t.Fatalf("Expected 1 patch but received %d", len(patches))
+	}
+	if patches[0].APIVersion != "apps/v1" || patches[0].Kind != "Deployment" {
+		t.Errorf("Expected an apps/v1 Deployment but received %s %s", patches[0].APIVersion, patches[0].Kind)
+	}
+
+	var patch map[string]interface{}
+	if err := json.Unmarshal([]byte(patches[0].Patch), &patch); err != nil {
+		t.Fatalf("Error parsing patch: %s", err.Error())
+	}
+	annotations := patch["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	if annotations[config.RestartedAtAnnotation] == nil {
+		t.Errorf("Expected the %s annotation to be set", config.RestartedAtAnnotation)
+	}
+	if annotations[config.RestartServiceHookIDAnnotation] != "MockServiceHookId" {
+		t.Errorf("Expected the %s annotation to be MockServiceHookId, but received %v", config.RestartServiceHookIDAnnotation, annotations[config.RestartServiceHookIDAnnotation])
+	}
+	if annotations[config.RestartBuildNumberAnnotation] != buildNumber {
+		t.Errorf("Expected the %s annotation to be %s, but received %v", config.RestartBuildNumberAnnotation, buildNumber, annotations[config.RestartBuildNumberAnnotation])
+	}
+
+	// A restart without a build number removes the build number of the previous restart
+	args = templating.NewArgsFromServiceHook(azuredevops.ServiceHook{ID: "MockServiceHookId", EventType: "git.pullrequest.merged"})
+	if err := handler.Handle(rules, args); err != nil {
+		t.Fatalf("Expected restart rule to succeed: %s", err.Error())
+	}
+
+	patches = client.Patches()
+	if len(patches) != 2 {
+		t.Fatalf("Expected 2 patches but received %d", len(patches))
+	}
+	if err := json.Unmarshal([]byte(patches[1].Patch), &patch); err != nil {
+		t.Fatalf("Error parsing patch: %s", err.Error())
+	}
+	annotations = patch["spec"].(map[string]interface{})["template"].(map[string]interface{})["metadata"].(map[string]interface{})["annotations"].(map[string]interface{})
+	if value, exists := annotations[config.RestartBuildNumberAnnotation]; !exists || value != nil {
+		t.Errorf("Expected the %s annotation to be removed, but received %v", config.RestartBuildNumberAnnotation, value)
+	}
+}
+
+func TestLabelRules(t *testing.T) {
+	pullRequestID := 7
+	status := "completed"
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{
+		EventType: "git.pullrequest.merged",
+		Resource: azuredevops.ServiceHookResource{
+			ServiceHookResourcePullRequest: azuredevops.ServiceHookResourcePullRequest{
+				PullRequestID: &pullRequestID,
+			},
+			Status: &status,
+		},
+	})
+
+	client := NewMockKubernetesClient()
+	handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+	rules := config.Rules{
+		Label: []config.LabelResourceRule{
+			config.LabelResourceRule{
+				APIVersion: "v1",
+				Kind:       "Namespace",
+				Selector: config.LabelSelector{
+					MatchLabels: map[string]string{"azdPullRequestId": "{{ .PullRequestID }}"},
+				},
+				Labels:            map[string]string{"azdPullRequestStatus": "{{ .Status }}"},
+				RemoveAnnotations: []string{"azdPreviewUrl"},
+			},
+		},
+	}
+
+	if err := handler.Handle(rules, args); err != nil {
+		t.Fatalf("Expected label rule to succeed: %s", err.Error())
+	}
+
+	patches := client.Patches()
+	if len(patches) != 1 {
+		t.Fatalf("Expected 1 patch but received %d", len(patches))
+	}
+	if patches[0].PatchType != types.MergePatchType {
+		t.Errorf("Expected a merge patch but received %s", patches[0].PatchType)
+	}
+	expectedPatch := `{"metadata":{"annotations":{"azdPreviewUrl":null},"labels":{"azdPullRequestStatus":"completed"}}}`
+	if patches[0].Patch != expectedPatch {
+		t.Errorf("Expected patch %s but received %s", expectedPatch, patches[0].Patch)
+	}
+}
+
+func TestCopyRules(t *testing.T) {
+	pullRequestID := 7
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{
+		EventType: "git.pullrequest.created",
+		Resource: azuredevops.ServiceHookResource{
+			ServiceHookResourcePullRequest: azuredevops.ServiceHookResourcePullRequest{
+				PullRequestID: &pullRequestID,
+			},
+		},
+	})
+
+	client := NewMockKubernetesClient()
+	handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+	rules := config.Rules{
+		Copy: []config.CopyResourceRule{
+			config.CopyResourceRule{
+				APIVersion: "v1",
+				Kind:       "Secret",
+				Source: config.CopyResourceSource{
+					Namespace: "shared",
+					Name:      "registry",
+				},
+				Target: config.CopyResourceTarget{
+					Namespace: "pr-{{ .PullRequestID }}",
+					Labels:    map[string]string{"azdPullRequestId": "{{ .PullRequestID }}"},
+				},
+				Sync: true,
+			},
+		},
+	}
+
+	if err := handler.Handle(rules, args); err != nil {
+		t.Fatalf("Expected copy rule to succeed: %s", err.Error())
+	}
+
+	copies := client.Copies()
+	if len(copies) != 1 {
+		t.Fatalf("Expected 1 copy but received %d", len(copies))
+	}
+	if copies[0].SourceNamespace != "shared" || copies[0].SourceName != "registry" {
+		t.Errorf("Unexpected copy source %s/%s", copies[0].SourceNamespace, copies[0].SourceName)
+	}
+	if copies[0].Options.TargetNamespace != "pr-7" || copies[0].Options.Labels["azdPullRequestId"] != "7" || !copies[0].Options.Sync {
+		t.Errorf("Unexpected copy options %+v", copies[0].Options)
+	}
+}
+
+func TestJobRules(t *testing.T) {
+	buildNumber := "20191012.3"
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{
+		EventType: "build.complete",
+		Resource: azuredevops.ServiceHookResource{
+			IntDefinition: azuredevops.IntDefinition{ID: 42},
+			ServiceHookResourceBuildComplete: azuredevops.ServiceHookResourceBuildComplete{
+				BuildNumber: &buildNumber,
+			},
+		},
+	})
+
+	rules := config.Rules{
+		Job: []config.JobRule{
+			config.JobRule{
+				Job: config.Manifest("apiVersion: batch/v1\nkind: Job\nmetadata:\n  generateName: migrate-{{ .BuildID }}-\n  namespace: dev\nspec:\n  template:\n    spec:\n      restartPolicy: Never\n      containers:\n      - name: migrate\n        image: registry.example.com/migrate:{{ .BuildNumber }}\n"),
+			},
+		},
+	}
+
+	t.Run("job_test_good", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		if err := handler.Handle(rules, args); err != nil {
+			t.Fatalf("Expected job rule to succeed: %s", err.Error())
+		}
+
+		jobs := client.Jobs()
+		if len(jobs) != 1 {
+			t.Fatalf("Expected 1 job but received %d", len(jobs))
+		}
+		if jobs[0].GetGenerateName() != "migrate-42-" {
+			t.Errorf("Expected generateName migrate-42- but received %s", jobs[0].GetGenerateName())
+		}
+	})
+
+	t.Run("job_test_failed", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		client.FailJobs(errors.New("Job dev/migrate-42-abcde did not succeed: BackoffLimitExceeded"))
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		err := handler.Handle(rules, args)
+		if err == nil || !strings.Contains(err.Error(), "BackoffLimitExceeded") {
+			t.Errorf("Expected the job failure to be reported, but received %v", err)
+		}
+	})
+}
+
+func TestWaitRules(t *testing.T) {
+	pullRequestID := 7
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{
+		EventType: "git.pullrequest.created",
+		Resource: azuredevops.ServiceHookResource{
+			ServiceHookResourcePullRequest: azuredevops.ServiceHookResourcePullRequest{
+				PullRequestID: &pullRequestID,
+			},
+		},
+	})
+
+	client := NewMockKubernetesClient()
+	handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+	rules := config.Rules{
+		Wait: []config.WaitRule{
+			config.WaitRule{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Namespace:  "pr-{{ .PullRequestID }}",
+				Selector: config.LabelSelector{
+					MatchLabels: map[string]string{"azdPullRequestId": "{{ .PullRequestID }}"},
+				},
+				Condition: "Available",
+			},
+		},
+	}
+
+	if err := handler.Handle(rules, args); err != nil {
+		t.Fatalf("Expected wait rule to succeed: %s", err.Error())
+	}
+
+	waits := client.Waits()
+	if len(waits) != 1 {
+		t.Fatalf("Expected 1 wait but received %d", len(waits))
+	}
+	if waits[0].Namespace != "pr-7" || waits[0].LabelSelector.MatchLabels["azdPullRequestId"] != "7" {
+		t.Errorf("Unexpected wait target %s %+v", waits[0].Namespace, waits[0].LabelSelector)
+	}
+	if waits[0].Options.Condition != "Available" || waits[0].Options.Timeout != 5*time.Minute || waits[0].Options.PollInterval != 5*time.Second {
+		t.Errorf("Unexpected wait options %+v", waits[0].Options)
+	}
+}
+
+func TestRuleStages(t *testing.T) {
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{EventType: "git.pullrequest.created"})
+
+	namespace := config.ApplyResourceRule{Resources: "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: preview\n"}
+	deployment := config.ApplyResourceRule{Resources: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: preview\n"}
+	job := func(onFailure config.FailurePolicy) config.JobRule {
+		return config.JobRule{
+			Job:         config.Manifest("apiVersion: batch/v1\nkind: Job\nmetadata:\n  generateName: migrate-\n  namespace: preview\n"),
+			RuleOptions: config.RuleOptions{OnFailure: onFailure},
+		}
+	}
+
+	appliedNames := func(client MockKubernetesClient) []string {
+		var names []string
+		for _, resource := range client.Applied() {
+			names = append(names, resource.GetName())
+		}
+		return names
+	}
+
+	t.Run("stages_test_order", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Stages: []config.RuleStage{
+				config.RuleStage{Name: "namespace", Rules: config.Rules{Apply: []config.ApplyResourceRule{namespace}}},
+				config.RuleStage{Name: "deployment", Rules: config.Rules{Apply: []config.ApplyResourceRule{deployment}}},
+			},
+		}
+
+		if err := handler.Handle(rules, args); err != nil {
+			t.Fatalf("Expected stages to succeed: %s", err.Error())
+		}
+
+		if names := appliedNames(client); strings.Join(names, ",") != "preview,web" {
+			t.Errorf("Expected the namespace to be applied before the deployment, but received %v", names)
+		}
+	})
+
+	t.Run("stages_test_circuit_breaker", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		client.AbortOnDelete(errors.New("Deletion circuit breaker tripped"))
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		rules := config.Rules{
+			Stages: []config.RuleStage{
+				config.RuleStage{Name: "cleanup", OnFailure: config.FailurePolicyContinue, Rules: config.Rules{
+					Delete: []config.DeleteResourceRule{
+						config.DeleteResourceRule{APIVersion: "v1", Kind: "ConfigMap", Namespace: "preview", Name: "settings"},
+					},
+				}},
+				config.RuleStage{Name: "deployment", Rules: config.Rules{Apply: []config.ApplyResourceRule{deployment}}},
+			},
+		}
+
+		err := handler.Handle(rules, args)
+		if err == nil || !strings.Contains(err.Error(), "Skipped stage 'deployment'") {
+			t.Fatalf("Expected the circuit breaker to skip the remaining stages, but received %v", err)
+		}
+		if names := appliedNames(client); len(names) != 0 {
+			t.Errorf("Expected nothing to be applied, but received %v", names)
+		}
+	})
+
+	t.Run("stages_test_policies", func(t *testing.T) {
+		settings := config.ApplyResourceRule{Resources: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  namespace: preview\n"}
+		smokeTest := config.ApplyResourceRule{Resources: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: smoke-test\n  namespace: preview\n"}
+
+		tests := []struct {
+			onFailure config.FailurePolicy
+			applied   string
+		}{
+			{config.FailurePolicyContinue, "preview,settings,smoke-test,web"},
+			{config.FailurePolicyAbortStage, "preview,settings,smoke-test"},
+			{config.FailurePolicyAbortAll, "preview,settings"},
+		}
+
+		for _, test := range tests {
+			client := NewMockKubernetesClient()
+			client.FailJobs(errors.New("BackoffLimitExceeded"))
+			handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+			// The migration and the settings run in parallel. The deployment waits for the migration, and the smoke test waits for the settings.
+			rules := config.Rules{
+				Stages: []config.RuleStage{
+					config.RuleStage{Name: "namespace", Rules: config.Rules{Apply: []config.ApplyResourceRule{namespace}}},
+					config.RuleStage{Name: "migrate", DependsOn: []string{"namespace"}, Rules: config.Rules{Job: []config.JobRule{job(test.onFailure)}}},
+					config.RuleStage{Name: "settings", DependsOn: []string{"namespace"}, Rules: config.Rules{Apply: []config.ApplyResourceRule{settings}}},
+					config.RuleStage{Name: "deployment", DependsOn: []string{"migrate"}, Rules: config.Rules{Apply: []config.ApplyResourceRule{deployment}}},
+					config.RuleStage{Name: "smoke-test", DependsOn: []string{"settings"}, Rules: config.Rules{Apply: []config.ApplyResourceRule{smokeTest}}},
+				},
+			}
+
+			err := handler.Handle(rules, args)
+			if err == nil || !strings.Contains(err.Error(), "BackoffLimitExceeded") {
+				t.Errorf("[%s] Expected the job failure to be reported, but received %v", test.onFailure, err)
+			}
+
+			names := appliedNames(client)
+			sort.Strings(names)
+			if strings.Join(names, ",") != test.applied {
+				t.Errorf("[%s] Expected %s to be applied, but received %v", test.onFailure, test.applied, names)
+			}
+		}
+	})
+}
+
+func TestRuleConditions(t *testing.T) {
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{EventType: "git.pullrequest.merged"})
+
+	client := NewMockKubernetesClient()
+	handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+	replicas := int32(0)
+	scale := func(name string, when string) config.ScaleResourceRule {
+		return config.ScaleResourceRule{
+			APIVersion:  "apps/v1",
+			Kind:        "Deployment",
+			Namespace:   "preview",
+			Name:        name,
+			Replicas:    &replicas,
+			RuleOptions: config.RuleOptions{When: when},
+		}
+	}
+
+	rules := config.Rules{
+		Scale: []config.ScaleResourceRule{
+			scale("merged", `{{ eq .EventType "git.pullrequest.merged" }}`),
+			scale("created", `{{ eq .EventType "git.pullrequest.created" }}`),
+		},
+		Stages: []config.RuleStage{
+			config.RuleStage{
+				Name:  "created",
+				When:  `{{ eq .EventType "git.pullrequest.created" }}`,
+				Rules: config.Rules{Scale: []config.ScaleResourceRule{scale("stage-created", "")}},
+			},
+			config.RuleStage{
+				Name:  "always",
+				Rules: config.Rules{Scale: []config.ScaleResourceRule{scale("stage-always", "")}},
+			},
+		},
+	}
+
+	if err := handler.Handle(rules, args); err != nil {
+		t.Fatalf("Expected rules to succeed: %s", err.Error())
+	}
+
+	var names []string
+	for _, scale := range client.Scales() {
+		names = append(names, scale.Name)
+	}
+	if strings.Join(names, ",") != "merged,stage-always" {
+		t.Errorf("Expected only the matching rules to run, but received %v", names)
+	}
+
+	settings := func(when string) config.ApplyResourceRule {
+		return config.ApplyResourceRule{
+			Resources:   config.Manifest("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings-{{ .EventType }}\n  namespace: preview\n"),
+			RuleOptions: config.RuleOptions{When: when},
+		}
+	}
+	rules = config.Rules{
+		Apply: []config.ApplyResourceRule{
+			settings(`{{ eq .EventType "git.pullrequest.merged" }}`),
+			settings(`{{ eq .EventType "git.pullrequest.created" }}`),
+		},
+	}
+	if err := handler.Handle(rules, args); err != nil {
+		t.Fatalf("Expected apply rules to succeed: %s", err.Error())
+	}
+	if applies := client.Applied(); len(applies) != 1 || applies[0].GetName() != "settings-git.pullrequest.merged" {
+		t.Errorf("Expected only the matching apply rule to run, but received %v", applies)
+	}
+
+	rules = config.Rules{Scale: []config.ScaleResourceRule{scale("invalid", "{{ .EventType }}")}}
+	if err := handler.Handle(rules, args); err == nil || !strings.Contains(err.Error(), "Expected true or false") {
+		t.Errorf("Expected a non-boolean condition to fail, but received %v", err)
+	}
+}
+
+func TestTransactionalRules(t *testing.T) {
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{EventType: "git.pullrequest.created"})
+
+	rules := config.Rules{
+		Apply: []config.ApplyResourceRule{
+			config.ApplyResourceRule{Resources: "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: preview\n"},
+		},
+		Job: []config.JobRule{
+			config.JobRule{
+				Job: config.Manifest("apiVersion: batch/v1\nkind: Job\nmetadata:\n  generateName: migrate-\n  namespace: preview\n"),
+			},
+		},
+	}
+
+	t.Run("transaction_test_good", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		if err := handler.HandleTransaction(rules, args); err != nil {
+			t.Fatalf("Expected rules to succeed: %s", err.Error())
+		}
+		if client.Rollbacks() != 0 {
+			t.Errorf("Expected no rollbacks but received %d", client.Rollbacks())
+		}
+	})
+
+	t.Run("transaction_test_failed", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		client.FailJobs(errors.New("BackoffLimitExceeded"))
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		err := handler.HandleTransaction(rules, args)
+		if err == nil || !strings.Contains(err.Error(), "rolled back") {
+			t.Errorf("Expected the rollback to be reported, but received %v", err)
+		}
+		if client.Rollbacks() != 1 {
+			t.Errorf("Expected 1 rollback but received %d", client.Rollbacks())
+		}
+	})
+}
+
+func TestDryRunRules(t *testing.T) {
+	args := templating.NewArgsFromServiceHook(azuredevops.ServiceHook{EventType: "git.pullrequest.created"})
+
+	replicas := int32(0)
+	scale := func(name string, dryRun bool) config.ScaleResourceRule {
+		return config.ScaleResourceRule{
+			APIVersion:  "apps/v1",
+			Kind:        "Deployment",
+			Namespace:   "preview",
+			Name:        name,
+			Replicas:    &replicas,
+			RuleOptions: config.RuleOptions{DryRun: dryRun},
+		}
+	}
+
+	rules := config.Rules{
+		Scale: []config.ScaleResourceRule{scale("live", false), scale("rule-dry-run", true)},
+		Stages: []config.RuleStage{
+			config.RuleStage{Name: "dry-run", DryRun: true, Rules: config.Rules{Scale: []config.ScaleResourceRule{scale("stage-dry-run", false)}}},
+		},
+	}
+
+	t.Run("dry_run_test_rules", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		if err := handler.Handle(rules, args); err != nil {
+			t.Fatalf("Expected rules to succeed: %s", err.Error())
+		}
+
+		for _, scale := range client.Scales() {
+			if scale.DryRun != (scale.Name != "live") {
+				t.Errorf("Unexpected dry run %t for %s", scale.DryRun, scale.Name)
+			}
+		}
+	})
+
+	t.Run("dry_run_test_all", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		changes, err := handler.HandleDryRun(rules, args)
+		if err != nil {
+			t.Fatalf("Expected rules to succeed: %s", err.Error())
+		}
+
+		if len(changes) != 3 {
+			t.Errorf("Expected 3 changes but received %v", changes)
+		}
+		for _, scale := range client.Scales() {
+			if !scale.DryRun {
+				t.Errorf("Expected %s to be scaled in dry run mode", scale.Name)
+			}
+		}
+	})
+
+	t.Run("dry_run_test_cluster", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		client.AddCluster("dev")
+		handler := processors.NewRuleHandlerForCluster(kubernetes.MakeFromClient(client), "dev")
+
+		deleteRules := config.Rules{
+			Delete: []config.DeleteResourceRule{
+				config.DeleteResourceRule{APIVersion: "v1", Kind: "ConfigMap", Namespace: "preview", Name: "settings"},
+			},
+		}
+
+		if _, err := handler.HandleDryRun(deleteRules, args); err != nil {
+			t.Fatalf("Expected rules to succeed: %s", err.Error())
+		}
+
+		deletes := client.Deletes()
+		if len(deletes) != 1 || deletes[0].Cluster != "dev" {
+			t.Errorf("Expected the delete on cluster dev, but received %v", deletes)
+		}
+	})
+}
+
+func TestPreflight(t *testing.T) {
+	rules := config.Rules{
+		Apply: []config.ApplyResourceRule{
+			config.ApplyResourceRule{
+				Resources:   "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: settings\n  namespace: pr-{{ .PullRequestID }}\n",
+				RuleOptions: config.RuleOptions{Impersonate: &config.Impersonation{User: "deployer"}},
+			},
+		},
+		Delete: []config.DeleteResourceRule{
+			config.DeleteResourceRule{
+				APIVersion:  "v1",
+				Kind:        "Secret",
+				Namespace:   "preview",
+				Name:        "credentials",
+				RuleOptions: config.RuleOptions{Impersonate: &config.Impersonation{User: "deployer"}},
+			},
+		},
+		Stages: []config.RuleStage{
+			config.RuleStage{
+				Name:    "preview",
+				Cluster: "dev",
+				Rules: config.Rules{
+					Restart: []config.RestartResourceRule{
+						config.RestartResourceRule{Kind: "Deployment", Namespace: "preview", Name: "web"},
+					},
+				},
+			},
+		},
+	}
+
+	t.Run("preflight_test_allowed", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		client.AddCluster("dev")
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		warnings, err := handler.Preflight(rules)
+		if err != nil {
+			t.Fatalf("Expected preflight to succeed: %s", err.Error())
+		}
+		if len(warnings) != 0 {
+			t.Errorf("Expected no warnings but received %v", warnings)
+		}
+
+		preflights := make(map[string]MockPreflight)
+		for _, preflight := range client.Preflights() {
+			preflights[preflight.Check.Kind] = preflight
+		}
+		if len(preflights) != 3 {
+			t.Fatalf("Expected 3 kinds to be checked but received %v", client.Preflights())
+		}
+		if configMap := preflights["ConfigMap"]; !configMap.Check.NamespaceTemplated || configMap.Check.Namespace != "" || configMap.User != "deployer" {
+			t.Errorf("Expected the templated namespace of the ConfigMap to be checked in every namespace as deployer, but received %v", configMap)
+		}
+		if secret := preflights["Secret"]; secret.User != "deployer" || secret.Check.Namespace != "preview" {
+			t.Errorf("Expected the Secret to be checked in namespace preview as deployer, but received %v", secret)
+		}
+		if deployment := preflights["Deployment"]; deployment.Cluster != "dev" || deployment.Check.APIVersion != "apps/v1" {
+			t.Errorf("Expected the apps/v1 Deployment to be checked on cluster dev, but received %v", deployment)
+		}
+	})
+
+	t.Run("preflight_test_denied", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		client.AddCluster("dev")
+		client.DenyKind("ConfigMap", errors.New("the verb create is not allowed"))
+		client.DenyKind("Deployment", errors.New("the verb patch is not allowed"))
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		warnings, err := handler.Preflight(rules)
+		if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "Apply resource rule 0: ") {
+			t.Errorf("Expected a warning for the templated namespace of apply resource rule 0, but received %v", warnings)
+		}
+		if err == nil || err.Error() != "Stage 'preview': Restart resource rule 0: the verb patch is not allowed" {
+			t.Errorf("Expected an error for restart resource rule 0 of stage preview, but received %v", err)
+		}
+	})
+
+	t.Run("preflight_test_defined_kind", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		client.DenyKind("Widget", errors.New("Kind 'Widget' was not found in API Version 'example.com/v1'"))
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
+
+		crdRules := config.Rules{
+			Apply: []config.ApplyResourceRule{
+				config.ApplyResourceRule{
+					Resources: "apiVersion: apiextensions.k8s.io/v1beta1\nkind: CustomResourceDefinition\nmetadata:\n  name: widgets.example.com\n" +
+						"spec:\n  group: example.com\n  version: v1\n  scope: Namespaced\n  names:\n    kind: Widget\n    plural: widgets\n",
+				},
+			},
+			Stages: []config.RuleStage{
+				config.RuleStage{
+					Name: "widgets",
+					Rules: config.Rules{
+						Apply: []config.ApplyResourceRule{
+							config.ApplyResourceRule{Resources: "apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: preview\n  namespace: preview\n"},
+						},
+					},
+				},
+			},
+		}
+
+		warnings, err := handler.Preflight(crdRules)
+		if err != nil {
+			t.Errorf("Expected preflight to succeed for a kind defined by the rules: %s", err.Error())
+		}
+		if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "Stage 'widgets': Apply resource rule 0: ") {
+			t.Errorf("Expected a warning for apply resource rule 0 of stage widgets, but received %v", warnings)
+		}
+
+		client.DenyKind("Gadget", errors.New("Kind 'Gadget' was not found in API Version 'example.com/v1'"))
+		crdRules.Stages[0].Rules.Apply[0].Resources = "apiVersion: example.com/v1\nkind: Gadget\nmetadata:\n  name: preview\n  namespace: preview\n"
+		if _, err := handler.Preflight(crdRules); err == nil || !strings.Contains(err.Error(), "Gadget") {
+			t.Errorf("Expected an error for a kind that the rules don't define, but received %v", err)
+		}
+	})
+
+	t.Run("preflight_test_undefined_cluster", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		handler := processors.NewRuleHandler(kubernetes.MakeFromClient(client))
 
+		if _, err := handler.Preflight(rules); err == nil || !strings.Contains(err.Error(), "Cluster dev is not defined") {
+			t.Errorf("Expected an error for the undefined cluster, but received %v", err)
+		}
+	})
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/ogmaresca/azd-kubernetes-manager/pkg/args"
 	"github.com/ogmaresca/azd-kubernetes-manager/pkg/azuredevops"
 	"github.com/ogmaresca/azd-kubernetes-manager/pkg/config"
+	"github.com/ogmaresca/azd-kubernetes-manager/pkg/kubernetes"
 	"github.com/ogmaresca/azd-kubernetes-manager/pkg/templating"
 )
 
@@ -107,13 +108,17 @@ func (h ServiceHookHandler) ServeHTTP(writer http.ResponseWriter, request *http.
 		logger.Noticef("[%s] Basic authentication was provided, but basic authentication was not configured.", requestObj.Describe())
 	}
 
+	// Every matching configuration counts its deletions against the same execution, so that the limit applies to the whole Service Hook
+	execution := h.ruleHandler.NewExecution()
+
 	anyMatches := false
+	var changes []kubernetes.Change
 	for pos, config := range h.config {
 		matches, err := config.Matches(requestObj)
 		if err != nil {
 			logger.Errorf("[%s] Error determining if Service Hook configuration %d matches request", requestObj.Describe(), pos)
 			serviceHookErrorCounter.With(prometheus.Labels{"eventType": requestObj.EventType, "reason": "Error matching configuration"}).Inc()
-			writer.WriteHeader(http.StatusInternalServerError)
+			h.writeResponse(writer, requestObj, http.StatusInternalServerError, "Error matching configuration", changes, execution.DryRunChanges())
 			return
 		}
 		if matches {
@@ -121,11 +126,22 @@ func (h ServiceHookHandler) ServeHTTP(writer http.ResponseWriter, request *http.
 
 			logger.Infof("[%s] Processing Service Hook configuration %d", requestObj.Describe(), pos)
 
-			err := h.ruleHandler.Handle(config.Rules, templating.NewArgsFromServiceHook(*requestObj))
+			ruleHandler := execution.Impersonating(config.Impersonate)
+
+			var err error
+			if h.args.DryRun {
+				var configChanges []kubernetes.Change
+				configChanges, err = ruleHandler.HandleDryRun(config.Rules, templating.NewArgsFromServiceHook(*requestObj))
+				changes = append(changes, configChanges...)
+			} else if config.Transactional {
+				err = ruleHandler.HandleTransaction(config.Rules, templating.NewArgsFromServiceHook(*requestObj))
+			} else {
+				err = ruleHandler.Handle(config.Rules, templating.NewArgsFromServiceHook(*requestObj))
+			}
 			if err != nil {
 				logger.Errorf("[%s] Error processing rules: %s", requestObj.Describe(), err.Error())
 				serviceHookErrorCounter.With(prometheus.Labels{"eventType": requestObj.EventType, "reason": "Error processing rules"}).Inc()
-				writer.WriteHeader(http.StatusInternalServerError)
+				h.writeResponse(writer, requestObj, http.StatusInternalServerError, "Error processing rules", changes, execution.DryRunChanges())
 				return
 			}
 
@@ -139,8 +155,25 @@ func (h ServiceHookHandler) ServeHTTP(writer http.ResponseWriter, request *http.
 		logger.Infof("[%s] Service Hook did not match any configuration rule", requestObj.Describe())
 	}
 
-	writer.WriteHeader(http.StatusOK)
-	writer.Write([]byte("OK"))
+	h.writeResponse(writer, requestObj, http.StatusOK, "OK", changes, execution.DryRunChanges())
+}
+
+// writeResponse writes the status and message of a Service Hook, followed by the changes that weren't made because of dry run mode.
+// The changes are written even if the rules failed, since the changes of the rules that ran are still useful.
+func (h ServiceHookHandler) writeResponse(writer http.ResponseWriter, serviceHook *azuredevops.ServiceHook, status int, message string, changes []kubernetes.Change, ruleChanges []kubernetes.Change) {
+	writer.WriteHeader(status)
+	writer.Write([]byte(message))
+	if h.args.DryRun {
+		// The rules in dry run mode are included in the changes of the dry run
+		if len(changes) == 0 {
+			writer.Write([]byte("\nDry run: no changes would have been made"))
+		} else {
+			writer.Write([]byte(fmt.Sprintf("\nDry run: the following changes would have been made:\n%s", describeChanges(changes))))
+		}
+	} else if len(ruleChanges) > 0 {
+		logger.Infof("[%s] Rules in dry run mode would have made these changes:\n%s", serviceHook.Describe(), describeChanges(ruleChanges))
+		writer.Write([]byte(fmt.Sprintf("\nRules in dry run mode would have made the following changes:\n%s", describeChanges(ruleChanges))))
+	}
 }
 
 // NewServiceHookHandler creates a an HTTP handler for Service Hooks
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/ogmaresca/azd-kubernetes-manager/pkg/args"
@@ -128,3 +129,86 @@ func TestBasicAuthentication(t *testing.T) {
 		}
 	})
 }
+
+func TestServiceHookExecution(t *testing.T) {
+	client := NewMockKubernetesClient()
+
+	replicas := int32(0)
+	scale := func(name string) config.Rules {
+		return config.Rules{Scale: []config.ScaleResourceRule{
+			config.ScaleResourceRule{APIVersion: "apps/v1", Kind: "Deployment", Namespace: "preview", Name: name, Replicas: &replicas},
+		}}
+	}
+	configs := []config.ServiceHook{
+		config.ServiceHook{Event: "git.pullrequest.merged", Continue: true, Rules: scale("web")},
+		config.ServiceHook{Event: "git.pullrequest.merged", Continue: true, Transactional: true, Rules: scale("worker")},
+	}
+
+	handler := processors.NewServiceHookHandler(args.ServiceHookArgs{}, configs, processors.NewRuleHandler(kubernetes.MakeFromClient(client)))
+
+	req, err := http.NewRequest("POST", "/serviceHooks", bytes.NewBufferString("{ \"eventType\": \"git.pullrequest.merged\" }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected HTTP status %d but received %d", http.StatusOK, recorder.Code)
+	}
+	if len(client.Scales()) != 2 {
+		t.Errorf("Expected the rules of both configurations to run, but received %v", client.Scales())
+	}
+	if client.Executions() != 1 {
+		t.Errorf("Expected every configuration to share the execution of the Service Hook, but %d executions were created", client.Executions())
+	}
+}
+
+func TestServiceHookDryRunResponse(t *testing.T) {
+	replicas := int32(0)
+	scale := func(namespace string, dryRun bool) config.ScaleResourceRule {
+		return config.ScaleResourceRule{APIVersion: "apps/v1", Kind: "Deployment", Namespace: namespace, Name: "web", Replicas: &replicas, RuleOptions: config.RuleOptions{DryRun: dryRun}}
+	}
+
+	serve := func(serviceHookArgs args.ServiceHookArgs, client MockKubernetesClient, rules config.Rules) *httptest.ResponseRecorder {
+		configs := []config.ServiceHook{config.ServiceHook{Event: "git.pullrequest.merged", Rules: rules}}
+		handler := processors.NewServiceHookHandler(serviceHookArgs, configs, processors.NewRuleHandler(kubernetes.MakeFromClient(client)))
+
+		req, err := http.NewRequest("POST", "/serviceHooks", bytes.NewBufferString("{ \"eventType\": \"git.pullrequest.merged\" }"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("dry_run_response_test_error", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+		client.FailNamespace("broken", fmt.Errorf("forbidden"))
+
+		recorder := serve(args.ServiceHookArgs{DryRun: true}, client, config.Rules{Scale: []config.ScaleResourceRule{scale("preview", false), scale("broken", false)}})
+
+		if recorder.Code != http.StatusInternalServerError {
+			t.Errorf("Expected HTTP status %d but received %d", http.StatusInternalServerError, recorder.Code)
+		}
+		if body := recorder.Body.String(); !strings.Contains(body, "Dry run: the following changes would have been made") || !strings.Contains(body, "preview") {
+			t.Errorf("Expected the changes of the dry run to be returned even though a rule failed, but received: %s", body)
+		}
+	})
+
+	t.Run("dry_run_response_test_rule", func(t *testing.T) {
+		client := NewMockKubernetesClient()
+
+		recorder := serve(args.ServiceHookArgs{}, client, config.Rules{Scale: []config.ScaleResourceRule{scale("preview", true)}})
+
+		if recorder.Code != http.StatusOK {
+			t.Errorf("Expected HTTP status %d but received %d", http.StatusOK, recorder.Code)
+		}
+		if body := recorder.Body.String(); !strings.HasPrefix(body, "OK\nRules in dry run mode would have made the following changes:") || !strings.Contains(body, "preview") {
+			t.Errorf("Expected the changes of the rule in dry run mode to be returned, but received: %s", body)
+		}
+	})
+}